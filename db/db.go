@@ -1,87 +1,158 @@
 package db
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/cnaize/lifland/model"
 )
 
-const (
-	dumpFileName string = "dump.db"
-)
-
 // NOTE:
 // fields open only for marshaling, don't use it directly
 type DB struct {
 	debug       bool
+	storage     storage
 	pmu         sync.Mutex
 	Players     map[string]*model.Player `json:"players,omitempty"`
 	tmu         sync.Mutex
 	Tournaments map[int]*model.Tournament `json:"tournaments,omitempty"`
-	fmu         sync.Mutex
-	Funds       []model.Fund `jons:"funds,omitempty"`
+	// the last generated tournament id
+	LastTournamentId int `json:"lastTournamentId,omitempty"`
+	fmu              sync.Mutex
+	Funds            []model.PendingFund `json:"funds,omitempty"`
+	// the funds failed maxFundAttempts times, they are synced after the retry only
+	DeadFunds []model.PendingFund `json:"deadFunds,omitempty"`
+	// the last generated fund id
+	LastFundId      int `json:"lastFundId,omitempty"`
+	maxFundAttempts int
+	lmu             sync.Mutex
+	Ledger          []*model.Entry `json:"ledger,omitempty"`
+	rmu             sync.Mutex
+	// responses by the idempotency key, the expired and the oldest ones are dropped on add
+	Responses    map[string]*model.Response `json:"responses,omitempty"`
+	responseTTL  time.Duration
+	maxResponses int
+	tplmu        sync.Mutex
+	Templates    map[string]*model.Template `json:"templates,omitempty"`
+	smu          sync.Mutex
+	Series       map[string]*model.Series `json:"series,omitempty"`
+	kmu          sync.Mutex
+	Tickets      map[int]*model.Ticket `json:"tickets,omitempty"`
+	// the last generated ticket id
+	LastTicketId int `json:"lastTicketId,omitempty"`
+	// the last write-ahead log record in the snapshot, see fileStorage
+	WalSeq uint64 `json:"walSeq,omitempty"`
+	// the objects changed since the last dump by kind and id, see changes
+	dmu   sync.Mutex
+	dirty map[string]bool
+	// the ledger entries persisted
+	loggedEntries int
 }
 
 var _ Interface = NewDB()
 
+// NewDB returns the db persisted to the working directory files, see BackendFile
 func NewDB() *DB {
+	return newDB(newFileStorage(""))
+}
+
+func newDB(storage storage) *DB {
 	return &DB{
-		Players:     make(map[string]*model.Player),
-		Tournaments: make(map[int]*model.Tournament),
+		storage:         storage,
+		maxFundAttempts: DefaultMaxFundAttempts,
+		responseTTL:     DefaultResponseTTL,
+		maxResponses:    DefaultMaxResponses,
+		Players:         make(map[string]*model.Player),
+		Tournaments:     make(map[int]*model.Tournament),
+		Responses:       make(map[string]*model.Response),
+		Templates:       make(map[string]*model.Template),
+		Series:          make(map[string]*model.Series),
+		Tickets:         make(map[int]*model.Ticket),
 	}
 }
 
-func (db *DB) GetPlayer(id string) *model.Player {
+func (db *DB) GetPlayer(ctx context.Context, id string) (model.Player, error) {
+	if err := ctx.Err(); err != nil {
+		return model.Player{}, err
+	}
+
 	db.pmu.Lock()
 	defer db.pmu.Unlock()
 
-	if player, ok := db.Players[id]; ok {
-		return player
+	player, ok := db.Players[id]
+	if !ok {
+		return model.Player{}, fmt.Errorf("GetPlayer: player %s %w", id, ErrNotFound)
 	}
-	return nil
+	return *player, nil
 }
 
-func (db *DB) AddPlayer(player *model.Player) error {
+func (db *DB) AddPlayer(ctx context.Context, player *model.Player) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if player == nil {
 		return fmt.Errorf("AddPlayer: player is nil")
 	}
 
+	// NOTE: the player and its opening entry are added together, in the commit locks order
+	db.lmu.Lock()
+	defer db.lmu.Unlock()
 	db.pmu.Lock()
 	defer db.pmu.Unlock()
 
 	if _, ok := db.Players[player.GetId()]; ok {
 		return fmt.Errorf("AddPlayer: player %s already exists", player.GetId())
 	}
-	db.Players[player.GetId()] = player
+	added := *player
+	db.Players[player.GetId()] = &added
+	db.touch(kindPlayer, player.GetId())
+	db.open(model.PlayerAccount(player.GetId()), player.GetBalance())
 	return nil
 }
 
-func (db *DB) DelPlayer(player *model.Player) {
-	if player == nil {
-		return
+func (db *DB) DelPlayer(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
+	db.lmu.Lock()
+	defer db.lmu.Unlock()
 	db.pmu.Lock()
 	defer db.pmu.Unlock()
 
-	delete(db.Players, player.GetId())
+	// the ledger balance can't stay without the player, the points must be taken first
+	if balance := db.balance(model.PlayerAccount(id)); balance != 0 {
+		return fmt.Errorf("DelPlayer: player %s has balance %s", id, balance)
+	}
+	delete(db.Players, id)
+	db.touch(kindPlayer, id)
+	return nil
 }
 
-func (db *DB) GetTournament(id int) *model.Tournament {
+func (db *DB) GetTournament(ctx context.Context, id int) (*model.Tournament, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	db.tmu.Lock()
 	defer db.tmu.Unlock()
 
-	if tournament, ok := db.Tournaments[id]; ok {
-		return tournament
+	tournament, ok := db.Tournaments[id]
+	if !ok {
+		return nil, fmt.Errorf("GetTournament: tournament %d %w", id, ErrNotFound)
 	}
-	return nil
+	return tournament.Clone(), nil
 }
 
-func (db *DB) AddTournament(tournament *model.Tournament) error {
+func (db *DB) AddTournament(ctx context.Context, tournament *model.Tournament) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if tournament == nil {
 		return fmt.Errorf("AddTournament: tournament is nil")
 	}
@@ -89,14 +160,80 @@ func (db *DB) AddTournament(tournament *model.Tournament) error {
 	db.tmu.Lock()
 	defer db.tmu.Unlock()
 
-	if _, ok := db.Tournaments[tournament.Id]; ok {
-		return fmt.Errorf("AddTournament: tournament %d already exists", tournament.Id)
+	if _, ok := db.Tournaments[tournament.GetId()]; ok {
+		return fmt.Errorf("AddTournament: tournament %d already exists", tournament.GetId())
 	}
-	db.Tournaments[tournament.Id] = tournament
+	db.Tournaments[tournament.GetId()] = tournament.Clone()
+	db.touch(kindTournament, strconv.Itoa(tournament.GetId()))
 	return nil
 }
 
-func (db *DB) GetOldestTournament() *model.Tournament {
+// UpdateTournament applies the update to the tournament copy and saves it if no error returned,
+// the updated tournament copy is returned
+func (db *DB) UpdateTournament(ctx context.Context, id int, update func(*model.Tournament) error) (*model.Tournament, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.tmu.Lock()
+	defer db.tmu.Unlock()
+
+	tournament, ok := db.Tournaments[id]
+	if !ok {
+		return nil, fmt.Errorf("UpdateTournament: tournament %d %w", id, ErrNotFound)
+	}
+	updated := tournament.Clone()
+	if err := update(updated); err != nil {
+		return nil, err
+	}
+	db.Tournaments[id] = updated
+	db.touch(kindTournament, strconv.Itoa(id))
+	return updated.Clone(), nil
+}
+
+// NextTournamentId generates the tournament id greater than all the existing ones
+func (db *DB) NextTournamentId(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	db.tmu.Lock()
+	defer db.tmu.Unlock()
+
+	for id := range db.Tournaments {
+		if id > db.LastTournamentId {
+			db.LastTournamentId = id
+		}
+	}
+	db.LastTournamentId++
+	db.touch(kindMeta, "")
+	return db.LastTournamentId, nil
+}
+
+// GetTournaments returns all the tournaments ordered by id
+func (db *DB) GetTournaments(ctx context.Context) ([]*model.Tournament, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.tmu.Lock()
+	defer db.tmu.Unlock()
+
+	tournaments := make([]*model.Tournament, 0, len(db.Tournaments))
+	for _, t := range db.Tournaments {
+		tournaments = append(tournaments, t.Clone())
+	}
+	sort.Slice(tournaments, func(i, j int) bool {
+		return tournaments[i].GetId() < tournaments[j].GetId()
+	})
+	return tournaments, nil
+}
+
+func (db *DB) GetOldestTournament(ctx context.Context) (*model.Tournament, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	db.tmu.Lock()
 	defer db.tmu.Unlock()
 
@@ -109,121 +246,822 @@ func (db *DB) GetOldestTournament() *model.Tournament {
 			tournament = t
 		}
 	}
-	return tournament
+	if tournament == nil {
+		return nil, fmt.Errorf("GetOldestTournament: open tournament %w", ErrNotFound)
+	}
+	return tournament.Clone(), nil
 }
 
-func (db *DB) DelTournament(tournament *model.Tournament) {
-	if tournament == nil {
-		return
+func (db *DB) DelTournament(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
 	db.tmu.Lock()
 	defer db.tmu.Unlock()
 
-	delete(db.Tournaments, tournament.Id)
+	delete(db.Tournaments, id)
+	db.touch(kindTournament, strconv.Itoa(id))
+	return nil
+}
+
+func (db *DB) GetTemplate(ctx context.Context, id string) (*model.Template, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.tplmu.Lock()
+	defer db.tplmu.Unlock()
+
+	template, ok := db.Templates[id]
+	if !ok {
+		return nil, fmt.Errorf("GetTemplate: template %s %w", id, ErrNotFound)
+	}
+	return template.Clone(), nil
+}
+
+// GetTemplates returns all the templates ordered by id
+func (db *DB) GetTemplates(ctx context.Context) ([]*model.Template, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.tplmu.Lock()
+	defer db.tplmu.Unlock()
+
+	templates := make([]*model.Template, 0, len(db.Templates))
+	for _, t := range db.Templates {
+		templates = append(templates, t.Clone())
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].GetId() < templates[j].GetId()
+	})
+	return templates, nil
+}
+
+func (db *DB) AddTemplate(ctx context.Context, template *model.Template) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if template == nil {
+		return fmt.Errorf("AddTemplate: template is nil")
+	}
+
+	db.tplmu.Lock()
+	defer db.tplmu.Unlock()
+
+	if _, ok := db.Templates[template.GetId()]; ok {
+		return fmt.Errorf("AddTemplate: template %s already exists", template.GetId())
+	}
+	db.Templates[template.GetId()] = template.Clone()
+	db.touch(kindTemplate, template.GetId())
+	return nil
+}
+
+// UpdateTemplate applies the update to the template copy and saves it if no error returned
+func (db *DB) UpdateTemplate(ctx context.Context, id string, update func(*model.Template) error) (*model.Template, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.tplmu.Lock()
+	defer db.tplmu.Unlock()
+
+	template, ok := db.Templates[id]
+	if !ok {
+		return nil, fmt.Errorf("UpdateTemplate: template %s %w", id, ErrNotFound)
+	}
+	updated := template.Clone()
+	if err := update(updated); err != nil {
+		return nil, err
+	}
+	db.Templates[id] = updated
+	db.touch(kindTemplate, id)
+	return updated.Clone(), nil
+}
+
+func (db *DB) DelTemplate(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	db.tplmu.Lock()
+	defer db.tplmu.Unlock()
+
+	delete(db.Templates, id)
+	db.touch(kindTemplate, id)
+	return nil
+}
+
+func (db *DB) GetSeries(ctx context.Context, id string) (*model.Series, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.smu.Lock()
+	defer db.smu.Unlock()
+
+	series, ok := db.Series[id]
+	if !ok {
+		return nil, fmt.Errorf("GetSeries: series %s %w", id, ErrNotFound)
+	}
+	return series.Clone(), nil
+}
+
+func (db *DB) AddSeries(ctx context.Context, series *model.Series) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if series == nil {
+		return fmt.Errorf("AddSeries: series is nil")
+	}
+
+	db.smu.Lock()
+	defer db.smu.Unlock()
+
+	if _, ok := db.Series[series.GetId()]; ok {
+		return fmt.Errorf("AddSeries: series %s already exists", series.GetId())
+	}
+	db.Series[series.GetId()] = series.Clone()
+	db.touch(kindSeries, series.GetId())
+	return nil
+}
+
+// UpdateSeries applies the update to the series copy and saves it if no error returned
+func (db *DB) UpdateSeries(ctx context.Context, id string, update func(*model.Series) error) (*model.Series, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.smu.Lock()
+	defer db.smu.Unlock()
+
+	series, ok := db.Series[id]
+	if !ok {
+		return nil, fmt.Errorf("UpdateSeries: series %s %w", id, ErrNotFound)
+	}
+	updated := series.Clone()
+	if err := update(updated); err != nil {
+		return nil, err
+	}
+	db.Series[id] = updated
+	db.touch(kindSeries, id)
+	return updated.Clone(), nil
+}
+
+func (db *DB) GetTicket(ctx context.Context, id int) (*model.Ticket, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.kmu.Lock()
+	defer db.kmu.Unlock()
+
+	ticket, ok := db.Tickets[id]
+	if !ok {
+		return nil, fmt.Errorf("GetTicket: ticket %d %w", id, ErrNotFound)
+	}
+	return ticket.Clone(), nil
 }
 
-func (db *DB) AddFund(fund model.Fund) error {
+// GetTickets returns the player tickets ordered by id, all the tickets if the player not passed
+func (db *DB) GetTickets(ctx context.Context, playerId string) ([]*model.Ticket, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.kmu.Lock()
+	defer db.kmu.Unlock()
+
+	tickets := []*model.Ticket{}
+	for _, t := range db.Tickets {
+		if playerId == "" || t.GetPlayerId() == playerId {
+			tickets = append(tickets, t.Clone())
+		}
+	}
+	sort.Slice(tickets, func(i, j int) bool {
+		return tickets[i].GetId() < tickets[j].GetId()
+	})
+	return tickets, nil
+}
+
+// AddTicket adds the ticket with the generated id, the id is set to the passed ticket
+func (db *DB) AddTicket(ctx context.Context, ticket *model.Ticket) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ticket == nil {
+		return fmt.Errorf("AddTicket: ticket is nil")
+	}
+
+	db.kmu.Lock()
+	defer db.kmu.Unlock()
+
+	db.LastTicketId++
+	ticket.Id = db.LastTicketId
+	db.Tickets[ticket.Id] = ticket.Clone()
+	db.touch(kindTicket, strconv.Itoa(ticket.Id))
+	db.touch(kindMeta, "")
+	return nil
+}
+
+// UpdateTicket applies the update to the ticket copy and saves it if no error returned
+func (db *DB) UpdateTicket(ctx context.Context, id int, update func(*model.Ticket) error) (*model.Ticket, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.kmu.Lock()
+	defer db.kmu.Unlock()
+
+	ticket, ok := db.Tickets[id]
+	if !ok {
+		return nil, fmt.Errorf("UpdateTicket: ticket %d %w", id, ErrNotFound)
+	}
+	updated := ticket.Clone()
+	if err := update(updated); err != nil {
+		return nil, err
+	}
+	db.Tickets[id] = updated
+	db.touch(kindTicket, strconv.Itoa(id))
+	return updated.Clone(), nil
+}
+
+// AddFund queues the fund synced later by SyncFunds
+// NOTE: the handlers post the payouts in the transactions, the queue drains the funds of the legacy dumps
+func (db *DB) AddFund(ctx context.Context, tournamentId int, fund model.Fund) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if fund == nil {
 		return fmt.Errorf("AddFund: fund is nil")
 	}
 
+	// NOTE: the zero income can't be posted, so the fund with it is never synced
+	fund = fund.Copy()
+	for playerId, points := range fund {
+		if points == 0 {
+			delete(fund, playerId)
+		}
+	}
+	if len(fund) == 0 {
+		return nil
+	}
+
 	db.fmu.Lock()
 	defer db.fmu.Unlock()
 
-	db.Funds = append(db.Funds, fund)
+	db.LastFundId++
+	db.Funds = append(db.Funds, model.PendingFund{
+		Id:           db.LastFundId,
+		TournamentId: tournamentId,
+		Fund:         fund,
+		Created:      time.Now(),
+	})
+	db.touch(kindFunds, "")
+	db.touch(kindMeta, "")
 	return nil
 }
 
-func (db *DB) SyncFunds() {
-	synced := false
+func (db *DB) GetFunds(ctx context.Context) ([]model.PendingFund, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.fmu.Lock()
+	defer db.fmu.Unlock()
+
+	return copyFunds(db.Funds), nil
+}
+
+func (db *DB) GetDeadFunds(ctx context.Context) ([]model.PendingFund, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	db.fmu.Lock()
-	defer func() {
-		if synced {
-			db.lockAll(&db.fmu)
-			defer db.unlockAll(&db.fmu)
-			db.dump()
+	defer db.fmu.Unlock()
+
+	return copyFunds(db.DeadFunds), nil
+}
+
+// RetryFund resets the fund attempts and moves the dead fund back to the pending funds,
+// the update changes the fund before, e.g. reassigns it, it may be nil
+func (db *DB) RetryFund(ctx context.Context, id int, update func(*model.PendingFund) error) (model.PendingFund, error) {
+	if err := ctx.Err(); err != nil {
+		return model.PendingFund{}, err
+	}
+
+	db.fmu.Lock()
+	defer db.fmu.Unlock()
+
+	funds, i := db.findFund(id)
+	if funds == nil {
+		return model.PendingFund{}, fmt.Errorf("RetryFund: fund %d %w", id, ErrNotFound)
+	}
+	updated := (*funds)[i].Copy()
+	if update != nil {
+		if err := update(&updated); err != nil {
+			return model.PendingFund{}, err
+		}
+	}
+	updated.Retry()
+	if funds == &db.DeadFunds {
+		db.DeadFunds = append(db.DeadFunds[:i], db.DeadFunds[i+1:]...)
+		db.Funds = append(db.Funds, updated)
+	} else {
+		db.Funds[i] = updated
+	}
+	db.touch(kindFunds, "")
+	db.touch(kindDeadFunds, "")
+	return updated.Copy(), nil
+}
+
+// WriteOffFund drops the pending or dead fund, its points are moved from the tournament pool to the house
+func (db *DB) WriteOffFund(ctx context.Context, id int) (model.PendingFund, error) {
+	if err := ctx.Err(); err != nil {
+		return model.PendingFund{}, err
+	}
+
+	db.fmu.Lock()
+	defer db.fmu.Unlock()
+
+	funds, i := db.findFund(id)
+	if funds == nil {
+		return model.PendingFund{}, fmt.Errorf("WriteOffFund: fund %d %w", id, ErrNotFound)
+	}
+	fund := (*funds)[i]
+	if amount := fund.Amount(); amount != 0 {
+		entry := model.NewTransfer(model.EntryWriteOff, fund.TournamentId,
+			model.TournamentAccount(fund.TournamentId), model.HouseAccount, amount)
+		if err := db.Post(ctx, entry); err != nil {
+			return model.PendingFund{}, fmt.Errorf("WriteOffFund: %w", err)
 		}
-		db.fmu.Unlock()
-	}()
+	}
+	*funds = append((*funds)[:i], (*funds)[i+1:]...)
+	db.touch(kindFunds, "")
+	db.touch(kindDeadFunds, "")
+	fmt.Printf("fund %d of tournament %d written off\n", fund.Id, fund.TournamentId)
+	return fund, nil
+}
+
+// Post applies the entry to the player balances and appends it to the ledger,
+// the entry is applied completely or not applied at all
+func (db *DB) Post(ctx context.Context, entry *model.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if entry == nil {
+		return fmt.Errorf("Post: entry is nil")
+	}
+	if err := entry.Validate(); err != nil {
+		return fmt.Errorf("Post: invalid entry: %+v", err)
+	}
+
+	db.lmu.Lock()
+	defer db.lmu.Unlock()
+	db.pmu.Lock()
+	defer db.pmu.Unlock()
+
+	if err := db.commit(&tx{db: db, entries: []*model.Entry{entry}}); err != nil {
+		return fmt.Errorf("Post: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetEntries(ctx context.Context, account model.Account) ([]model.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db.lmu.Lock()
+	defer db.lmu.Unlock()
+
+	var entries []model.Entry
+	for _, entry := range db.Ledger {
+		if entry.Amount(account) != 0 {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries, nil
+}
+
+func (db *DB) GetAccountBalance(ctx context.Context, account model.Account) (model.Money, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	db.lmu.Lock()
+	defer db.lmu.Unlock()
+
+	return db.balance(account), nil
+}
+
+func (db *DB) GetResponse(ctx context.Context, key string) (model.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return model.Response{}, err
+	}
+
+	db.rmu.Lock()
+	defer db.rmu.Unlock()
+
+	resp, ok := db.Responses[key]
+	if !ok || db.expired(resp, time.Now()) {
+		return model.Response{}, fmt.Errorf("GetResponse: response %s %w", key, ErrNotFound)
+	}
+	return *resp, nil
+}
+
+func (db *DB) AddResponse(ctx context.Context, key string, resp *model.Response) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if resp == nil {
+		return fmt.Errorf("AddResponse: response is nil")
+	}
+
+	db.rmu.Lock()
+	defer db.rmu.Unlock()
+
+	now := time.Now()
+	if resp, ok := db.Responses[key]; ok && !db.expired(resp, now) {
+		return fmt.Errorf("AddResponse: response %s already exists", key)
+	}
+	db.pruneResponses(now)
+	added := *resp
+	db.Responses[key] = &added
+	db.touch(kindResponse, key)
+	return nil
+}
+
+// NOTE: not thread safe
+func (db *DB) expired(resp *model.Response, now time.Time) bool {
+	return now.Sub(resp.Time) > db.responseTTL
+}
 
-	var funds []model.Fund
-	for _, fund := range db.Funds {
+// pruneResponses drops the expired responses, then the oldest ones to keep the room for the new one
+// NOTE: not thread safe
+func (db *DB) pruneResponses(now time.Time) {
+	for key, resp := range db.Responses {
+		if db.expired(resp, now) {
+			delete(db.Responses, key)
+			db.touch(kindResponse, key)
+		}
+	}
+	if len(db.Responses) < db.maxResponses {
+		return
+	}
+	keys := make([]string, 0, len(db.Responses))
+	for key := range db.Responses {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return db.Responses[keys[i]].Time.Before(db.Responses[keys[j]].Time)
+	})
+	for _, key := range keys[:len(keys)-db.maxResponses+1] {
+		delete(db.Responses, key)
+		db.touch(kindResponse, key)
+	}
+}
+
+// SyncFunds moves the pending funds to the players, the funds which can't be moved are kept,
+// the funds failed maxFundAttempts times are moved to the dead funds, the db is dumped only if any fund changed
+// NOTE: the pending funds come only from the dumps made before the transactions, see AddFund
+func (db *DB) SyncFunds(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	db.fmu.Lock()
+	defer db.fmu.Unlock()
+
+	if len(db.Funds) == 0 {
+		return nil
+	}
+	var funds []model.PendingFund
+	var changed bool
+	for _, pending := range db.Funds {
 		fmt.Println("syncing funds")
+		fund := pending.Fund
+		var failed error
 		for playerId, points := range fund {
-			player := db.GetPlayer(playerId)
-			if player == nil {
-				fmt.Printf("ERROR: can't sync funds: player %s not found\n", playerId)
+			// the zero incomes of the funds queued before they were dropped
+			if points == 0 {
+				delete(fund, playerId)
+				changed = true
 				continue
 			}
-			if err := player.IncrBalance(points); err == nil {
-				fmt.Printf("funds %f for player %s synced\n", points, player.GetId())
-				synced = true
-				delete(fund, playerId)
+			entry := model.NewTransfer(model.EntryCompensation, pending.TournamentId,
+				model.TournamentAccount(pending.TournamentId), model.PlayerAccount(playerId), points)
+			if err := db.Post(ctx, entry); err != nil {
+				fmt.Printf("ERROR: can't sync funds: %+v\n", err)
+				failed = err
+				continue
 			}
+			fmt.Printf("funds %s for player %s synced\n", points, playerId)
+			delete(fund, playerId)
+			changed = true
 		}
-		if len(fund) > 0 {
-			funds = append(funds, fund)
+		if len(fund) == 0 {
+			continue
+		}
+		pending.Fail(failed)
+		changed = true
+		if pending.Attempts >= db.maxFundAttempts {
+			fmt.Printf("ERROR: fund %d moved to dead funds after %d attempts: %s\n",
+				pending.Id, pending.Attempts, pending.LastError)
+			db.DeadFunds = append(db.DeadFunds, pending)
+			continue
 		}
+		funds = append(funds, pending)
 	}
 	db.Funds = funds
+	if !changed {
+		return nil
+	}
+	db.touch(kindFunds, "")
+	db.touch(kindDeadFunds, "")
+
+	db.lockAll(&db.fmu)
+	defer db.unlockAll(&db.fmu)
+
+	if err := db.dump(); err != nil {
+		return fmt.Errorf("SyncFunds: %+v", err)
+	}
+	return nil
 }
 
-func (db *DB) Reset() {
+func (db *DB) Reset(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	db.lockAll(nil)
 	defer db.unlockAll(nil)
 
-	os.Remove(dumpFileName)
+	if !db.debug {
+		if err := db.storage.clear(); err != nil {
+			return fmt.Errorf("Reset: %+v", err)
+		}
+	}
 	db.Players = make(map[string]*model.Player)
 	db.Tournaments = make(map[int]*model.Tournament)
-	db.Funds = []model.Fund{}
+	db.Funds = []model.PendingFund{}
+	db.DeadFunds = []model.PendingFund{}
+	db.LastFundId = 0
+	db.Ledger = []*model.Entry{}
+	db.Responses = make(map[string]*model.Response)
+	db.Templates = make(map[string]*model.Template)
+	db.LastTournamentId = 0
+	db.Series = make(map[string]*model.Series)
+	db.Tickets = make(map[int]*model.Ticket)
+	db.LastTicketId = 0
+	db.WalSeq = 0
+	db.dirty = nil
+	db.loggedEntries = 0
 	fmt.Println("db reseted")
+	return nil
 }
 
 func (db *DB) SetDebug(debug bool) {
 	db.debug = !db.debug
 }
 
-func (db *DB) Dump() {
+// Dump persists the changes made since the last dump
+func (db *DB) Dump(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	db.lockAll(nil)
+	defer db.unlockAll(nil)
+
+	if err := db.dump(); err != nil {
+		return fmt.Errorf("Dump: %+v", err)
+	}
+	return nil
+}
+
+// Snapshot persists the current state dropping the history of the changes
+func (db *DB) Snapshot(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	db.lockAll(nil)
 	defer db.unlockAll(nil)
 
-	db.dump()
+	if db.debug {
+		return nil
+	}
+	if err := db.compact(); err != nil {
+		return fmt.Errorf("Snapshot: %+v", err)
+	}
+	return nil
 }
 
-func (db *DB) Restore() {
-	if b, err := ioutil.ReadFile(dumpFileName); err == nil {
-		fmt.Println("restoring db")
-		if err := json.Unmarshal(b, db); err != nil {
-			fmt.Printf("db restore failed: %+v\n", err)
-			return
+// Restore loads the persisted state, the damaged storage is an error, not the empty db
+func (db *DB) Restore(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	db.lockAll(nil)
+	defer db.unlockAll(nil)
+
+	version, found, err := db.storage.load(db)
+	if err != nil {
+		return fmt.Errorf("Restore: %+v", err)
+	}
+	// the loaded objects are persisted already
+	db.markClean()
+	if !found {
+		return nil
+	}
+	fmt.Println("restoring db")
+	// NOTE: the empty ledger of the versioned dump is genuine, the balances are checked against it
+	if version == 0 && len(db.Ledger) == 0 {
+		db.openLedger()
+	}
+	if err := db.checkLedger(); err != nil {
+		return fmt.Errorf("Restore: %+v", err)
+	}
+	db.checkFunds()
+	if !db.debug {
+		if err := db.compact(); err != nil {
+			return fmt.Errorf("Restore: can't compact: %+v", err)
 		}
-		fmt.Println("db restore: success")
-		return
 	}
+	fmt.Println("db restore: success")
+	return nil
+}
+
+func (db *DB) Close() error {
+	db.lockAll(nil)
+	defer db.unlockAll(nil)
+
+	return db.storage.close()
 }
 
+// dump saves the changes made since the last dump
 // NOTE: not thread safe
-func (db *DB) dump() {
+func (db *DB) dump() error {
 	if db.debug {
-		return
+		db.markClean()
+		return nil
 	}
 
 	fmt.Println("dumping db")
-	dump, err := json.Marshal(db)
+	records, err := db.changes()
 	if err != nil {
-		fmt.Printf("ERROR: db dump failed: can't marshal data: %+v\n", err)
-		return
+		return err
 	}
-	if err := ioutil.WriteFile(dumpFileName, dump, 0644); err != nil {
-		fmt.Printf("ERROR: db dump failed: can't write to file: %+v\n", err)
-		return
+	if err := db.storage.save(records); err != nil {
+		return err
 	}
+	db.markLogged(records)
 	fmt.Println("db dump: success")
+	return nil
+}
+
+// compact saves the current state dropping the history of the changes
+// NOTE: not thread safe
+func (db *DB) compact() error {
+	records, err := db.changes()
+	if err != nil {
+		return err
+	}
+	if err := db.storage.compact(db, records); err != nil {
+		return err
+	}
+	db.markLogged(records)
+	return nil
+}
+
+// findFund returns the pending or dead funds list holding the fund and the fund index,
+// nil if the fund not found
+// NOTE: not thread safe
+func (db *DB) findFund(id int) (*[]model.PendingFund, int) {
+	for _, funds := range []*[]model.PendingFund{&db.Funds, &db.DeadFunds} {
+		for i, fund := range *funds {
+			if fund.Id == id {
+				return funds, i
+			}
+		}
+	}
+	return nil, 0
+}
+
+func copyFunds(funds []model.PendingFund) []model.PendingFund {
+	copied := make([]model.PendingFund, len(funds))
+	for i, fund := range funds {
+		copied[i] = fund.Copy()
+	}
+	return copied
+}
+
+// NOTE: not thread safe
+func (db *DB) append(entry *model.Entry) {
+	entry.Id = len(db.Ledger) + 1
+	entry.Time = time.Now()
+	db.Ledger = append(db.Ledger, entry)
+}
+
+// NOTE: not thread safe
+func (db *DB) balance(account model.Account) model.Money {
+	var balance model.Money
+	for _, entry := range db.Ledger {
+		balance += entry.Amount(account)
+	}
+	return balance
+}
+
+// open records the points the account already has as opening entry
+// NOTE: not thread safe
+func (db *DB) open(account model.Account, points model.Money) {
+	if points == 0 {
+		return
+	}
+
+	entry := model.NewTransfer(model.EntryOpening, 0, model.ExternalAccount, account, points)
+	if _, ok := account.PlayerId(); ok {
+		entry.Postings[1].Balance = points
+	}
+	db.append(entry)
+}
+
+// openLedger records opening entries for the dumps made before the ledger
+// NOTE: not thread safe
+func (db *DB) openLedger() {
+	fmt.Println("opening ledger")
+	for _, player := range db.Players {
+		db.open(model.PlayerAccount(player.GetId()), player.GetBalance())
+	}
+	for _, tournament := range db.Tournaments {
+		if !tournament.IsOpen() {
+			continue
+		}
+		var pool model.Money
+		for _, fund := range tournament.Funds {
+			for _, income := range fund {
+				pool -= income
+			}
+		}
+		db.open(model.TournamentAccount(tournament.GetId()), pool)
+	}
+}
+
+// checkLedger returns the error listing the players whose balance doesn't match the ledger
+// NOTE: not thread safe
+func (db *DB) checkLedger() error {
+	balances := make(map[model.Account]model.Money)
+	for _, entry := range db.Ledger {
+		for _, p := range entry.GetPostings() {
+			if _, ok := p.Account.PlayerId(); ok {
+				balances[p.Account] += p.Amount
+			}
+		}
+	}
+	var mismatches []string
+	for _, player := range db.Players {
+		account := model.PlayerAccount(player.GetId())
+		if balances[account] != player.GetBalance() {
+			mismatches = append(mismatches, fmt.Sprintf("player %s balance %s doesn't match ledger balance %s",
+				player.GetId(), player.GetBalance(), balances[account]))
+		}
+		delete(balances, account)
+	}
+	for account, balance := range balances {
+		if balance != 0 {
+			mismatches = append(mismatches, fmt.Sprintf("account %s has ledger balance %s without player", account, balance))
+		}
+	}
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return fmt.Errorf("ledger doesn't match balances: %s", strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// checkFunds numbers the pending funds of the dumps made before the fund ids,
+// their age is counted from the restore
+// NOTE: not thread safe
+func (db *DB) checkFunds() {
+	for i := range db.Funds {
+		if db.Funds[i].Id != 0 {
+			continue
+		}
+		db.LastFundId++
+		db.Funds[i].Id = db.LastFundId
+		db.Funds[i].Created = time.Now()
+		db.touch(kindFunds, "")
+		db.touch(kindMeta, "")
+	}
 }
 
+// NOTE: lock order matters, SyncFunds locks funds, then ledger, then players
 func (db *DB) lockAll(except *sync.Mutex) {
-	for _, m := range []*sync.Mutex{&db.pmu, &db.tmu, &db.fmu} {
+	for _, m := range []*sync.Mutex{&db.fmu, &db.lmu, &db.pmu, &db.tmu, &db.rmu, &db.tplmu, &db.smu, &db.kmu} {
 		if m != except {
 			m.Lock()
 		}
@@ -231,7 +1069,7 @@ func (db *DB) lockAll(except *sync.Mutex) {
 }
 
 func (db *DB) unlockAll(except *sync.Mutex) {
-	for _, m := range []*sync.Mutex{&db.pmu, &db.tmu, &db.fmu} {
+	for _, m := range []*sync.Mutex{&db.fmu, &db.lmu, &db.pmu, &db.tmu, &db.rmu, &db.tplmu, &db.smu, &db.kmu} {
 		if m != except {
 			m.Unlock()
 		}
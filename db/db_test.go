@@ -0,0 +1,599 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cnaize/lifland/model"
+)
+
+// backends are checked with the same conformance tests
+var backends = []string{BackendFile, BackendKV}
+
+func openTestDB(t *testing.T, backend, dir string) Interface {
+	db, err := Open(Config{Backend: backend, Dir: dir})
+	if err != nil {
+		t.Fatalf("can't open %s db: %+v", backend, err)
+	}
+	if err := db.Restore(context.Background()); err != nil {
+		t.Fatalf("can't restore %s db: %+v", backend, err)
+	}
+	return db
+}
+
+// fillDB makes the changes of every kind, dumping after each one
+func fillDB(t *testing.T, db Interface) {
+	ctx := context.Background()
+	player := model.NewPlayer("p1")
+	player.IncrBalance(model.Points(100))
+	if err := db.AddPlayer(ctx, player); err != nil {
+		t.Fatalf("can't add player: %+v", err)
+	}
+	db.Dump(ctx)
+	if err := db.AddPlayer(ctx, model.NewPlayer("p2")); err != nil {
+		t.Fatalf("can't add player: %+v", err)
+	}
+	db.Dump(ctx)
+	id, _ := db.NextTournamentId(ctx)
+	if err := db.AddTournament(ctx, model.NewTournament(id, model.Points(10))); err != nil {
+		t.Fatalf("can't add tournament: %+v", err)
+	}
+	db.Dump(ctx)
+	if err := db.Post(ctx, model.NewTransfer(model.EntryJoin, id,
+		model.PlayerAccount("p1"), model.TournamentAccount(id), model.Points(10))); err != nil {
+		t.Fatalf("can't post entry: %+v", err)
+	}
+	db.AddFund(ctx, id, model.Fund{"p2": model.Points(5)})
+	db.DelPlayer(ctx, "p2")
+	// the fund of the deleted player dies
+	for i := 0; i < DefaultMaxFundAttempts; i++ {
+		db.SyncFunds(ctx)
+	}
+	db.AddFund(ctx, id, model.Fund{"p1": model.Points(10)})
+	db.Dump(ctx)
+}
+
+// checkRestored checks the state made by fillDB, the pending fund is synced at the end
+func checkRestored(t *testing.T, db Interface) {
+	ctx := context.Background()
+	if _, err := db.GetPlayer(ctx, "p2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted player restored")
+	}
+	player, err := db.GetPlayer(ctx, "p1")
+	if err != nil || player.GetBalance() != model.Points(90) {
+		t.Fatalf("invalid restored player: %+v, %+v", player, err)
+	}
+	if _, err := db.GetTournament(ctx, 1); err != nil {
+		t.Errorf("tournament not restored: %+v", err)
+	}
+	if id, _ := db.NextTournamentId(ctx); id != 2 {
+		t.Errorf("invalid next tournament id: want 2, got %d", id)
+	}
+	entries, _ := db.GetEntries(ctx, model.PlayerAccount("p1"))
+	balance, _ := db.GetAccountBalance(ctx, model.PlayerAccount("p1"))
+	if len(entries) != 2 || balance != model.Points(90) {
+		t.Errorf("invalid restored ledger: %+v", entries)
+	}
+	dead, _ := db.GetDeadFunds(ctx)
+	if len(dead) != 1 || dead[0].Id != 1 || dead[0].Attempts != DefaultMaxFundAttempts || dead[0].LastError == "" {
+		t.Errorf("invalid restored dead funds: %+v", dead)
+	}
+	if funds, _ := db.GetFunds(ctx); len(funds) != 1 || funds[0].Id != 2 || funds[0].Created.IsZero() {
+		t.Errorf("invalid restored funds: %+v", funds)
+	}
+	if err := db.SyncFunds(ctx); err != nil {
+		t.Fatalf("can't sync funds: %+v", err)
+	}
+	if player, _ := db.GetPlayer(ctx, "p1"); player.GetBalance() != model.Points(100) {
+		t.Errorf("pending fund not restored")
+	}
+}
+
+var conformanceTests = []struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, db Interface)
+}{
+	{"players", func(t *testing.T, ctx context.Context, db Interface) {
+		player := model.NewPlayer("p1")
+		player.IncrBalance(model.Points(10))
+		if err := db.AddPlayer(ctx, player); err != nil {
+			t.Fatalf("can't add player: %+v", err)
+		}
+		if err := db.AddPlayer(ctx, player); err == nil {
+			t.Errorf("player added twice")
+		}
+		// the returned player is a copy
+		got, err := db.GetPlayer(ctx, "p1")
+		if err != nil {
+			t.Fatalf("can't get player: %+v", err)
+		}
+		got.IncrBalance(model.Points(5))
+		player.IncrBalance(model.Points(5))
+		if got, _ := db.GetPlayer(ctx, "p1"); got.GetBalance() != model.Points(10) {
+			t.Errorf("player changed outside db: balance %s", got.GetBalance())
+		}
+		if err := db.DelPlayer(ctx, "p1"); err == nil {
+			t.Errorf("player with balance deleted")
+		}
+		if err := db.Post(ctx, model.NewTransfer(model.EntryTake, 0,
+			model.PlayerAccount("p1"), model.ExternalAccount, model.Points(10))); err != nil {
+			t.Fatalf("can't take points: %+v", err)
+		}
+		if err := db.DelPlayer(ctx, "p1"); err != nil {
+			t.Fatalf("can't delete player: %+v", err)
+		}
+		if _, err := db.GetPlayer(ctx, "p1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid deleted player error: %+v", err)
+		}
+	}},
+	{"tournaments", func(t *testing.T, ctx context.Context, db Interface) {
+		tournament := model.NewTournament(2, model.Points(10))
+		if err := db.AddTournament(ctx, tournament); err != nil {
+			t.Fatalf("can't add tournament: %+v", err)
+		}
+		if err := db.AddTournament(ctx, tournament); err == nil {
+			t.Errorf("tournament added twice")
+		}
+		tournament.OpenRegistration()
+		if got, _ := db.GetTournament(ctx, 2); got.IsOpen() {
+			t.Errorf("tournament changed outside db")
+		}
+
+		updated, err := db.UpdateTournament(ctx, 2, (*model.Tournament).OpenRegistration)
+		if err != nil || !updated.IsOpen() {
+			t.Fatalf("can't update tournament: %+v", err)
+		}
+		// the failed update isn't applied
+		_, err = db.UpdateTournament(ctx, 2, func(t *model.Tournament) error {
+			t.AddPlayer("p1", model.Fund{"p1": model.Points(-10)})
+			return errors.New("failed")
+		})
+		if err == nil {
+			t.Errorf("failed update succeeded")
+		}
+		got, err := db.GetTournament(ctx, 2)
+		if err != nil || !got.IsOpen() || got.HasPlayer("p1") {
+			t.Errorf("invalid tournament after failed update: %+v", err)
+		}
+		if _, err := db.UpdateTournament(ctx, 3, (*model.Tournament).OpenRegistration); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid missing tournament update error: %+v", err)
+		}
+
+		id, err := db.NextTournamentId(ctx)
+		if err != nil || id != 3 {
+			t.Fatalf("invalid next tournament id %d: %+v", id, err)
+		}
+		db.AddTournament(ctx, model.NewTournament(id, model.Points(10)))
+		tournaments, err := db.GetTournaments(ctx)
+		if err != nil || len(tournaments) != 2 || tournaments[0].GetId() != 2 || tournaments[1].GetId() != 3 {
+			t.Errorf("invalid tournaments: %+v", err)
+		}
+		if oldest, err := db.GetOldestTournament(ctx); err != nil || oldest.GetId() != 2 {
+			t.Errorf("invalid oldest tournament: %+v", err)
+		}
+		if err := db.DelTournament(ctx, 2); err != nil {
+			t.Fatalf("can't delete tournament: %+v", err)
+		}
+		if _, err := db.GetTournament(ctx, 2); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid deleted tournament error: %+v", err)
+		}
+		if _, err := db.GetOldestTournament(ctx); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid oldest tournament error: %+v", err)
+		}
+	}},
+	{"templates", func(t *testing.T, ctx context.Context, db Interface) {
+		settings := model.TemplateSettings{Deposit: model.Points(10), Recurrence: "@hourly"}
+		template, _ := model.NewTemplate("t1", settings)
+		if err := db.AddTemplate(ctx, template); err != nil {
+			t.Fatalf("can't add template: %+v", err)
+		}
+		if err := db.AddTemplate(ctx, template); err == nil {
+			t.Errorf("template added twice")
+		}
+		settings.Deposit = model.Points(20)
+		if _, err := db.UpdateTemplate(ctx, "t1", func(t *model.Template) error {
+			return t.SetSettings(settings)
+		}); err != nil {
+			t.Fatalf("can't update template: %+v", err)
+		}
+		templates, err := db.GetTemplates(ctx)
+		if err != nil || len(templates) != 1 || templates[0].GetSettings().Deposit != model.Points(20) {
+			t.Errorf("invalid templates: %+v", err)
+		}
+		db.DelTemplate(ctx, "t1")
+		if _, err := db.GetTemplate(ctx, "t1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid deleted template error: %+v", err)
+		}
+	}},
+	{"series", func(t *testing.T, ctx context.Context, db Interface) {
+		series, _ := model.NewSeries("s1", "linear", []model.Money{model.Points(10)})
+		if err := db.AddSeries(ctx, series); err != nil {
+			t.Fatalf("can't add series: %+v", err)
+		}
+		if err := db.AddSeries(ctx, series); err == nil {
+			t.Errorf("series added twice")
+		}
+		pay := func(s *model.Series) error { return s.Pay(time.Now()) }
+		if _, err := db.UpdateSeries(ctx, "s1", pay); err != nil {
+			t.Fatalf("can't pay series: %+v", err)
+		}
+		if _, err := db.UpdateSeries(ctx, "s1", pay); err == nil {
+			t.Errorf("series paid twice")
+		}
+		if got, err := db.GetSeries(ctx, "s1"); err != nil {
+			t.Errorf("can't get series: %+v", err)
+		} else if _, ok := got.GetPaidAt(); !ok {
+			t.Errorf("series payment not saved")
+		}
+		if _, err := db.GetSeries(ctx, "s2"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid missing series error: %+v", err)
+		}
+	}},
+	{"tickets", func(t *testing.T, ctx context.Context, db Interface) {
+		target := model.NewTournament(1, model.Points(10))
+		for _, playerId := range []string{"p1", "p2", "p1"} {
+			if err := db.AddTicket(ctx, model.NewTicket(playerId, 2, target, time.Time{})); err != nil {
+				t.Fatalf("can't add ticket: %+v", err)
+			}
+		}
+		tickets, err := db.GetTickets(ctx, "p1")
+		if err != nil || len(tickets) != 2 || tickets[0].GetId() != 1 || tickets[1].GetId() != 3 {
+			t.Fatalf("invalid player tickets: %+v", err)
+		}
+		if all, _ := db.GetTickets(ctx, ""); len(all) != 3 {
+			t.Errorf("invalid tickets number %d", len(all))
+		}
+		if _, err := db.UpdateTicket(ctx, 1, func(t *model.Ticket) error {
+			return t.Close(model.TicketExpired)
+		}); err != nil {
+			t.Fatalf("can't update ticket: %+v", err)
+		}
+		if got, _ := db.GetTicket(ctx, 1); got.GetState() != model.TicketExpired {
+			t.Errorf("invalid ticket state %s", got.GetState())
+		}
+		if _, err := db.GetTicket(ctx, 4); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid missing ticket error: %+v", err)
+		}
+	}},
+	{"ledger", func(t *testing.T, ctx context.Context, db Interface) {
+		player := model.NewPlayer("p1")
+		player.IncrBalance(model.Points(10))
+		db.AddPlayer(ctx, player)
+		take := func(points model.Money) error {
+			return db.Post(ctx, model.NewTransfer(model.EntryTake, 0,
+				model.PlayerAccount("p1"), model.ExternalAccount, points))
+		}
+		if err := take(model.Points(3)); err != nil {
+			t.Fatalf("can't post entry: %+v", err)
+		}
+		if err := take(model.Points(8)); err == nil {
+			t.Errorf("overdraft posted")
+		}
+		if got, _ := db.GetPlayer(ctx, "p1"); got.GetBalance() != model.Points(7) {
+			t.Errorf("invalid player balance %s", got.GetBalance())
+		}
+		balance, _ := db.GetAccountBalance(ctx, model.PlayerAccount("p1"))
+		entries, _ := db.GetEntries(ctx, model.PlayerAccount("p1"))
+		if balance != model.Points(7) || len(entries) != 2 {
+			t.Errorf("invalid account balance %s and entries %+v", balance, entries)
+		}
+	}},
+	{"transactions", func(t *testing.T, ctx context.Context, db Interface) {
+		for _, id := range []string{"p1", "p2"} {
+			player := model.NewPlayer(id)
+			player.IncrBalance(model.Points(10))
+			db.AddPlayer(ctx, player)
+		}
+		tournament := model.NewTournament(1, model.Points(10))
+		tournament.OpenRegistration()
+		db.AddTournament(ctx, tournament)
+		join := func(update func(*model.Tournament) error) error {
+			tx := db.Begin()
+			defer tx.Rollback()
+			for _, id := range []string{"p1", "p2"} {
+				tx.Post(model.NewTransfer(model.EntryJoin, 1,
+					model.PlayerAccount(id), model.TournamentAccount(1), model.Points(5)))
+			}
+			tx.UpdateTournament(1, update)
+			return tx.Commit(ctx)
+		}
+		add := func(t *model.Tournament) error {
+			return t.AddPlayer("p1", model.Fund{"p1": model.Points(5), "p2": model.Points(5)})
+		}
+		check := func(want model.Money, joined bool) {
+			for _, id := range []string{"p1", "p2"} {
+				if got, _ := db.GetPlayer(ctx, id); got.GetBalance() != want {
+					t.Errorf("invalid player %s balance: want %s, got %s", id, want, got.GetBalance())
+				}
+			}
+			if got, _ := db.GetTournament(ctx, 1); got.HasPlayer("p1") != joined {
+				t.Errorf("invalid tournament player: want joined %t", joined)
+			}
+		}
+
+		// the overdraft of one player fails all the changes
+		db.Post(ctx, model.NewTransfer(model.EntryTake, 0,
+			model.PlayerAccount("p2"), model.ExternalAccount, model.Points(6)))
+		if err := join(add); !errors.Is(err, ErrBalance) {
+			t.Errorf("invalid overdraft error: %+v", err)
+		}
+		db.Post(ctx, model.NewTransfer(model.EntryFund, 0,
+			model.ExternalAccount, model.PlayerAccount("p2"), model.Points(6)))
+		check(model.Points(10), false)
+		// the failed update fails the entries
+		failed := errors.New("failed")
+		if err := join(func(t *model.Tournament) error {
+			add(t)
+			return failed
+		}); err != failed {
+			t.Errorf("invalid update error: %+v", err)
+		}
+		check(model.Points(10), false)
+		// the rolled back transaction can't be committed
+		tx := db.Begin()
+		tx.UpdateTournament(1, add)
+		tx.Rollback()
+		if err := tx.Commit(ctx); err == nil {
+			t.Errorf("rolled back transaction committed")
+		}
+		check(model.Points(10), false)
+
+		if err := join(add); err != nil {
+			t.Fatalf("can't commit: %+v", err)
+		}
+		check(model.Points(5), true)
+		entries, _ := db.GetEntries(ctx, model.TournamentAccount(1))
+		balance, _ := db.GetAccountBalance(ctx, model.TournamentAccount(1))
+		if len(entries) != 2 || balance != model.Points(10) {
+			t.Errorf("invalid tournament entries %+v and balance %s", entries, balance)
+		}
+
+		// the entries posted by the update depend on the updated tournament
+		leave := func(take model.Money) error {
+			tx := db.Begin()
+			tx.UpdateTournament(1, func(t *model.Tournament) error {
+				funds, err := t.Remove("p1")
+				for _, fund := range funds {
+					for id, income := range fund {
+						tx.Post(model.NewTransfer(model.EntryRefund, 1,
+							model.TournamentAccount(1), model.PlayerAccount(id), income))
+					}
+				}
+				tx.Post(model.NewTransfer(model.EntryTake, 0,
+					model.PlayerAccount("p2"), model.ExternalAccount, take))
+				return err
+			})
+			return tx.Commit(ctx)
+		}
+		if err := leave(model.Points(11)); !errors.Is(err, ErrBalance) {
+			t.Errorf("invalid posted overdraft error: %+v", err)
+		}
+		check(model.Points(5), true)
+		if err := leave(model.Points(5)); err != nil {
+			t.Fatalf("can't commit posted entries: %+v", err)
+		}
+		if got, _ := db.GetPlayer(ctx, "p2"); got.GetBalance() != model.Points(5) {
+			t.Errorf("invalid posted entries balance %s", got.GetBalance())
+		}
+		if got, _ := db.GetTournament(ctx, 1); got.HasPlayer("p1") {
+			t.Errorf("tournament player not removed")
+		}
+
+		// the settle moves the points left after the staged entries, the ticket is added on commit
+		db.Post(ctx, model.NewTransfer(model.EntryJoin, 1,
+			model.PlayerAccount("p1"), model.TournamentAccount(1), model.Points(10)))
+		tx = db.Begin()
+		ticket := model.NewTicket("p1", 1, tournament, time.Time{})
+		ticket.Value = model.Points(4)
+		tx.Post(model.NewTransfer(model.EntryTicket, 1,
+			model.TournamentAccount(1), model.TicketsAccount, ticket.GetValue()))
+		tx.AddTicket(ticket)
+		tx.Settle(model.EntrySettle, 1, model.TournamentAccount(1), model.HouseAccount)
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("can't commit settle: %+v", err)
+		}
+		pool, _ := db.GetAccountBalance(ctx, model.TournamentAccount(1))
+		house, _ := db.GetAccountBalance(ctx, model.HouseAccount)
+		if pool != 0 || house != model.Points(6) {
+			t.Errorf("invalid settled pool %s and house %s", pool, house)
+		}
+		if got, err := db.GetTicket(ctx, ticket.GetId()); err != nil || got.GetValue() != model.Points(4) {
+			t.Errorf("invalid added ticket %+v: %+v", got, err)
+		}
+
+		// the covered account can't go negative
+		for _, points := range []int64{7, 6} {
+			tx = db.Begin()
+			tx.Post(model.NewTransfer(model.EntrySeason, 0,
+				model.HouseAccount, model.PlayerAccount("p1"), model.Points(points)))
+			tx.Cover(model.HouseAccount)
+			if err := tx.Commit(ctx); (points == 7) != errors.Is(err, ErrBalance) {
+				t.Errorf("invalid covered commit of %d points: %+v", points, err)
+			}
+		}
+		if house, _ := db.GetAccountBalance(ctx, model.HouseAccount); house != 0 {
+			t.Errorf("invalid covered house %s", house)
+		}
+	}},
+	{"funds", func(t *testing.T, ctx context.Context, db Interface) {
+		db.AddPlayer(ctx, model.NewPlayer("p1"))
+		fund := model.Fund{"p1": model.Points(5), "p2": model.Points(5)}
+		if err := db.AddFund(ctx, 1, fund); err != nil {
+			t.Fatalf("can't add fund: %+v", err)
+		}
+		delete(fund, "p1")
+		if err := db.SyncFunds(ctx); err != nil {
+			t.Fatalf("can't sync funds: %+v", err)
+		}
+		if got, _ := db.GetPlayer(ctx, "p1"); got.GetBalance() != model.Points(5) {
+			t.Errorf("fund not synced: balance %s", got.GetBalance())
+		}
+		// the missing player fund is kept
+		db.AddPlayer(ctx, model.NewPlayer("p2"))
+		db.SyncFunds(ctx)
+		if got, _ := db.GetPlayer(ctx, "p2"); got.GetBalance() != model.Points(5) {
+			t.Errorf("kept fund not synced: balance %s", got.GetBalance())
+		}
+
+		// the zero income is dropped, so it doesn't keep the fund
+		db.AddFund(ctx, 1, model.Fund{"p1": model.Points(5), "p4": 0})
+		db.SyncFunds(ctx)
+		if funds, _ := db.GetFunds(ctx); len(funds) != 0 {
+			t.Errorf("zero income fund kept: %+v", funds)
+		}
+		if got, _ := db.GetPlayer(ctx, "p1"); got.GetBalance() != model.Points(10) {
+			t.Errorf("zero income fund not synced: balance %s", got.GetBalance())
+		}
+
+		// the fund failed too many times dies
+		db.AddFund(ctx, 1, model.Fund{"p3": model.Points(5)})
+		for i := 0; i < DefaultMaxFundAttempts; i++ {
+			db.SyncFunds(ctx)
+		}
+		funds, _ := db.GetFunds(ctx)
+		dead, _ := db.GetDeadFunds(ctx)
+		if len(funds) != 0 || len(dead) != 1 || dead[0].Attempts != DefaultMaxFundAttempts || dead[0].LastError == "" {
+			t.Fatalf("invalid dead funds %+v, pending %+v", dead, funds)
+		}
+		// the reassigned fund is retried
+		if _, err := db.RetryFund(ctx, dead[0].Id, func(f *model.PendingFund) error {
+			return f.Reassign("p3", "p1")
+		}); err != nil {
+			t.Fatalf("can't reassign fund: %+v", err)
+		}
+		if dead, _ := db.GetDeadFunds(ctx); len(dead) != 0 {
+			t.Errorf("retried fund kept dead: %+v", dead)
+		}
+		db.SyncFunds(ctx)
+		if got, _ := db.GetPlayer(ctx, "p1"); got.GetBalance() != model.Points(15) {
+			t.Errorf("reassigned fund not synced: balance %s", got.GetBalance())
+		}
+		if _, err := db.RetryFund(ctx, dead[0].Id, nil); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid synced fund retry error: %+v", err)
+		}
+
+		// the written off fund goes to the house
+		db.AddFund(ctx, 1, model.Fund{"p3": model.Points(5)})
+		funds, _ = db.GetFunds(ctx)
+		if _, err := db.WriteOffFund(ctx, funds[0].Id); err != nil {
+			t.Fatalf("can't write off fund: %+v", err)
+		}
+		if funds, _ := db.GetFunds(ctx); len(funds) != 0 {
+			t.Errorf("written off fund kept: %+v", funds)
+		}
+		if balance, _ := db.GetAccountBalance(ctx, model.HouseAccount); balance != model.Points(5) {
+			t.Errorf("invalid house balance %s", balance)
+		}
+		if _, err := db.WriteOffFund(ctx, funds[0].Id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid written off fund error: %+v", err)
+		}
+	}},
+	{"responses", func(t *testing.T, ctx context.Context, db Interface) {
+		resp := model.NewResponse("/fund", "", 200, "", "")
+		if err := db.AddResponse(ctx, "k1", resp); err != nil {
+			t.Fatalf("can't add response: %+v", err)
+		}
+		if err := db.AddResponse(ctx, "k1", resp); err == nil {
+			t.Errorf("response added twice")
+		}
+		if got, err := db.GetResponse(ctx, "k1"); err != nil || got.Path != "/fund" {
+			t.Errorf("invalid response %+v: %+v", got, err)
+		}
+		if _, err := db.GetResponse(ctx, "k2"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("invalid missing response error: %+v", err)
+		}
+	}},
+	{"context", func(t *testing.T, ctx context.Context, db Interface) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := db.AddPlayer(cancelled, model.NewPlayer("p1")); !errors.Is(err, context.Canceled) {
+			t.Errorf("invalid cancelled add error: %+v", err)
+		}
+		if _, err := db.GetPlayer(ctx, "p1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("player added with cancelled context")
+		}
+		if _, err := db.GetTournaments(cancelled); !errors.Is(err, context.Canceled) {
+			t.Errorf("invalid cancelled get error: %+v", err)
+		}
+	}},
+}
+
+func TestConformance(t *testing.T) {
+	for _, backend := range backends {
+		for _, test := range conformanceTests {
+			t.Run(backend+"/"+test.name, func(t *testing.T) {
+				db := openTestDB(t, backend, t.TempDir())
+				defer db.Close()
+				test.run(t, context.Background(), db)
+			})
+		}
+	}
+}
+
+func TestConformancePersistence(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			db := openTestDB(t, backend, dir)
+			fillDB(t, db)
+			db.Close()
+
+			restored := openTestDB(t, backend, dir)
+			checkRestored(t, restored)
+			restored.DelTournament(ctx, 1)
+			restored.Dump(ctx)
+			restored.Close()
+
+			again := openTestDB(t, backend, dir)
+			if _, err := again.GetTournament(ctx, 1); !errors.Is(err, ErrNotFound) {
+				t.Errorf("deleted tournament restored")
+			}
+			if player, _ := again.GetPlayer(ctx, "p1"); player.GetBalance() != model.Points(100) {
+				t.Errorf("synced fund not restored")
+			}
+			if err := again.Reset(ctx); err != nil {
+				t.Fatalf("can't reset: %+v", err)
+			}
+			again.Close()
+
+			empty := openTestDB(t, backend, dir)
+			defer empty.Close()
+			if _, err := empty.GetPlayer(ctx, "p1"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("player restored after reset")
+			}
+		})
+	}
+}
+
+func TestPruneResponses(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(newFileStorage(t.TempDir()))
+	db.SetDebug(true)
+	db.responseTTL = time.Hour
+	db.maxResponses = 2
+
+	expired := model.NewResponse("/fund", "", 200, "", "")
+	expired.Time = time.Now().Add(-2 * time.Hour)
+	db.AddResponse(ctx, "expired", expired)
+	if _, err := db.GetResponse(ctx, "expired"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired response replayed: %+v", err)
+	}
+	for i, key := range []string{"k1", "k2", "k3"} {
+		resp := model.NewResponse("/fund", "", 200, "", "")
+		resp.Time = time.Now().Add(time.Duration(i-3) * time.Minute)
+		if err := db.AddResponse(ctx, key, resp); err != nil {
+			t.Fatalf("can't add response %s: %+v", key, err)
+		}
+	}
+	if len(db.Responses) != 2 {
+		t.Errorf("invalid responses number %d", len(db.Responses))
+	}
+	for key, want := range map[string]bool{"expired": false, "k1": false, "k2": true, "k3": true} {
+		if _, err := db.GetResponse(ctx, key); (err == nil) != want {
+			t.Errorf("invalid response %s kept %t: %+v", key, !want, err)
+		}
+	}
+}
@@ -1,23 +1,150 @@
 package db
 
-import "github.com/cnaize/lifland/model"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/cnaize/lifland/model"
+)
+
+var (
+	// ErrNotFound is returned for the missing objects, check it with errors.Is
+	ErrNotFound = errors.New("not found")
+	// ErrBalance is returned for the entries which would make the player balance negative
+	ErrBalance = errors.New("insufficient balance")
+)
+
+// Interface is the storage of the players, tournaments and the ledger,
+// the returned objects are copies, the changes are made with the update methods
+// and persisted on dump
+// NOTE: the update functions run under the storage lock, they mustn't call the storage
 type Interface interface {
-	GetPlayer(id string) *model.Player
-	AddPlayer(player *model.Player) error
-	DelPlayer(player *model.Player)
+	GetPlayer(ctx context.Context, id string) (model.Player, error)
+	AddPlayer(ctx context.Context, player *model.Player) error
+	DelPlayer(ctx context.Context, id string) error
+
+	GetTournament(ctx context.Context, id int) (*model.Tournament, error)
+	AddTournament(ctx context.Context, tournament *model.Tournament) error
+	UpdateTournament(ctx context.Context, id int, update func(*model.Tournament) error) (*model.Tournament, error)
+	DelTournament(ctx context.Context, id int) error
+	GetTournaments(ctx context.Context) ([]*model.Tournament, error)
+	GetOldestTournament(ctx context.Context) (*model.Tournament, error)
+	NextTournamentId(ctx context.Context) (int, error)
+
+	GetTemplate(ctx context.Context, id string) (*model.Template, error)
+	GetTemplates(ctx context.Context) ([]*model.Template, error)
+	AddTemplate(ctx context.Context, template *model.Template) error
+	UpdateTemplate(ctx context.Context, id string, update func(*model.Template) error) (*model.Template, error)
+	DelTemplate(ctx context.Context, id string) error
 
-	GetTournament(id int) *model.Tournament
-	AddTournament(tournament *model.Tournament) error
-	DelTournament(tournament *model.Tournament)
-	GetOldestTournament() *model.Tournament
+	GetSeries(ctx context.Context, id string) (*model.Series, error)
+	AddSeries(ctx context.Context, series *model.Series) error
+	UpdateSeries(ctx context.Context, id string, update func(*model.Series) error) (*model.Series, error)
 
-	AddFund(fund model.Fund) error
-	SyncFunds()
+	GetTicket(ctx context.Context, id int) (*model.Ticket, error)
+	GetTickets(ctx context.Context, playerId string) ([]*model.Ticket, error)
+	AddTicket(ctx context.Context, ticket *model.Ticket) error
+	UpdateTicket(ctx context.Context, id int, update func(*model.Ticket) error) (*model.Ticket, error)
 
-	Dump()
-	Restore()
-	Reset()
+	// NOTE: the payouts are posted in the transactions, see Tx, nothing adds the funds now,
+	// the pending and dead funds are restored from the dumps made before and exist only to drain them
+	AddFund(ctx context.Context, tournamentId int, fund model.Fund) error
+	SyncFunds(ctx context.Context) error
+	GetFunds(ctx context.Context) ([]model.PendingFund, error)
+	// GetDeadFunds returns the funds failed too many times, they aren't synced until retried
+	GetDeadFunds(ctx context.Context) ([]model.PendingFund, error)
+	RetryFund(ctx context.Context, id int, update func(*model.PendingFund) error) (model.PendingFund, error)
+	WriteOffFund(ctx context.Context, id int) (model.PendingFund, error)
+
+	// Begin starts the transaction, see Tx
+	Begin() Tx
+	Post(ctx context.Context, entry *model.Entry) error
+	GetEntries(ctx context.Context, account model.Account) ([]model.Entry, error)
+	GetAccountBalance(ctx context.Context, account model.Account) (model.Money, error)
+
+	GetResponse(ctx context.Context, key string) (model.Response, error)
+	AddResponse(ctx context.Context, key string, resp *model.Response) error
+
+	Dump(ctx context.Context) error
+	Restore(ctx context.Context) error
+	Snapshot(ctx context.Context) error
+	Reset(ctx context.Context) error
+	Close() error
 
 	SetDebug(debug bool)
 }
+
+// Tx stages the ledger entries and the objects updates, the commit applies all of them or nothing,
+// so the other storage users never see the partially applied changes
+// NOTE: the update functions run under the storage lock on commit, they mustn't call the storage,
+// but they may Post the entries depending on the updated objects, the entries are checked after the updates
+type Tx interface {
+	Post(entry *model.Entry)
+	UpdateTournament(id int, update func(*model.Tournament) error)
+	UpdateTicket(id int, update func(*model.Ticket) error)
+	UpdateSeries(id string, update func(*model.Series) error)
+	// AddTicket adds the ticket with the next id on commit
+	AddTicket(ticket *model.Ticket)
+	// Settle moves the points left on the account after all the staged entries to the other account,
+	// the negative balance is covered by the other account
+	Settle(typ model.EntryType, tournamentId int, from, to model.Account)
+	// Cover requires the account to stay non-negative after all the staged entries, like the player accounts,
+	// ErrBalance is returned otherwise
+	Cover(account model.Account)
+	// Commit returns the error of the first failed change, the update errors are returned as is
+	Commit(ctx context.Context) error
+	// Rollback drops the staged changes, it does nothing after the commit
+	Rollback()
+}
+
+const (
+	// BackendFile keeps the db in memory with the JSON snapshot and the write-ahead log
+	BackendFile string = "file"
+	// BackendKV keeps the db in memory with the embedded key-value store on disk
+	BackendKV string = "kv"
+
+	// DefaultMaxFundAttempts is the number of the failed syncs moving the fund to the dead funds
+	DefaultMaxFundAttempts int = 10
+	// DefaultResponseTTL is the time the response is replayed for the retried request
+	DefaultResponseTTL time.Duration = 24 * time.Hour
+	// DefaultMaxResponses is the number of the kept responses, the oldest ones are dropped
+	DefaultMaxResponses int = 100000
+)
+
+type Config struct {
+	// storage backend, BackendFile if not set
+	Backend string
+	// directory of the storage files, the working directory if not set
+	Dir string
+	// failed syncs moving the fund to the dead funds, DefaultMaxFundAttempts if not set
+	MaxFundAttempts int
+	// time the response is kept, DefaultResponseTTL if not set
+	ResponseTTL time.Duration
+	// number of the kept responses, DefaultMaxResponses if not set
+	MaxResponses int
+}
+
+// Open returns the db with the configured backend, call Restore to load the persisted data
+func Open(config Config) (Interface, error) {
+	var db *DB
+	switch config.Backend {
+	case "", BackendFile:
+		db = newDB(newFileStorage(config.Dir))
+	case BackendKV:
+		db = newDB(newKVStorage(config.Dir))
+	default:
+		return nil, fmt.Errorf("Open: unknown backend %s", config.Backend)
+	}
+	if config.MaxFundAttempts > 0 {
+		db.maxFundAttempts = config.MaxFundAttempts
+	}
+	if config.ResponseTTL > 0 {
+		db.responseTTL = config.ResponseTTL
+	}
+	if config.MaxResponses > 0 {
+		db.maxResponses = config.MaxResponses
+	}
+	return db, nil
+}
@@ -0,0 +1,295 @@
+// Package kv is the embedded key-value store keeping the values in the append-only file,
+// the writes are batched, every batch is applied completely or not applied at all
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// checksum and size of the batch
+	headerSize int = 8
+
+	opPut    byte = 1
+	opDelete byte = 2
+)
+
+// ErrNotFound is returned for the missing keys
+var ErrNotFound = errors.New("kv: key not found")
+
+type Store struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+	// value positions in the file by key
+	keys map[string]position
+}
+
+type position struct {
+	offset int64
+	size   int
+}
+
+// Batch is the set of changes written atomically
+type Batch struct {
+	buf bytes.Buffer
+	ops []batchOp
+}
+
+type batchOp struct {
+	key string
+	// value offset in the batch, -1 for the deleted key
+	offset int
+	size   int
+}
+
+func (b *Batch) Put(key string, value []byte) {
+	b.add(opPut, key, value)
+}
+
+func (b *Batch) Delete(key string) {
+	b.add(opDelete, key, nil)
+}
+
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+func (b *Batch) add(op byte, key string, value []byte) {
+	var head [9]byte
+	head[0] = op
+	binary.BigEndian.PutUint32(head[1:5], uint32(len(key)))
+	binary.BigEndian.PutUint32(head[5:9], uint32(len(value)))
+	b.buf.Write(head[:])
+	b.buf.WriteString(key)
+	offset := -1
+	if op == opPut {
+		offset = b.buf.Len()
+	}
+	b.buf.Write(value)
+	b.ops = append(b.ops, batchOp{key: key, offset: offset, size: len(value)})
+}
+
+// Open opens the store file creating it if needed,
+// the torn last batch of the interrupted write is dropped, any other damage is an error
+func Open(path string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("kv: can't open %s: %+v", path, err)
+	}
+	s := &Store{
+		path: path,
+		file: file,
+		keys: make(map[string]position),
+	}
+	if err := s.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the value of the key
+func (s *Store) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos, ok := s.keys[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	value := make([]byte, pos.size)
+	if _, err := s.file.ReadAt(value, pos.offset); err != nil {
+		return nil, fmt.Errorf("kv: can't read %s: %+v", key, err)
+	}
+	return value, nil
+}
+
+// Keys returns the keys with the prefix in the ascending order
+func (s *Store) Keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Write appends the batch to the file and syncs it to the disk
+func (s *Store) Write(batch *Batch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(s.file, batch)
+}
+
+// Compact rewrites the file keeping only the current values,
+// the file is replaced via temp file and rename
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	batch := &Batch{}
+	for _, key := range keys {
+		pos := s.keys[key]
+		value := make([]byte, pos.size)
+		if _, err := s.file.ReadAt(value, pos.offset); err != nil {
+			return fmt.Errorf("kv: can't read %s: %+v", key, err)
+		}
+		batch.Put(key, value)
+	}
+
+	tmp := s.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("kv: can't create %s: %+v", tmp, err)
+	}
+	compacted := &Store{path: s.path, file: file, keys: make(map[string]position)}
+	if batch.Len() > 0 {
+		if err := compacted.write(file, batch); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		file.Close()
+		return fmt.Errorf("kv: can't rename %s: %+v", tmp, err)
+	}
+	// NOTE: the rename is durable after the directory sync
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	s.file.Close()
+	s.file, s.size, s.keys = compacted.file, compacted.size, compacted.keys
+	return nil
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// NOTE: not thread safe
+func (s *Store) write(file *os.File, batch *Batch) error {
+	data := batch.buf.Bytes()
+	var head [headerSize]byte
+	binary.BigEndian.PutUint32(head[0:4], crc32.ChecksumIEEE(data))
+	binary.BigEndian.PutUint32(head[4:8], uint32(len(data)))
+	if _, err := file.WriteAt(append(head[:], data...), s.size); err != nil {
+		return fmt.Errorf("kv: can't write batch: %+v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("kv: can't sync batch: %+v", err)
+	}
+	s.apply(batch.ops, s.size+int64(headerSize))
+	s.size += int64(headerSize + len(data))
+	return nil
+}
+
+// NOTE: not thread safe
+func (s *Store) apply(ops []batchOp, offset int64) {
+	for _, op := range ops {
+		if op.offset < 0 {
+			delete(s.keys, op.key)
+			continue
+		}
+		s.keys[op.key] = position{offset: offset + int64(op.offset), size: op.size}
+	}
+}
+
+// NOTE: not thread safe
+func (s *Store) load() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("kv: can't stat %s: %+v", s.path, err)
+	}
+	for n := 1; s.size < info.Size(); n++ {
+		var head [headerSize]byte
+		if _, err := s.file.ReadAt(head[:], s.size); err != nil {
+			return s.dropTorn(n, err)
+		}
+		data := make([]byte, binary.BigEndian.Uint32(head[4:8]))
+		if _, err := s.file.ReadAt(data, s.size+int64(headerSize)); err != nil {
+			return s.dropTorn(n, err)
+		}
+		if binary.BigEndian.Uint32(head[0:4]) != crc32.ChecksumIEEE(data) {
+			return fmt.Errorf("kv: corrupted batch %d in %s: checksum mismatch", n, s.path)
+		}
+		ops, err := parseBatch(data)
+		if err != nil {
+			return fmt.Errorf("kv: corrupted batch %d in %s: %+v", n, s.path, err)
+		}
+		s.apply(ops, s.size+int64(headerSize))
+		s.size += int64(headerSize + len(data))
+	}
+	return nil
+}
+
+// dropTorn truncates the incomplete last batch
+// NOTE: not thread safe
+func (s *Store) dropTorn(n int, err error) error {
+	if err != io.EOF {
+		return fmt.Errorf("kv: can't read batch %d in %s: %+v", n, s.path, err)
+	}
+	fmt.Printf("ERROR: kv: dropping torn batch %d in %s\n", n, s.path)
+	if err := s.file.Truncate(s.size); err != nil {
+		return fmt.Errorf("kv: can't truncate torn batch in %s: %+v", s.path, err)
+	}
+	return nil
+}
+
+func parseBatch(data []byte) ([]batchOp, error) {
+	var ops []batchOp
+	for i := 0; i < len(data); {
+		if len(data)-i < 9 {
+			return nil, fmt.Errorf("short op header")
+		}
+		op := data[i]
+		keySize := int(binary.BigEndian.Uint32(data[i+1 : i+5]))
+		valueSize := int(binary.BigEndian.Uint32(data[i+5 : i+9]))
+		i += 9
+		if keySize < 0 || valueSize < 0 || len(data)-i < keySize+valueSize {
+			return nil, fmt.Errorf("short op data")
+		}
+		key := string(data[i : i+keySize])
+		i += keySize
+		switch op {
+		case opPut:
+			ops = append(ops, batchOp{key: key, offset: i, size: valueSize})
+		case opDelete:
+			ops = append(ops, batchOp{key: key, offset: -1})
+		default:
+			return nil, fmt.Errorf("unknown op %d", op)
+		}
+		i += valueSize
+	}
+	return ops, nil
+}
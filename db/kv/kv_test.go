@@ -0,0 +1,129 @@
+package kv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openTest(t *testing.T, path string) *Store {
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("can't open store: %+v", err)
+	}
+	return s
+}
+
+func checkValues(t *testing.T, s *Store, want map[string]string) {
+	keys := s.Keys("")
+	if len(keys) != len(want) {
+		t.Errorf("invalid keys: want %v, got %v", want, keys)
+	}
+	for key, value := range want {
+		got, err := s.Get(key)
+		if err != nil || string(got) != value {
+			t.Errorf("invalid key %s value: want %s, got %s: %+v", key, value, got, err)
+		}
+	}
+}
+
+// fill writes two batches, the second one overwrites and deletes the keys of the first
+func fill(t *testing.T, s *Store) {
+	batch := &Batch{}
+	batch.Put("a/1", []byte("one"))
+	batch.Put("a/2", []byte("two"))
+	batch.Put("b/1", []byte("three"))
+	if err := s.Write(batch); err != nil {
+		t.Fatalf("can't write batch: %+v", err)
+	}
+	batch = &Batch{}
+	batch.Put("a/1", []byte("four"))
+	batch.Delete("a/2")
+	if err := s.Write(batch); err != nil {
+		t.Fatalf("can't write batch: %+v", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	s := openTest(t, path)
+	fill(t, s)
+	want := map[string]string{"a/1": "four", "b/1": "three"}
+	checkValues(t, s, want)
+	if _, err := s.Get("a/2"); err != ErrNotFound {
+		t.Errorf("invalid deleted key error: %+v", err)
+	}
+	if keys := s.Keys("a/"); !reflect.DeepEqual(keys, []string{"a/1"}) {
+		t.Errorf("invalid prefix keys: %v", keys)
+	}
+	s.Close()
+
+	s = openTest(t, path)
+	checkValues(t, s, want)
+	before, _ := os.Stat(path)
+	if err := s.Compact(); err != nil {
+		t.Fatalf("can't compact: %+v", err)
+	}
+	if after, _ := os.Stat(path); after.Size() >= before.Size() {
+		t.Errorf("store not compacted: %d bytes, was %d", after.Size(), before.Size())
+	}
+	checkValues(t, s, want)
+	// the writes after the compaction are appended to the new file
+	batch := &Batch{}
+	batch.Put("c/1", []byte("five"))
+	if err := s.Write(batch); err != nil {
+		t.Fatalf("can't write batch: %+v", err)
+	}
+	s.Close()
+
+	want["c/1"] = "five"
+	s = openTest(t, path)
+	defer s.Close()
+	checkValues(t, s, want)
+}
+
+func TestStoreTorn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	s := openTest(t, path)
+	fill(t, s)
+	s.Close()
+	info, _ := os.Stat(path)
+
+	// the last batch is written partially
+	if err := os.Truncate(path, info.Size()-2); err != nil {
+		t.Fatalf("can't truncate: %+v", err)
+	}
+	s = openTest(t, path)
+	checkValues(t, s, map[string]string{"a/1": "one", "a/2": "two", "b/1": "three"})
+	batch := &Batch{}
+	batch.Delete("b/1")
+	if err := s.Write(batch); err != nil {
+		t.Fatalf("can't write batch: %+v", err)
+	}
+	s.Close()
+
+	s = openTest(t, path)
+	defer s.Close()
+	checkValues(t, s, map[string]string{"a/1": "one", "a/2": "two"})
+}
+
+func TestStoreCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	s := openTest(t, path)
+	fill(t, s)
+	s.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("can't read store: %+v", err)
+	}
+	b[headerSize+1] ^= 1
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("can't write store: %+v", err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Errorf("corrupted store opened")
+	}
+}
@@ -0,0 +1,265 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cnaize/lifland/db/kv"
+)
+
+const (
+	kvFileName string = "dump.kv"
+	// the key of the store version, see DumpVersion
+	kvVersionKey string = "version"
+)
+
+// kvFields are the dump keys of the record kinds, see DB
+var kvFields = map[string]string{
+	kindPlayer:     "players",
+	kindTournament: "tournaments",
+	kindResponse:   "responses",
+	kindTemplate:   "templates",
+	kindSeries:     "series",
+	kindTicket:     "tickets",
+	kindFunds:      "funds",
+	kindDeadFunds:  "deadFunds",
+}
+
+// kvStorage keeps every db object under its own key in the embedded key-value store,
+// the ledger entries keys are padded to load them in order
+type kvStorage struct {
+	path  string
+	store *kv.Store
+	// whether the store has the version key
+	versioned bool
+}
+
+func newKVStorage(dir string) *kvStorage {
+	return &kvStorage{
+		path: filepath.Join(dir, kvFileName),
+	}
+}
+
+// load restores the objects, the store of the older version is migrated and rewritten, see migrations
+// NOTE: the store without the version key was written before the versions, it's the version 0
+func (s *kvStorage) load(db *DB) (int, bool, error) {
+	if err := s.open(); err != nil {
+		return 0, false, err
+	}
+	keys := s.store.Keys("")
+	if len(keys) == 0 {
+		return DumpVersion, false, nil
+	}
+	var version int
+	if data, err := s.store.Get(kvVersionKey); err == nil {
+		if version, err = strconv.Atoi(string(data)); err != nil {
+			return 0, false, fmt.Errorf("invalid version %q", data)
+		}
+	} else if err != kv.ErrNotFound {
+		return 0, false, err
+	}
+	if version > DumpVersion {
+		return 0, false, fmt.Errorf("store version %d is newer than supported version %d", version, DumpVersion)
+	}
+	if version < DumpVersion {
+		if err := s.migrate(db, keys, version); err != nil {
+			return 0, false, fmt.Errorf("can't migrate store version %d: %+v", version, err)
+		}
+		return version, true, nil
+	}
+
+	for _, key := range keys {
+		if key == kvVersionKey {
+			continue
+		}
+		data, err := s.store.Get(key)
+		if err != nil {
+			return 0, false, err
+		}
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) != 2 {
+			return 0, false, fmt.Errorf("invalid key %q", key)
+		}
+		if err := db.apply(record{Kind: parts[0], Id: parts[1], Data: data}); err != nil {
+			return 0, false, fmt.Errorf("can't apply key %q: %+v", key, err)
+		}
+	}
+	s.versioned = true
+	return version, true, nil
+}
+
+// migrate restores the db from the dump assembled of the keys, see kvFields,
+// and replaces the keys with the migrated objects
+func (s *kvStorage) migrate(db *DB, keys []string, version int) error {
+	dump := make(map[string]json.RawMessage)
+	objects := make(map[string]map[string]json.RawMessage)
+	var ledger []json.RawMessage
+	for _, key := range keys {
+		if key == kvVersionKey {
+			continue
+		}
+		data, err := s.store.Get(key)
+		if err != nil {
+			return err
+		}
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid key %q", key)
+		}
+		kind, id := parts[0], parts[1]
+		switch kind {
+		case kindEntry:
+			// NOTE: the padded keys are in the ledger order
+			ledger = append(ledger, data)
+		case kindFunds, kindDeadFunds:
+			dump[kvFields[kind]] = data
+		case kindMeta:
+			var meta map[string]json.RawMessage
+			if err := json.Unmarshal(data, &meta); err != nil {
+				return fmt.Errorf("invalid key %q: %+v", key, err)
+			}
+			for field, value := range meta {
+				dump[field] = value
+			}
+		default:
+			field, ok := kvFields[kind]
+			if !ok {
+				return fmt.Errorf("unknown record kind %q", kind)
+			}
+			if objects[field] == nil {
+				objects[field] = make(map[string]json.RawMessage)
+			}
+			objects[field][id] = data
+		}
+	}
+	for field, values := range objects {
+		data, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		dump[field] = data
+	}
+	if len(ledger) > 0 {
+		data, err := json.Marshal(ledger)
+		if err != nil {
+			return err
+		}
+		dump["ledger"] = data
+	}
+	data, err := json.Marshal(dump)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(dumpEnvelope{Version: version, DB: data})
+	if err != nil {
+		return err
+	}
+	if _, err := unmarshalDump(b, db); err != nil {
+		return err
+	}
+
+	db.touchAll()
+	records, err := db.changes()
+	if err != nil {
+		return err
+	}
+	batch := &kv.Batch{}
+	for _, key := range keys {
+		batch.Delete(key)
+	}
+	if err := s.add(batch, records); err != nil {
+		return err
+	}
+	batch.Put(kvVersionKey, []byte(strconv.Itoa(DumpVersion)))
+	if err := s.store.Write(batch); err != nil {
+		return err
+	}
+	s.versioned = true
+	return nil
+}
+
+// save writes the records as one batch, the first batch of the new store writes the version
+func (s *kvStorage) save(records []record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	batch := &kv.Batch{}
+	if err := s.add(batch, records); err != nil {
+		return err
+	}
+	if !s.versioned {
+		batch.Put(kvVersionKey, []byte(strconv.Itoa(DumpVersion)))
+	}
+	if err := s.store.Write(batch); err != nil {
+		return err
+	}
+	s.versioned = true
+	return nil
+}
+
+// add puts the records to the batch
+func (s *kvStorage) add(batch *kv.Batch, records []record) error {
+	for _, record := range records {
+		key := record.Kind + "/" + record.Id
+		if record.Kind == kindEntry {
+			id, err := strconv.Atoi(record.Id)
+			if err != nil {
+				return fmt.Errorf("invalid entry id %s", record.Id)
+			}
+			key = fmt.Sprintf("%s/%012d", kindEntry, id)
+		}
+		if record.Data == nil {
+			batch.Delete(key)
+			continue
+		}
+		batch.Put(key, record.Data)
+	}
+	return nil
+}
+
+func (s *kvStorage) compact(db *DB, records []record) error {
+	if err := s.save(records); err != nil {
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	return s.store.Compact()
+}
+
+func (s *kvStorage) clear() error {
+	s.close()
+	s.versioned = false
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("can't remove %s: %+v", s.path, err)
+	}
+	return nil
+}
+
+func (s *kvStorage) close() error {
+	if s.store == nil {
+		return nil
+	}
+	err := s.store.Close()
+	s.store = nil
+	return err
+}
+
+func (s *kvStorage) open() error {
+	if s.store != nil {
+		return nil
+	}
+	store, err := kv.Open(s.path)
+	if err != nil {
+		return err
+	}
+	s.store = store
+	return nil
+}
@@ -0,0 +1,232 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cnaize/lifland/model"
+)
+
+// DumpVersion is the dump schema version written by this build, see migrations
+const DumpVersion int = 2
+
+// dumpEnvelope is the versioned dump, the dumps made before the envelope are the version 0
+type dumpEnvelope struct {
+	Version int             `json:"version"`
+	DB      json.RawMessage `json:"db"`
+}
+
+// migration upgrades the dump objects to the version from the previous one
+type migration struct {
+	version int
+	name    string
+	migrate func(dump map[string]json.RawMessage) error
+}
+
+// migrations are applied in order, the model change breaking the dumps appends the next version
+// NOTE: the version 0 dumps were made by any build before the envelope, so the migrations check the objects shape
+var migrations = []migration{
+	{version: 1, name: "pending funds", migrate: migrateFunds},
+	{version: 2, name: "tournament states", migrate: migrateTournamentStates},
+}
+
+// MigrateDump upgrades the dump to DumpVersion, returns the versioned dump and the version it had
+func MigrateDump(b []byte) ([]byte, int, error) {
+	data, version, err := migrateDump(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	dump, err := json.Marshal(dumpEnvelope{Version: DumpVersion, DB: data})
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't marshal dump: %+v", err)
+	}
+	return dump, version, nil
+}
+
+// MigrateFile upgrades the dump file offline and writes it to the out file, returns the version it had,
+// nothing is written for the dump of the current version
+// NOTE: the dump with the non-empty log next to it is refused, the log records aren't in the dump,
+// the restore compacts the log into the dump
+func MigrateFile(in, out string) (int, error) {
+	wal := filepath.Join(filepath.Dir(in), walFileName)
+	if info, err := os.Stat(wal); err == nil && info.Size() > 0 {
+		return 0, fmt.Errorf("MigrateFile: wal %s isn't compacted into the dump, restore the db first", wal)
+	} else if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("MigrateFile: can't stat wal: %+v", err)
+	}
+	b, err := ioutil.ReadFile(in)
+	if err != nil {
+		return 0, fmt.Errorf("MigrateFile: can't read dump: %+v", err)
+	}
+	dump, version, err := MigrateDump(b)
+	if err != nil {
+		return 0, fmt.Errorf("MigrateFile: %+v", err)
+	}
+	if version == DumpVersion && in == out {
+		return version, nil
+	}
+	if err := writeFileAtomic(out, dump); err != nil {
+		return 0, fmt.Errorf("MigrateFile: %+v", err)
+	}
+	return version, nil
+}
+
+// migrateDump returns the db objects of the dump upgraded to DumpVersion and the version the dump had
+func migrateDump(b []byte) (json.RawMessage, int, error) {
+	var dump map[string]json.RawMessage
+	if err := json.Unmarshal(b, &dump); err != nil {
+		return nil, 0, fmt.Errorf("can't unmarshal dump: %+v", err)
+	}
+	var version int
+	// NOTE: the db has no version field, so the dump with it is the envelope
+	if _, ok := dump["version"]; ok {
+		var envelope dumpEnvelope
+		if err := json.Unmarshal(b, &envelope); err != nil {
+			return nil, 0, fmt.Errorf("can't unmarshal dump envelope: %+v", err)
+		}
+		if envelope.Version > DumpVersion {
+			return nil, 0, fmt.Errorf("dump version %d is newer than supported version %d", envelope.Version, DumpVersion)
+		}
+		if envelope.Version == DumpVersion {
+			return envelope.DB, envelope.Version, nil
+		}
+		dump = nil
+		if err := json.Unmarshal(envelope.DB, &dump); err != nil {
+			return nil, 0, fmt.Errorf("can't unmarshal dump version %d: %+v", envelope.Version, err)
+		}
+		version = envelope.Version
+	}
+	if dump == nil {
+		dump = make(map[string]json.RawMessage)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err := m.migrate(dump); err != nil {
+			return nil, 0, fmt.Errorf("can't migrate dump to version %d (%s): %+v", m.version, m.name, err)
+		}
+		fmt.Printf("dump migrated to version %d: %s\n", m.version, m.name)
+	}
+	data, err := json.Marshal(dump)
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't marshal migrated dump: %+v", err)
+	}
+	return data, version, nil
+}
+
+// marshalDump returns the versioned dump of the db
+// NOTE: not thread safe
+func marshalDump(db *DB) ([]byte, error) {
+	data, err := json.Marshal(db)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(dumpEnvelope{Version: DumpVersion, DB: data})
+}
+
+// unmarshalDump restores the db from the dump of any version, returns the version the dump had
+// NOTE: not thread safe
+func unmarshalDump(b []byte, db *DB) (int, error) {
+	data, version, err := migrateDump(b)
+	if err != nil {
+		return 0, err
+	}
+	return version, json.Unmarshal(data, db)
+}
+
+// migrateFunds moves the funds from the misspelled "Funds" key,
+// the bare funds of the dumps made before the pending funds are wrapped without the tournament
+func migrateFunds(dump map[string]json.RawMessage) error {
+	if funds, ok := dump["Funds"]; ok {
+		delete(dump, "Funds")
+		if _, ok := dump["funds"]; !ok {
+			dump["funds"] = funds
+		}
+	}
+	var funds []map[string]json.RawMessage
+	if err := unmarshalField(dump, "funds", &funds); err != nil || funds == nil {
+		return err
+	}
+	for i, fund := range funds {
+		if _, ok := fund["fund"]; ok {
+			continue
+		}
+		bare, err := json.Marshal(fund)
+		if err != nil {
+			return err
+		}
+		funds[i] = map[string]json.RawMessage{
+			"tournamentId": json.RawMessage("0"),
+			"fund":         bare,
+		}
+	}
+	return marshalField(dump, "funds", funds)
+}
+
+// migrateTournamentStates replaces the open and cancelled flags of the dumps made before the tournament states,
+// the closed tournament is finished
+func migrateTournamentStates(dump map[string]json.RawMessage) error {
+	var tournaments map[string]map[string]json.RawMessage
+	if err := unmarshalField(dump, "tournaments", &tournaments); err != nil || tournaments == nil {
+		return err
+	}
+	for id, tournament := range tournaments {
+		if _, ok := tournament["state"]; ok {
+			continue
+		}
+		var open, cancelled bool
+		if err := unmarshalField(tournament, "open", &open); err != nil {
+			return fmt.Errorf("tournament %s: %+v", id, err)
+		}
+		if err := unmarshalField(tournament, "cancelled", &cancelled); err != nil {
+			return fmt.Errorf("tournament %s: %+v", id, err)
+		}
+		state := model.StateFinished
+		switch {
+		case open:
+			state = model.StateRegistration
+		case cancelled:
+			state = model.StateCancelled
+		}
+		var startTime time.Time
+		if err := unmarshalField(tournament, "startTime", &startTime); err != nil {
+			return fmt.Errorf("tournament %s: %+v", id, err)
+		}
+		delete(tournament, "open")
+		delete(tournament, "cancelled")
+		if err := marshalField(tournament, "state", state); err != nil {
+			return err
+		}
+		if err := marshalField(tournament, "stateTimes", map[model.TournamentState]time.Time{state: startTime}); err != nil {
+			return err
+		}
+	}
+	return marshalField(dump, "tournaments", tournaments)
+}
+
+// unmarshalField leaves v unchanged if the object has no such field
+func unmarshalField(object map[string]json.RawMessage, key string, v interface{}) error {
+	data, ok := object[key]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("can't unmarshal %s: %+v", key, err)
+	}
+	return nil
+}
+
+func marshalField(object map[string]json.RawMessage, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("can't marshal %s: %+v", key, err)
+	}
+	object[key] = data
+	return nil
+}
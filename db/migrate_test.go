@@ -0,0 +1,294 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cnaize/lifland/db/kv"
+	"github.com/cnaize/lifland/model"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// dumpTests are the dumps of every historical format, the migrated dumps are in the golden files
+var dumpTests = []struct {
+	name        string
+	wantVersion int
+	wantStates  map[int]model.TournamentState
+	wantFunds   int
+}{
+	// float64 points, open flags and bare funds under the misspelled key
+	{"baseline", 0, map[int]model.TournamentState{1: model.StateRegistration, 2: model.StateFinished}, 1},
+	// the ledger, the pending funds and the cancelled flag
+	{"ledger", 0, map[int]model.TournamentState{1: model.StateRegistration, 2: model.StateCancelled}, 1},
+	{"states", 0, map[int]model.TournamentState{1: model.StateRunning}, 1},
+	{"wal", 0, map[int]model.TournamentState{1: model.StateRegistration}, 1},
+	// the funds with ids under the fixed key
+	{"funds", 0, map[int]model.TournamentState{1: model.StateRegistration}, 1},
+	{"current", DumpVersion, map[int]model.TournamentState{1: model.StateRegistration}, 1},
+}
+
+func readDump(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "dumps", name))
+	if err != nil {
+		t.Fatalf("can't read dump: %+v", err)
+	}
+	return b
+}
+
+func TestMigrateGolden(t *testing.T) {
+	for _, test := range dumpTests {
+		t.Run(test.name, func(t *testing.T) {
+			dump, version, err := MigrateDump(readDump(t, test.name+".json"))
+			if err != nil {
+				t.Fatalf("can't migrate dump: %+v", err)
+			}
+			if version != test.wantVersion {
+				t.Errorf("invalid dump version: want %d, got %d", test.wantVersion, version)
+			}
+			var got bytes.Buffer
+			if err := json.Indent(&got, dump, "", "  "); err != nil {
+				t.Fatalf("can't indent dump: %+v", err)
+			}
+			got.WriteString("\n")
+
+			golden := filepath.Join("testdata", "dumps", test.name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatalf("can't write golden file: %+v", err)
+				}
+			}
+			if want := readDump(t, test.name+".golden"); !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("invalid migrated dump:\n%s\nwant:\n%s", got.Bytes(), want)
+			}
+			// the migrated dump is current
+			again, version, err := MigrateDump(dump)
+			if err != nil || version != DumpVersion || !bytes.Equal(again, dump) {
+				t.Errorf("migrated dump changed by migration from version %d: %+v", version, err)
+			}
+		})
+	}
+}
+
+func TestRestoreMigrated(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range dumpTests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(dir, DumpFileName), readDump(t, test.name+".json"), 0644); err != nil {
+				t.Fatalf("can't write dump: %+v", err)
+			}
+			db := newDB(newFileStorage(dir))
+			if err := db.Restore(ctx); err != nil {
+				t.Fatalf("can't restore: %+v", err)
+			}
+			for id, want := range test.wantStates {
+				tournament, err := db.GetTournament(ctx, id)
+				if err != nil {
+					t.Fatalf("can't get tournament %d: %+v", id, err)
+				}
+				if tournament.GetState() != want {
+					t.Errorf("invalid tournament %d state: want %s, got %s", id, want, tournament.GetState())
+				}
+			}
+			if funds, _ := db.GetFunds(ctx); len(funds) != test.wantFunds || funds[0].Id == 0 {
+				t.Errorf("invalid funds: %+v", funds)
+			}
+			// NOTE: the restore compacts the dump to the current version
+			b, _ := ioutil.ReadFile(filepath.Join(dir, DumpFileName))
+			var envelope dumpEnvelope
+			if err := json.Unmarshal(b, &envelope); err != nil || envelope.Version != DumpVersion {
+				t.Errorf("invalid compacted dump version %d: %+v", envelope.Version, err)
+			}
+		})
+	}
+}
+
+func TestRestoreLedger(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		dump    string
+		wantErr bool
+	}{
+		// the pre-ledger dump is opened with the player balances
+		{"pre-ledger", `{"players":{"p1":{"id":"p1","balance":"10"}}}`, false},
+		// the versioned dump ledger is never opened, the balances must match it
+		{"empty ledger", `{"version":2,"db":{"players":{"p1":{"id":"p1","balance":"0"}}}}`, false},
+		{"unopened balance", `{"version":2,"db":{"players":{"p1":{"id":"p1","balance":"10"}}}}`, true},
+		{"mismatch", `{"version":2,"db":{"players":{"p1":{"id":"p1","balance":"10"}},"ledger":[` +
+			`{"type":"fund","postings":[{"account":"external","amount":"-5"},{"account":"player:p1","amount":"5","balance":"5"}]}]}}`, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(dir, DumpFileName), []byte(test.dump), 0644); err != nil {
+				t.Fatalf("can't write dump: %+v", err)
+			}
+			db := newDB(newFileStorage(dir))
+			db.SetDebug(true)
+			err := db.Restore(ctx)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("invalid restore error: want %t, got %+v", test.wantErr, err)
+			}
+			if err == nil {
+				player, err := db.GetPlayer(ctx, "p1")
+				if err != nil {
+					t.Fatalf("can't get player: %+v", err)
+				}
+				if got := db.balance(model.PlayerAccount("p1")); got != player.GetBalance() {
+					t.Errorf("invalid ledger balance: want %s, got %s", player.GetBalance(), got)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateTournamentStates(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantState model.TournamentState
+	}{
+		{`{"id": 1, "open": true}`, model.StateRegistration},
+		{`{"id": 1, "open": false}`, model.StateFinished},
+		{`{"id": 1, "open": false, "cancelled": true}`, model.StateCancelled},
+		{`{"id": 1, "state": "running", "stateTimes": {}}`, model.StateRunning},
+	}
+
+	for _, test := range tests {
+		dump, _, err := MigrateDump([]byte(`{"tournaments": {"1": ` + test.in + `}}`))
+		if err != nil {
+			t.Fatalf("can't migrate %s: %+v", test.in, err)
+		}
+		var envelope dumpEnvelope
+		json.Unmarshal(dump, &envelope)
+		var db DB
+		if err := json.Unmarshal(envelope.DB, &db); err != nil {
+			t.Fatalf("can't unmarshal %s: %+v", envelope.DB, err)
+		}
+		if state := db.Tournaments[1].GetState(); state != test.wantState {
+			t.Errorf("invalid state for %s: want %s, got %s", test.in, test.wantState, state)
+		}
+	}
+}
+
+func TestMigrateNewer(t *testing.T) {
+	dump := `{"version": 100, "db": {}}`
+	if _, _, err := MigrateDump([]byte(dump)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("invalid newer dump error: %+v", err)
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.db"), filepath.Join(dir, "out.db")
+	if err := ioutil.WriteFile(in, readDump(t, "baseline.json"), 0644); err != nil {
+		t.Fatalf("can't write dump: %+v", err)
+	}
+	if version, err := MigrateFile(in, out); err != nil || version != 0 {
+		t.Fatalf("can't migrate file from version %d: %+v", version, err)
+	}
+	b, _ := ioutil.ReadFile(out)
+	if version, err := MigrateFile(out, out); err != nil || version != DumpVersion {
+		t.Errorf("invalid migrated file version %d: %+v", version, err)
+	}
+	if again, _ := ioutil.ReadFile(out); !bytes.Equal(again, b) {
+		t.Errorf("current file rewritten")
+	}
+}
+
+func TestMigrateFileWal(t *testing.T) {
+	dir := t.TempDir()
+	in, wal := filepath.Join(dir, DumpFileName), filepath.Join(dir, walFileName)
+	if err := ioutil.WriteFile(in, readDump(t, "baseline.json"), 0644); err != nil {
+		t.Fatalf("can't write dump: %+v", err)
+	}
+	if err := ioutil.WriteFile(wal, []byte("record\n"), 0644); err != nil {
+		t.Fatalf("can't write log: %+v", err)
+	}
+	if _, err := MigrateFile(in, in); err == nil || !strings.Contains(err.Error(), "wal") {
+		t.Errorf("dump with the log migrated: %+v", err)
+	}
+	if b, _ := ioutil.ReadFile(in); !bytes.Equal(b, readDump(t, "baseline.json")) {
+		t.Errorf("dump with the log rewritten")
+	}
+	// the compacted log is empty
+	if err := ioutil.WriteFile(wal, nil, 0644); err != nil {
+		t.Fatalf("can't truncate log: %+v", err)
+	}
+	if version, err := MigrateFile(in, in); err != nil || version != 0 {
+		t.Errorf("can't migrate dump with the compacted log from version %d: %+v", version, err)
+	}
+}
+
+func TestRestoreKVMigrated(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	// NOTE: the store written before the versions has no version key
+	store, err := kv.Open(filepath.Join(dir, kvFileName))
+	if err != nil {
+		t.Fatalf("can't open store: %+v", err)
+	}
+	batch := &kv.Batch{}
+	for key, value := range map[string]string{
+		"player/p1":    `{"id":"p1","balance":"90"}`,
+		"tournament/1": `{"id":1,"deposit":"10","startTime":"2017-07-01T10:00:00Z","open":true,"funds":{"p1":{"p1":"-10"}}}`,
+		"tournament/2": `{"id":2,"deposit":"10","startTime":"2017-06-01T10:00:00Z","open":false,"funds":{},` +
+			`"cancelled":true,"cancelReason":"no players"}`,
+		"funds/": `[{"tournamentId":1,"fund":{"p2":"5"}}]`,
+		"entry/000000000001": `{"id":1,"type":"opening","postings":[{"account":"external","amount":"-100"},` +
+			`{"account":"player:p1","amount":"100","balance":"100"}]}`,
+		"entry/000000000002": `{"id":2,"type":"join","tournamentId":1,"postings":[{"account":"player:p1","amount":"-10","balance":"90"},` +
+			`{"account":"tournament:1","amount":"10"}]}`,
+		"meta/": `{"lastTournamentId":2}`,
+	} {
+		batch.Put(key, []byte(value))
+	}
+	if err := store.Write(batch); err != nil {
+		t.Fatalf("can't write store: %+v", err)
+	}
+	store.Close()
+
+	for i := 0; i < 2; i++ {
+		db := newDB(newKVStorage(dir))
+		if err := db.Restore(ctx); err != nil {
+			t.Fatalf("can't restore %d: %+v", i, err)
+		}
+		for id, want := range map[int]model.TournamentState{1: model.StateRegistration, 2: model.StateCancelled} {
+			tournament, err := db.GetTournament(ctx, id)
+			if err != nil {
+				t.Fatalf("can't get tournament %d: %+v", id, err)
+			}
+			if tournament.GetState() != want {
+				t.Errorf("invalid tournament %d state: want %s, got %s", id, want, tournament.GetState())
+			}
+		}
+		if funds, _ := db.GetFunds(ctx); len(funds) != 1 || funds[0].Id == 0 {
+			t.Errorf("invalid funds: %+v", funds)
+		}
+		if len(db.Ledger) != 2 || db.LastTournamentId != 2 {
+			t.Errorf("invalid ledger of %d entries or last tournament id %d", len(db.Ledger), db.LastTournamentId)
+		}
+		db.Close()
+	}
+
+	// the migrated objects are rewritten with the version
+	store, err = kv.Open(filepath.Join(dir, kvFileName))
+	if err != nil {
+		t.Fatalf("can't open store: %+v", err)
+	}
+	defer store.Close()
+	if version, err := store.Get(kvVersionKey); err != nil || string(version) != strconv.Itoa(DumpVersion) {
+		t.Errorf("invalid store version %s: %+v", version, err)
+	}
+	if tournament, _ := store.Get("tournament/1"); bytes.Contains(tournament, []byte(`"open"`)) {
+		t.Errorf("tournament not migrated: %s", tournament)
+	}
+}
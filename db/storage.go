@@ -0,0 +1,309 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cnaize/lifland/model"
+)
+
+const (
+	kindPlayer     string = "player"
+	kindTournament string = "tournament"
+	kindResponse   string = "response"
+	kindTemplate   string = "template"
+	kindSeries     string = "series"
+	kindTicket     string = "ticket"
+	kindEntry      string = "entry"
+	kindFunds      string = "funds"
+	kindDeadFunds  string = "deadFunds"
+	kindMeta       string = "meta"
+)
+
+// storage persists the db objects, see fileStorage and kvStorage
+type storage interface {
+	// load restores the persisted objects into the db, returns their version, see DumpVersion,
+	// and reports whether anything was persisted
+	load(db *DB) (int, bool, error)
+	// save persists the changed objects, all or nothing
+	save(records []record) error
+	// compact persists the changed objects and drops the history of the changes
+	compact(db *DB, records []record) error
+	// clear removes all the persisted data
+	clear() error
+	close() error
+}
+
+// record is the state of the changed object, the deleted object has no data
+type record struct {
+	Seq  uint64          `json:"seq"`
+	Kind string          `json:"kind"`
+	Id   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// metaData are the db counters
+type metaData struct {
+	LastTournamentId int `json:"lastTournamentId,omitempty"`
+	LastTicketId     int `json:"lastTicketId,omitempty"`
+	LastFundId       int `json:"lastFundId,omitempty"`
+}
+
+// changes returns the records of the objects changed since the last persisted state
+// NOTE: not thread safe
+func (db *DB) changes() ([]record, error) {
+	db.dmu.Lock()
+	keys := make([]string, 0, len(db.dirty))
+	for key := range db.dirty {
+		keys = append(keys, key)
+	}
+	db.dmu.Unlock()
+	sort.Strings(keys)
+
+	var records []record
+	for _, key := range keys {
+		parts := strings.SplitN(key, "/", 2)
+		kind, id := parts[0], parts[1]
+		v, ok, err := db.object(kind, id)
+		if err != nil {
+			return nil, fmt.Errorf("can't get %s %s: %+v", kind, id, err)
+		}
+		if !ok {
+			records = append(records, record{Kind: kind, Id: id})
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("can't marshal %s %s: %+v", kind, id, err)
+		}
+		records = append(records, record{Kind: kind, Id: id, Data: data})
+	}
+	// NOTE: the ledger is append only
+	for _, entry := range db.Ledger[db.loggedEntries:] {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("can't marshal entry %d: %+v", entry.GetId(), err)
+		}
+		records = append(records, record{Kind: kindEntry, Id: strconv.Itoa(entry.GetId()), Data: data})
+	}
+	return records, nil
+}
+
+// object returns the current object by the record kind and id, reports whether it exists
+// NOTE: not thread safe
+func (db *DB) object(kind, id string) (interface{}, bool, error) {
+	switch kind {
+	case kindPlayer:
+		player, ok := db.Players[id]
+		return player, ok, nil
+	case kindTournament:
+		tid, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, false, err
+		}
+		tournament, ok := db.Tournaments[tid]
+		return tournament, ok, nil
+	case kindResponse:
+		resp, ok := db.Responses[id]
+		return resp, ok, nil
+	case kindTemplate:
+		template, ok := db.Templates[id]
+		return template, ok, nil
+	case kindSeries:
+		series, ok := db.Series[id]
+		return series, ok, nil
+	case kindTicket:
+		tid, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, false, err
+		}
+		ticket, ok := db.Tickets[tid]
+		return ticket, ok, nil
+	case kindFunds:
+		return db.Funds, true, nil
+	case kindDeadFunds:
+		return db.DeadFunds, true, nil
+	case kindMeta:
+		return metaData{LastTournamentId: db.LastTournamentId, LastTicketId: db.LastTicketId, LastFundId: db.LastFundId}, true, nil
+	}
+	return nil, false, fmt.Errorf("unknown record kind %q", kind)
+}
+
+// touch marks the object changed since the last dump
+func (db *DB) touch(kind, id string) {
+	db.dmu.Lock()
+	defer db.dmu.Unlock()
+
+	if db.dirty == nil {
+		db.dirty = make(map[string]bool)
+	}
+	db.dirty[kind+"/"+id] = true
+}
+
+// markLogged forgets the changes of the persisted records
+// NOTE: not thread safe
+func (db *DB) markLogged(records []record) {
+	db.dmu.Lock()
+	defer db.dmu.Unlock()
+
+	for _, record := range records {
+		if record.Kind == kindEntry {
+			db.loggedEntries++
+			continue
+		}
+		delete(db.dirty, record.Kind+"/"+record.Id)
+	}
+}
+
+// touchAll marks all the objects changed, e.g. to rewrite the migrated objects
+// NOTE: not thread safe
+func (db *DB) touchAll() {
+	for id := range db.Players {
+		db.touch(kindPlayer, id)
+	}
+	for id := range db.Tournaments {
+		db.touch(kindTournament, strconv.Itoa(id))
+	}
+	for key := range db.Responses {
+		db.touch(kindResponse, key)
+	}
+	for id := range db.Templates {
+		db.touch(kindTemplate, id)
+	}
+	for id := range db.Series {
+		db.touch(kindSeries, id)
+	}
+	for id := range db.Tickets {
+		db.touch(kindTicket, strconv.Itoa(id))
+	}
+	db.touch(kindFunds, "")
+	db.touch(kindDeadFunds, "")
+	db.touch(kindMeta, "")
+
+	db.dmu.Lock()
+	defer db.dmu.Unlock()
+	db.loggedEntries = 0
+}
+
+// markClean forgets all the changes, e.g. of the loaded objects
+// NOTE: not thread safe
+func (db *DB) markClean() {
+	db.dmu.Lock()
+	defer db.dmu.Unlock()
+
+	db.dirty = nil
+	db.loggedEntries = len(db.Ledger)
+}
+
+// apply sets the object state from the record
+// NOTE: not thread safe
+func (db *DB) apply(record record) error {
+	deleted := record.Data == nil
+	switch record.Kind {
+	case kindPlayer:
+		delete(db.Players, record.Id)
+		if !deleted {
+			var player model.Player
+			if err := json.Unmarshal(record.Data, &player); err != nil {
+				return err
+			}
+			db.Players[record.Id] = &player
+		}
+	case kindTournament:
+		id, err := strconv.Atoi(record.Id)
+		if err != nil {
+			return err
+		}
+		delete(db.Tournaments, id)
+		if !deleted {
+			var tournament model.Tournament
+			if err := json.Unmarshal(record.Data, &tournament); err != nil {
+				return err
+			}
+			db.Tournaments[id] = &tournament
+		}
+	case kindResponse:
+		delete(db.Responses, record.Id)
+		if !deleted {
+			var resp model.Response
+			if err := json.Unmarshal(record.Data, &resp); err != nil {
+				return err
+			}
+			db.Responses[record.Id] = &resp
+		}
+	case kindTemplate:
+		delete(db.Templates, record.Id)
+		if !deleted {
+			var template model.Template
+			if err := json.Unmarshal(record.Data, &template); err != nil {
+				return err
+			}
+			db.Templates[record.Id] = &template
+		}
+	case kindSeries:
+		delete(db.Series, record.Id)
+		if !deleted {
+			var series model.Series
+			if err := json.Unmarshal(record.Data, &series); err != nil {
+				return err
+			}
+			db.Series[record.Id] = &series
+		}
+	case kindTicket:
+		id, err := strconv.Atoi(record.Id)
+		if err != nil {
+			return err
+		}
+		delete(db.Tickets, id)
+		if !deleted {
+			var ticket model.Ticket
+			if err := json.Unmarshal(record.Data, &ticket); err != nil {
+				return err
+			}
+			db.Tickets[id] = &ticket
+		}
+	case kindFunds:
+		db.Funds = nil
+		if !deleted {
+			if err := json.Unmarshal(record.Data, &db.Funds); err != nil {
+				return err
+			}
+		}
+	case kindDeadFunds:
+		db.DeadFunds = nil
+		if !deleted {
+			if err := json.Unmarshal(record.Data, &db.DeadFunds); err != nil {
+				return err
+			}
+		}
+	case kindMeta:
+		var meta metaData
+		if !deleted {
+			if err := json.Unmarshal(record.Data, &meta); err != nil {
+				return err
+			}
+		}
+		db.LastTournamentId = meta.LastTournamentId
+		db.LastTicketId = meta.LastTicketId
+		db.LastFundId = meta.LastFundId
+	case kindEntry:
+		var entry model.Entry
+		if err := json.Unmarshal(record.Data, &entry); err != nil {
+			return err
+		}
+		if entry.GetId() <= len(db.Ledger) {
+			// already in the snapshot
+			return nil
+		}
+		if entry.GetId() != len(db.Ledger)+1 {
+			return fmt.Errorf("entry %d doesn't follow ledger of %d entries", entry.GetId(), len(db.Ledger))
+		}
+		db.Ledger = append(db.Ledger, &entry)
+	default:
+		return fmt.Errorf("unknown record kind %q", record.Kind)
+	}
+	return nil
+}
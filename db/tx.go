@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/cnaize/lifland/model"
+)
+
+// tx stages the changes in memory, nothing is locked before the commit
+type tx struct {
+	db          *DB
+	entries     []*model.Entry
+	tournaments []tournamentUpdate
+	tickets     []ticketUpdate
+	series      []seriesUpdate
+	added       []*model.Ticket
+	settles     []settle
+	covered     []model.Account
+	done        bool
+}
+
+type tournamentUpdate struct {
+	id     int
+	update func(*model.Tournament) error
+}
+
+type ticketUpdate struct {
+	id     int
+	update func(*model.Ticket) error
+}
+
+type seriesUpdate struct {
+	id     string
+	update func(*model.Series) error
+}
+
+// settle moves the points left on the account to the other account
+type settle struct {
+	typ          model.EntryType
+	tournamentId int
+	from, to     model.Account
+}
+
+// Begin starts the transaction
+func (db *DB) Begin() Tx {
+	return &tx{db: db}
+}
+
+func (t *tx) Post(entry *model.Entry) {
+	t.entries = append(t.entries, entry)
+}
+
+func (t *tx) UpdateTournament(id int, update func(*model.Tournament) error) {
+	t.tournaments = append(t.tournaments, tournamentUpdate{id: id, update: update})
+}
+
+func (t *tx) UpdateTicket(id int, update func(*model.Ticket) error) {
+	t.tickets = append(t.tickets, ticketUpdate{id: id, update: update})
+}
+
+func (t *tx) UpdateSeries(id string, update func(*model.Series) error) {
+	t.series = append(t.series, seriesUpdate{id: id, update: update})
+}
+
+func (t *tx) AddTicket(ticket *model.Ticket) {
+	t.added = append(t.added, ticket)
+}
+
+func (t *tx) Settle(typ model.EntryType, tournamentId int, from, to model.Account) {
+	t.settles = append(t.settles, settle{typ: typ, tournamentId: tournamentId, from: from, to: to})
+}
+
+func (t *tx) Cover(account model.Account) {
+	t.covered = append(t.covered, account)
+}
+
+// Commit applies the staged changes, the first failed change is returned as is or wrapped
+func (t *tx) Commit(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if t.done {
+		return fmt.Errorf("Commit: transaction is done")
+	}
+	t.done = true
+
+	db := t.db
+	db.lmu.Lock()
+	defer db.lmu.Unlock()
+	db.pmu.Lock()
+	defer db.pmu.Unlock()
+	if len(t.tournaments) > 0 {
+		db.tmu.Lock()
+		defer db.tmu.Unlock()
+	}
+	if len(t.series) > 0 {
+		db.smu.Lock()
+		defer db.smu.Unlock()
+	}
+	if len(t.tickets) > 0 || len(t.added) > 0 {
+		db.kmu.Lock()
+		defer db.kmu.Unlock()
+	}
+
+	return db.commit(t)
+}
+
+func (t *tx) Rollback() {
+	t.done = true
+	t.entries, t.tournaments, t.tickets, t.series, t.added, t.settles, t.covered = nil, nil, nil, nil, nil, nil, nil
+}
+
+// commit runs the updates on the copies and checks the entries staged before and by them, then applies all of them
+// NOTE: not thread safe, the ledger, the players and the updated objects should be locked
+func (db *DB) commit(t *tx) error {
+	tournaments := make(map[int]*model.Tournament)
+	for _, u := range t.tournaments {
+		tournament, ok := tournaments[u.id]
+		if !ok {
+			current, ok := db.Tournaments[u.id]
+			if !ok {
+				return fmt.Errorf("tournament %d %w", u.id, ErrNotFound)
+			}
+			tournament = current.Clone()
+		}
+		if err := u.update(tournament); err != nil {
+			return err
+		}
+		tournaments[u.id] = tournament
+	}
+	tickets := make(map[int]*model.Ticket)
+	for _, u := range t.tickets {
+		ticket, ok := tickets[u.id]
+		if !ok {
+			current, ok := db.Tickets[u.id]
+			if !ok {
+				return fmt.Errorf("ticket %d %w", u.id, ErrNotFound)
+			}
+			ticket = current.Clone()
+		}
+		if err := u.update(ticket); err != nil {
+			return err
+		}
+		tickets[u.id] = ticket
+	}
+	series := make(map[string]*model.Series)
+	for _, u := range t.series {
+		s, ok := series[u.id]
+		if !ok {
+			current, ok := db.Series[u.id]
+			if !ok {
+				return fmt.Errorf("series %s %w", u.id, ErrNotFound)
+			}
+			s = current.Clone()
+		}
+		if err := u.update(s); err != nil {
+			return err
+		}
+		series[u.id] = s
+	}
+	for _, ticket := range t.added {
+		if ticket == nil {
+			return fmt.Errorf("ticket is nil")
+		}
+	}
+	for _, s := range t.settles {
+		points := db.balance(s.from)
+		for _, entry := range t.entries {
+			if entry != nil {
+				points += entry.Amount(s.from)
+			}
+		}
+		if points != 0 {
+			t.entries = append(t.entries, model.NewTransfer(s.typ, s.tournamentId, s.from, s.to, points))
+		}
+	}
+	balances := make(map[string]model.Money)
+	for _, entry := range t.entries {
+		if entry == nil {
+			return fmt.Errorf("entry is nil")
+		}
+		if err := entry.Validate(); err != nil {
+			return fmt.Errorf("invalid entry: %+v", err)
+		}
+		for _, p := range entry.Postings {
+			playerId, ok := p.Account.PlayerId()
+			if !ok {
+				continue
+			}
+			player, ok := db.Players[playerId]
+			if !ok {
+				return fmt.Errorf("player %s %w", playerId, ErrNotFound)
+			}
+			balance, ok := balances[playerId]
+			if !ok {
+				balance = player.GetBalance()
+			}
+			if balance+p.Amount < 0 {
+				return fmt.Errorf("player %s balance %s can't be increased by %s points: %w",
+					playerId, balance, p.Amount, ErrBalance)
+			}
+			balances[playerId] = balance + p.Amount
+		}
+	}
+	for _, account := range t.covered {
+		balance := db.balance(account)
+		var amount model.Money
+		for _, entry := range t.entries {
+			amount += entry.Amount(account)
+		}
+		if balance+amount < 0 {
+			return fmt.Errorf("account %s balance %s can't be increased by %s points: %w",
+				account, balance, amount, ErrBalance)
+		}
+	}
+
+	// NOTE: the balances are checked, so nothing fails below
+	for _, entry := range t.entries {
+		for i, p := range entry.Postings {
+			playerId, ok := p.Account.PlayerId()
+			if !ok {
+				continue
+			}
+			player := db.Players[playerId]
+			player.IncrBalance(p.Amount)
+			entry.Postings[i].Balance = player.GetBalance()
+			db.touch(kindPlayer, playerId)
+		}
+		db.append(entry)
+	}
+	for id, tournament := range tournaments {
+		db.Tournaments[id] = tournament
+		db.touch(kindTournament, strconv.Itoa(id))
+	}
+	for id, ticket := range tickets {
+		db.Tickets[id] = ticket
+		db.touch(kindTicket, strconv.Itoa(id))
+	}
+	for id, s := range series {
+		db.Series[id] = s
+		db.touch(kindSeries, id)
+	}
+	for _, ticket := range t.added {
+		db.LastTicketId++
+		ticket.Id = db.LastTicketId
+		db.Tickets[ticket.Id] = ticket.Clone()
+		db.touch(kindTicket, strconv.Itoa(ticket.Id))
+		db.touch(kindMeta, "")
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// DumpFileName is the versioned snapshot, see DumpVersion
+	DumpFileName string = "dump.db"
+	walFileName  string = "dump.wal"
+
+	// walVersion is written to the log header, the log without the header has no batch commits
+	walVersion int    = 1
+	walHeader  string = "header"
+	walCommit  string = "commit"
+)
+
+// walMark is the log header or the commit record ending the batch of the records saved by one dump
+type walMark struct {
+	Kind    string `json:"kind"`
+	Version int    `json:"version,omitempty"`
+	// the batch sequence range and the records number
+	First uint64 `json:"first,omitempty"`
+	Last  uint64 `json:"last,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+// fileStorage keeps the JSON snapshot of the db and the write-ahead log of the changes made after it,
+// every log record is a line prefixed with its checksum, the records of one dump are followed by the commit record
+type fileStorage struct {
+	dumpName string
+	walName  string
+	wal      walFile
+	openWal  func(name string) (walFile, error)
+	// the last logged record
+	seq uint64
+	// the log size to restore before the next write, the failed write may leave the partial batch
+	torn     bool
+	tornSize int64
+}
+
+// walFile is the opened log, see os.File
+type walFile interface {
+	Write(b []byte) (int, error)
+	Sync() error
+	Stat() (os.FileInfo, error)
+	Close() error
+}
+
+func newFileStorage(dir string) *fileStorage {
+	return &fileStorage{
+		dumpName: filepath.Join(dir, DumpFileName),
+		walName:  filepath.Join(dir, walFileName),
+		openWal:  openWalFile,
+	}
+}
+
+func openWalFile(name string) (walFile, error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// load reads the snapshot and replays the log batches committed after it,
+// the torn last record and the batch without the commit record are dropped, any other damage is an error
+// NOTE:
+// dumps of the older versions are migrated, see migrations,
+// dumps with float64 money are restored too, see model.Money
+func (s *fileStorage) load(db *DB) (int, bool, error) {
+	dump, err := ioutil.ReadFile(s.dumpName)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, false, fmt.Errorf("can't read dump: %+v", err)
+	}
+	// the log alone is written by the current version
+	version := DumpVersion
+	found := err == nil
+	if found {
+		if version, err = unmarshalDump(dump, db); err != nil {
+			return 0, false, fmt.Errorf("can't restore dump: %+v", err)
+		}
+	}
+	s.seq = db.WalSeq
+
+	b, err := ioutil.ReadFile(s.walName)
+	if os.IsNotExist(err) {
+		return version, found, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("can't read wal: %+v", err)
+	}
+	// NOTE: the log written before the batch commits has no header, every its record is applied alone
+	var batches bool
+	var batch []record
+	var size, committed int
+	reader := bufio.NewReader(bytes.NewReader(b))
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && err != nil {
+			fmt.Printf("ERROR: dropping torn wal record %d: %q\n", n, line)
+			break
+		}
+		if err != nil {
+			break
+		}
+		size += len(line)
+
+		data, err := parseWalLine(bytes.TrimSuffix(line, []byte("\n")))
+		if err != nil {
+			return 0, false, fmt.Errorf("corrupted wal record %d: %+v", n, err)
+		}
+		var rec record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return 0, false, fmt.Errorf("corrupted wal record %d: %+v", n, err)
+		}
+		switch {
+		case rec.Kind == walHeader:
+			var header walMark
+			if err := json.Unmarshal(data, &header); err != nil || n != 1 {
+				return 0, false, fmt.Errorf("invalid wal header %d: %+v", n, err)
+			}
+			if header.Version > walVersion {
+				return 0, false, fmt.Errorf("wal version %d is newer than supported version %d", header.Version, walVersion)
+			}
+			batches = true
+			committed = size
+		case rec.Kind == walCommit:
+			var commit walMark
+			if err := json.Unmarshal(data, &commit); err != nil || !batches {
+				return 0, false, fmt.Errorf("invalid wal commit %d: %+v", n, err)
+			}
+			if commit.Count != len(batch) || len(batch) == 0 ||
+				commit.First != batch[0].Seq || commit.Last != batch[len(batch)-1].Seq {
+				return 0, false, fmt.Errorf("wal commit %d doesn't match batch of %d records", n, len(batch))
+			}
+			if err := s.replay(db, batch); err != nil {
+				return 0, false, err
+			}
+			found = true
+			batch = nil
+			committed = size
+		case batches:
+			batch = append(batch, rec)
+		default:
+			if err := s.replay(db, []record{rec}); err != nil {
+				return 0, false, err
+			}
+			found = true
+			committed = size
+		}
+	}
+	if len(batch) > 0 {
+		fmt.Printf("ERROR: dropping uncommitted wal batch of %d records\n", len(batch))
+	}
+	if committed < len(b) {
+		if err := os.Truncate(s.walName, int64(committed)); err != nil {
+			return 0, false, fmt.Errorf("can't truncate wal: %+v", err)
+		}
+	}
+	return version, found, nil
+}
+
+// replay applies the log records made after the snapshot
+func (s *fileStorage) replay(db *DB, records []record) error {
+	for _, record := range records {
+		if record.Seq <= db.WalSeq {
+			// already in the snapshot
+			continue
+		}
+		if record.Seq != s.seq+1 {
+			return fmt.Errorf("wal record sequence %d doesn't follow %d", record.Seq, s.seq)
+		}
+		if err := db.apply(record); err != nil {
+			return fmt.Errorf("can't apply wal record %d: %+v", record.Seq, err)
+		}
+		s.seq = record.Seq
+	}
+	return nil
+}
+
+// save appends the records with the commit record to the log and syncs it to the disk,
+// the new log starts with the header
+func (s *fileStorage) save(records []record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if s.torn {
+		if err := s.truncate(s.tornSize); err != nil {
+			return err
+		}
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	info, err := s.wal.Stat()
+	if err != nil {
+		return fmt.Errorf("can't stat wal: %+v", err)
+	}
+
+	var buf bytes.Buffer
+	if info.Size() == 0 {
+		if err := writeWalLine(&buf, walMark{Kind: walHeader, Version: walVersion}); err != nil {
+			return err
+		}
+	}
+	seq := s.seq
+	for i := range records {
+		seq++
+		records[i].Seq = seq
+		if err := writeWalLine(&buf, records[i]); err != nil {
+			return err
+		}
+	}
+	commit := walMark{Kind: walCommit, First: s.seq + 1, Last: seq, Count: len(records)}
+	if err := writeWalLine(&buf, commit); err != nil {
+		return err
+	}
+	// NOTE: the failed write or sync may leave the batch or its part in the log,
+	// it's dropped, so the next batch neither joins the partial line nor reuses the sequence
+	if _, err := s.wal.Write(buf.Bytes()); err != nil {
+		return s.drop(info.Size(), fmt.Errorf("can't write wal: %+v", err))
+	}
+	if err := s.wal.Sync(); err != nil {
+		return s.drop(info.Size(), fmt.Errorf("can't sync wal: %+v", err))
+	}
+	s.seq = seq
+	return nil
+}
+
+// drop truncates the log to the size before the failed write and reopens it, returns the write error,
+// the log is truncated before the next write if it can't be truncated now
+func (s *fileStorage) drop(size int64, err error) error {
+	if terr := s.truncate(size); terr != nil {
+		s.torn = true
+		s.tornSize = size
+		return fmt.Errorf("%+v, %+v", err, terr)
+	}
+	if oerr := s.open(); oerr != nil {
+		return fmt.Errorf("%+v, %+v", err, oerr)
+	}
+	return err
+}
+
+// truncate closes the log and truncates it to the size
+func (s *fileStorage) truncate(size int64) error {
+	s.close()
+	if err := os.Truncate(s.walName, size); err != nil {
+		return fmt.Errorf("can't truncate wal: %+v", err)
+	}
+	s.torn = false
+	return nil
+}
+
+func (s *fileStorage) open() error {
+	if s.wal != nil {
+		return nil
+	}
+	wal, err := s.openWal(s.walName)
+	if err != nil {
+		return fmt.Errorf("can't open wal: %+v", err)
+	}
+	s.wal = wal
+	return nil
+}
+
+// compact writes the whole db snapshot via temp file and rename and truncates the log,
+// the records are in the snapshot already
+func (s *fileStorage) compact(db *DB, records []record) error {
+	db.WalSeq = s.seq
+	dump, err := marshalDump(db)
+	if err != nil {
+		return fmt.Errorf("can't marshal data: %+v", err)
+	}
+	if err := writeFileAtomic(s.dumpName, dump); err != nil {
+		return err
+	}
+	// NOTE: the records up to the snapshot sequence are skipped on load,
+	// so the crash before the truncate is safe
+	s.close()
+	if err := os.Truncate(s.walName, 0); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("can't truncate wal: %+v", err)
+	}
+	s.torn = false
+	return nil
+}
+
+func (s *fileStorage) clear() error {
+	s.close()
+	s.seq = 0
+	s.torn = false
+	for _, name := range []string{s.dumpName, s.walName} {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("can't remove %s: %+v", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *fileStorage) close() error {
+	if s.wal == nil {
+		return nil
+	}
+	err := s.wal.Close()
+	s.wal = nil
+	return err
+}
+
+// writeWalLine writes the log line of the value prefixed with its checksum
+func writeWalLine(buf *bytes.Buffer, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("can't marshal wal record: %+v", err)
+	}
+	fmt.Fprintf(buf, "%08x %s\n", crc32.ChecksumIEEE(line), line)
+	return nil
+}
+
+// parseWalLine returns the log line data if its checksum matches
+func parseWalLine(line []byte) ([]byte, error) {
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 {
+		return nil, fmt.Errorf("no checksum")
+	}
+	checksum, err := strconv.ParseUint(string(line[:i]), 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum %q", line[:i])
+	}
+	if uint32(checksum) != crc32.ChecksumIEEE(line[i+1:]) {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+	return line[i+1:], nil
+}
+
+// writeFileAtomic replaces the file, so the crash leaves either the old or the new content
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("can't create %s: %+v", tmp, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("can't write %s: %+v", tmp, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("can't sync %s: %+v", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("can't close %s: %+v", tmp, err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("can't rename %s: %+v", tmp, err)
+	}
+	// NOTE: the rename is durable after the directory sync
+	if dir, err := os.Open(filepath.Dir(name)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cnaize/lifland/model"
+)
+
+func TestRestoreWal(t *testing.T) {
+	dir := t.TempDir()
+	db := newDB(newFileStorage(dir))
+	fillDB(t, db)
+	if _, err := os.Stat(filepath.Join(dir, DumpFileName)); !os.IsNotExist(err) {
+		t.Errorf("dump written without snapshot")
+	}
+
+	restored := newDB(newFileStorage(dir))
+	if err := restored.Restore(context.Background()); err != nil {
+		t.Fatalf("can't restore: %+v", err)
+	}
+	// NOTE: the restore compacts the log
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, walFileName)); len(b) != 0 {
+		t.Errorf("log not compacted: %s", b)
+	}
+	checkRestored(t, restored)
+	ctx := context.Background()
+	restored.DelTournament(ctx, 1)
+	restored.Dump(ctx)
+	again := newDB(newFileStorage(dir))
+	if err := again.Restore(ctx); err != nil {
+		t.Fatalf("can't restore: %+v", err)
+	}
+	if _, err := again.GetTournament(ctx, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("log not replayed over snapshot")
+	}
+}
+
+func TestDumpChanged(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db := newDB(newFileStorage(dir))
+	fillDB(t, db)
+	logged := func() []record {
+		records, err := db.changes()
+		if err != nil {
+			t.Fatalf("can't get changes: %+v", err)
+		}
+		return records
+	}
+	if records := logged(); len(records) != 0 {
+		t.Errorf("dumped objects logged again: %+v", records)
+	}
+	db.AddPlayer(ctx, model.NewPlayer("p3"))
+	db.Dump(ctx)
+	db.UpdateTournament(ctx, 1, func(*model.Tournament) error { return nil })
+	db.DelPlayer(ctx, "p3")
+	records := logged()
+	if len(records) != 2 || records[0].Kind != kindPlayer || records[0].Data != nil || records[1].Kind != kindTournament {
+		t.Errorf("invalid changed records: %+v", records)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	db := newDB(newFileStorage(dir))
+	fillDB(t, db)
+	// NOTE: the crash between the snapshot and the log truncate
+	wal, err := ioutil.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatalf("can't read log: %+v", err)
+	}
+	if err := db.Snapshot(context.Background()); err != nil {
+		t.Fatalf("can't snapshot: %+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, walFileName), wal, 0644); err != nil {
+		t.Fatalf("can't write log: %+v", err)
+	}
+
+	restored := newDB(newFileStorage(dir))
+	if err := restored.Restore(context.Background()); err != nil {
+		t.Fatalf("can't restore: %+v", err)
+	}
+	checkRestored(t, restored)
+}
+
+func TestRestoreTornWal(t *testing.T) {
+	dir := t.TempDir()
+	db := newDB(newFileStorage(dir))
+	fillDB(t, db)
+	f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("can't open log: %+v", err)
+	}
+	f.WriteString(`12345678 {"seq":100,"kind":"pla`)
+	f.Close()
+
+	restored := newDB(newFileStorage(dir))
+	if err := restored.Restore(context.Background()); err != nil {
+		t.Fatalf("can't restore torn log: %+v", err)
+	}
+	checkRestored(t, restored)
+}
+
+func TestRestoreUncommittedBatch(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db := newDB(newFileStorage(dir))
+	fillDB(t, db)
+	name := filepath.Join(dir, walFileName)
+	committed, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("can't read log: %+v", err)
+	}
+	// the fund changes the player balance and appends the ledger entry in one batch
+	db.Post(ctx, model.NewTransfer(model.EntryFund, 0,
+		model.ExternalAccount, model.PlayerAccount("p1"), model.Points(10)))
+	db.Dump(ctx)
+	wal, _ := ioutil.ReadFile(name)
+	batch := wal[len(committed):]
+	if lines := bytes.Count(batch, []byte("\n")); lines != 3 {
+		t.Fatalf("invalid batch of %d lines: %s", lines, batch)
+	}
+	// NOTE: the crash between the records of the batch
+	cut := len(committed) + bytes.IndexByte(batch, '\n') + 1
+	if err := ioutil.WriteFile(name, wal[:cut], 0644); err != nil {
+		t.Fatalf("can't write log: %+v", err)
+	}
+
+	restored := newDB(newFileStorage(dir))
+	restored.SetDebug(true)
+	if err := restored.Restore(ctx); err != nil {
+		t.Fatalf("can't restore: %+v", err)
+	}
+	checkRestored(t, restored)
+	if b, _ := ioutil.ReadFile(name); !bytes.Equal(b, committed) {
+		t.Errorf("uncommitted batch not truncated: %s", b[len(committed):])
+	}
+}
+
+// faultyWal writes the part of the first batch and fails the write or writes it and fails the sync
+type faultyWal struct {
+	walFile
+	sync   bool
+	failed bool
+}
+
+func (f *faultyWal) Write(b []byte) (int, error) {
+	if f.sync || f.failed {
+		return f.walFile.Write(b)
+	}
+	f.failed = true
+	n, _ := f.walFile.Write(b[:len(b)/2])
+	return n, errors.New("no space left on device")
+}
+
+func (f *faultyWal) Sync() error {
+	if !f.sync || f.failed {
+		return f.walFile.Sync()
+	}
+	f.failed = true
+	return errors.New("input/output error")
+}
+
+func TestSaveFailed(t *testing.T) {
+	ctx := context.Background()
+	for _, sync := range []bool{false, true} {
+		dir := t.TempDir()
+		storage := newFileStorage(dir)
+		db := newDB(storage)
+		fillDB(t, db)
+		storage.close()
+		faulty := &faultyWal{sync: sync}
+		storage.openWal = func(name string) (walFile, error) {
+			wal, err := openWalFile(name)
+			faulty.walFile = wal
+			return faulty, err
+		}
+
+		db.AddPlayer(ctx, model.NewPlayer("p8"))
+		if err := db.Dump(ctx); err == nil {
+			t.Fatalf("failed write dumped, sync %t", sync)
+		}
+		db.AddPlayer(ctx, model.NewPlayer("p9"))
+		if err := db.Dump(ctx); err != nil {
+			t.Fatalf("can't dump after failed write, sync %t: %+v", sync, err)
+		}
+
+		restored := newDB(newFileStorage(dir))
+		restored.SetDebug(true)
+		if err := restored.Restore(ctx); err != nil {
+			t.Fatalf("can't restore after failed write, sync %t: %+v", sync, err)
+		}
+		checkRestored(t, restored)
+		// the changes of the failed write are saved with the next batch
+		for _, id := range []string{"p8", "p9"} {
+			if _, err := restored.GetPlayer(ctx, id); err != nil {
+				t.Errorf("player %s not restored, sync %t: %+v", id, sync, err)
+			}
+		}
+	}
+}
+
+func TestRestoreLegacyWal(t *testing.T) {
+	dir := t.TempDir()
+	var wal bytes.Buffer
+	// NOTE: the log written before the batch commits has neither the header nor the commit records
+	for i, data := range []string{`{"id":"p1","balance":"0"}`, `{"id":"p2","balance":"0"}`} {
+		writeWalLine(&wal, record{Seq: uint64(i + 1), Kind: kindPlayer, Id: fmt.Sprintf("p%d", i+1), Data: json.RawMessage(data)})
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, walFileName), wal.Bytes(), 0644); err != nil {
+		t.Fatalf("can't write log: %+v", err)
+	}
+	db := newDB(newFileStorage(dir))
+	db.SetDebug(true)
+	if err := db.Restore(context.Background()); err != nil {
+		t.Fatalf("can't restore legacy log: %+v", err)
+	}
+	if player, err := db.GetPlayer(context.Background(), "p2"); err != nil || player.GetId() != "p2" {
+		t.Errorf("legacy log not replayed: %+v", err)
+	}
+}
+
+func TestRestoreCorrupted(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(wal []byte) []byte
+		dump    string
+	}{
+		{name: "checksum", corrupt: func(wal []byte) []byte {
+			wal[0] ^= 1
+			return wal
+		}},
+		{name: "record", corrupt: func(wal []byte) []byte {
+			for i, c := range wal {
+				if c == '{' {
+					wal[i] = '['
+					break
+				}
+			}
+			return wal
+		}},
+		{name: "header", corrupt: func(wal []byte) []byte {
+			return wal[bytes.IndexByte(wal, '\n')+1:]
+		}},
+		// the first batch after the header is missing
+		{name: "gap", corrupt: func(wal []byte) []byte {
+			header := bytes.IndexByte(wal, '\n') + 1
+			commit := bytes.Index(wal, []byte(`"kind":"commit"`))
+			return append(wal[:header:header], wal[commit+bytes.IndexByte(wal[commit:], '\n')+1:]...)
+		}},
+		{name: "dump", corrupt: func(wal []byte) []byte { return wal }, dump: "{"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db := newDB(newFileStorage(dir))
+			fillDB(t, db)
+			wal, err := ioutil.ReadFile(filepath.Join(dir, walFileName))
+			if err != nil {
+				t.Fatalf("can't read log: %+v", err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, walFileName), test.corrupt(wal), 0644); err != nil {
+				t.Fatalf("can't write log: %+v", err)
+			}
+			if test.dump != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, DumpFileName), []byte(test.dump), 0644); err != nil {
+					t.Fatalf("can't write dump: %+v", err)
+				}
+			}
+
+			if err := newDB(newFileStorage(dir)).Restore(context.Background()); err == nil {
+				t.Errorf("corrupted db restored")
+			}
+		})
+	}
+}
+
+func TestRestoreOldFunds(t *testing.T) {
+	dir := t.TempDir()
+	// NOTE: the old dumps have the misspelled funds key and the bare funds without ids
+	dump := `{"players":{"p1":{"id":"p1","balance":0}},"Funds":[{"p1":10},{"tournamentId":1,"fund":{"p1":5}}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, DumpFileName), []byte(dump), 0644); err != nil {
+		t.Fatalf("can't write dump: %+v", err)
+	}
+	db := newDB(newFileStorage(dir))
+	ctx := context.Background()
+	if err := db.Restore(ctx); err != nil {
+		t.Fatalf("can't restore: %+v", err)
+	}
+	funds, _ := db.GetFunds(ctx)
+	if len(funds) != 2 || funds[0].Id != 1 || funds[1].Id != 2 || funds[1].TournamentId != 1 {
+		t.Fatalf("invalid restored funds: %+v", funds)
+	}
+	db.AddFund(ctx, 1, model.Fund{"p1": model.Points(1)})
+	if funds, _ := db.GetFunds(ctx); funds[2].Id != 3 {
+		t.Errorf("invalid new fund id %d", funds[2].Id)
+	}
+}
@@ -2,21 +2,75 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"path/filepath"
 	"time"
 
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
 	"github.com/cnaize/lifland/server"
 )
 
 var (
-	syncDelay time.Duration
+	dbBackend     string
+	dbDir         string
+	syncDelay     time.Duration
+	fundAttempts  int
+	responseTTL   time.Duration
+	scheduleDelay time.Duration
+	snapshotDelay time.Duration
+	moneyScale    int
+	legacyResult  bool
 )
 
 func init() {
+	flag.StringVar(&dbBackend, "db-backend", db.BackendFile, "db storage backend: file or kv")
+	flag.StringVar(&dbDir, "db-dir", "", "db storage directory, the working directory if not set")
 	flag.DurationVar(&syncDelay, "sync-delay", time.Duration(1*time.Second), "sync funds delay")
+	flag.IntVar(&fundAttempts, "fund-attempts", db.DefaultMaxFundAttempts, "failed syncs moving the fund to the dead funds")
+	flag.DurationVar(&responseTTL, "response-ttl", db.DefaultResponseTTL, "time the idempotent request response is replayed")
+	flag.DurationVar(&scheduleDelay, "schedule-delay", time.Duration(1*time.Second), "scheduled tournaments check delay")
+	flag.DurationVar(&snapshotDelay, "snapshot-delay", time.Duration(1*time.Minute), "db snapshot delay")
+	flag.IntVar(&moneyScale, "money-scale", model.GetMoneyScale(), "number of decimal places in points")
+	flag.BoolVar(&legacyResult, "legacy-result", true, "close the oldest tournament on results without tournament id")
 }
 
 func main() {
 	flag.Parse()
-	s := server.NewServer(syncDelay)
+	if err := model.SetMoneyScale(moneyScale); err != nil {
+		panic(err)
+	}
+	if flag.Arg(0) == "migrate" {
+		migrate(flag.Args()[1:])
+		return
+	}
+	s := server.NewServer(server.Config{
+		DB:            db.Config{Backend: dbBackend, Dir: dbDir, MaxFundAttempts: fundAttempts, ResponseTTL: responseTTL},
+		SyncDelay:     syncDelay,
+		ScheduleDelay: scheduleDelay,
+		SnapshotDelay: snapshotDelay,
+		LegacyResult:  legacyResult,
+	})
 	panic(s.Run("8000"))
 }
+
+// migrate upgrades the file backend dump offline: lifland [flags] migrate [-in dump.db] [-out dump.db],
+// the dump with the uncompacted wal is refused, the kv backend is migrated on open
+func migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	in := flags.String("in", filepath.Join(dbDir, db.DumpFileName), "dump to migrate")
+	out := flags.String("out", "", "migrated dump, the input dump is replaced if not set")
+	flags.Parse(args)
+	if *out == "" {
+		*out = *in
+	}
+	version, err := db.MigrateFile(*in, *out)
+	if err != nil {
+		panic(err)
+	}
+	if version == db.DumpVersion {
+		fmt.Printf("dump %s is version %d already\n", *in, version)
+		return
+	}
+	fmt.Printf("dump %s migrated from version %d to version %d\n", *in, version, db.DumpVersion)
+}
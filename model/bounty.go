@@ -0,0 +1,147 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Elimination is the knockout of the player in the bounty tournament
+type Elimination struct {
+	PlayerId     string `json:"playerId"`
+	EliminatorId string `json:"eliminatorId"`
+	// the bounty paid to the eliminator
+	Bounty Money `json:"bounty"`
+	// the bounty part added to the eliminator bounty in the progressive tournament
+	Progressive Money     `json:"progressive,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// Eliminate records the knockout and returns the bounty paid to the eliminator,
+// half of the bounty (rounded up) goes to the eliminator bounty in the progressive tournament
+func (t *Tournament) Eliminate(id, eliminatorId string) (Elimination, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.State != StateRunning {
+		return Elimination{}, &StateError{TournamentId: t.Id, State: t.State, Action: "eliminate"}
+	}
+	if t.Bounty == 0 {
+		return Elimination{}, fmt.Errorf("Tournament %d has no bounties", t.Id)
+	}
+	if id == eliminatorId {
+		return Elimination{}, fmt.Errorf("Player %s can't be eliminated by the same player in tournament %d", id, t.Id)
+	}
+	for _, playerId := range []string{id, eliminatorId} {
+		if _, ok := t.Funds[playerId]; !ok || t.playerId(playerId) != playerId {
+			return Elimination{}, fmt.Errorf("Player %s isn't in tournament %d", playerId, t.Id)
+		}
+		if t.isEliminated(playerId) {
+			return Elimination{}, fmt.Errorf("Player %s already eliminated from tournament %d", playerId, t.Id)
+		}
+	}
+
+	bounty := t.bounty(id)
+	elimination := Elimination{
+		PlayerId:     id,
+		EliminatorId: eliminatorId,
+		Bounty:       bounty,
+		Time:         time.Now(),
+	}
+	if t.ProgressiveBounty {
+		elimination.Bounty = bounty / 2
+		elimination.Progressive = bounty - elimination.Bounty
+	}
+	fmt.Printf("player %s eliminated player %s in tournament %d, bounty: %s\n",
+		eliminatorId, id, t.Id, elimination.Bounty)
+	t.Eliminations = append(t.Eliminations, elimination)
+	return elimination, nil
+}
+
+// GetBounty returns the current bounty on the player head
+func (t *Tournament) GetBounty(id string) Money {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.bounty(id)
+}
+
+// GetBounties returns the bounties not collected by eliminators
+func (t *Tournament) GetBounties() map[string]Money {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bounties := make(map[string]Money)
+	for key := range t.Funds {
+		id := t.playerId(key)
+		if bounty := t.bounty(id); bounty > 0 {
+			bounties[id] = bounty
+		}
+	}
+	return bounties
+}
+
+func (t *Tournament) GetEliminations() []Elimination {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Elimination{}, t.Eliminations...)
+}
+
+// NOTE: not thread safe
+func (t *Tournament) bounty(id string) Money {
+	var bounty Money
+	for key, fund := range t.Funds {
+		if t.playerId(key) == id {
+			bounty += t.entryBounty(key, fund)
+		}
+	}
+	for _, elimination := range t.Eliminations {
+		if elimination.EliminatorId == id {
+			bounty += elimination.Progressive
+		}
+		if elimination.PlayerId == id {
+			bounty -= elimination.Bounty + elimination.Progressive
+		}
+	}
+	return bounty
+}
+
+// bountyPool returns the deposits part reserved for the bounties
+// NOTE: not thread safe
+func (t *Tournament) bountyPool() Money {
+	var pool Money
+	for key, fund := range t.Funds {
+		pool += t.entryBounty(key, fund)
+	}
+	return pool
+}
+
+// entryBounty returns the deposit part put on the player head, the add-ons don't add bounty
+// NOTE: not thread safe
+func (t *Tournament) entryBounty(key string, fund Fund) Money {
+	if t.BuyIns[key].Kind == BuyInAddon {
+		return 0
+	}
+	var deposit Money
+	for _, income := range fund {
+		deposit -= income
+	}
+	return t.Bounty.Of(deposit)
+}
+
+// isEliminated reports whether the player lost all the entries
+// NOTE: not thread safe
+func (t *Tournament) isEliminated(id string) bool {
+	var lives, eliminations int
+	for key := range t.Funds {
+		if t.playerId(key) == id && t.BuyIns[key].Kind != BuyInAddon {
+			lives++
+		}
+	}
+	for _, elimination := range t.Eliminations {
+		if elimination.PlayerId == id {
+			eliminations++
+		}
+	}
+	return eliminations >= lives
+}
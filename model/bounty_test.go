@@ -0,0 +1,107 @@
+package model
+
+import "testing"
+
+func TestTournamentEliminate(t *testing.T) {
+	tourn := NewTournament(1, Points(10))
+	tourn.SetOptions(TournamentOptions{
+		Rake:   Percent(1000),
+		Bounty: Percent(2000),
+		Limits: map[BuyInKind]BuyInLimit{
+			BuyInReentry: {Max: 1},
+			BuyInAddon:   {Max: 1, Price: Points(5)},
+		},
+	})
+	tourn.OpenRegistration()
+	for _, id := range []string{"10", "20", "30"} {
+		tourn.AddPlayer(id, Fund{id: Points(-10)})
+	}
+	if _, err := tourn.Eliminate("10", "20"); err == nil {
+		t.Errorf("eliminated before start")
+	}
+	tourn.Start()
+
+	tests := []struct {
+		playerId     string
+		eliminatorId string
+		wantBounty   Money
+		wantErr      bool
+	}{
+		{"10", "10", 0, true},
+		{"40", "10", 0, true},
+		{"10", "20", Points(2), false},
+		{"10", "30", 0, true},
+		{"20", "10", 0, true},
+	}
+	for i, test := range tests {
+		elimination, err := tourn.Eliminate(test.playerId, test.eliminatorId)
+		if (err != nil) != test.wantErr {
+			t.Errorf("invalid error for test %d: %+v", i, err)
+		}
+		if elimination.Bounty != test.wantBounty {
+			t.Errorf("invalid bounty for test %d: want %s, got %s", i, test.wantBounty, elimination.Bounty)
+		}
+	}
+
+	// the re-entry puts the new bounty on the player head, the add-on doesn't
+	if err := tourn.AddBuyIn("10", BuyInReentry, Fund{"10": Points(-10)}, nil); err != nil {
+		t.Fatalf("can't make reentry: %+v", err)
+	}
+	if err := tourn.AddBuyIn("30", BuyInAddon, Fund{"30": Points(-5)}, nil); err != nil {
+		t.Fatalf("can't make addon: %+v", err)
+	}
+	if bounty := tourn.GetBounty("10"); bounty != Points(2) {
+		t.Errorf("invalid re-entry bounty: want 2, got %s", bounty)
+	}
+	if elimination, err := tourn.Eliminate("10", "30"); err != nil || elimination.Bounty != Points(2) {
+		t.Errorf("can't eliminate re-entry: %+v, %+v", elimination, err)
+	}
+	bounties := tourn.GetBounties()
+	if len(bounties) != 2 || bounties["20"] != Points(2) || bounties["30"] != Points(2) {
+		t.Errorf("invalid bounties: %+v", bounties)
+	}
+	// collected 45, bounties 8, rake 4.5
+	if pool, rake, _ := tourn.GetPrizePool(); pool != MustParseMoney("32.5") || rake != MustParseMoney("4.5") {
+		t.Errorf("invalid prize pool %s and rake %s", pool, rake)
+	}
+}
+
+func TestTournamentProgressiveBounty(t *testing.T) {
+	tourn := NewTournament(1, Points(10))
+	tourn.SetOptions(TournamentOptions{Bounty: Percent(5000), ProgressiveBounty: true})
+	tourn.OpenRegistration()
+	for _, id := range []string{"10", "20", "30"} {
+		tourn.AddPlayer(id, Fund{id: Points(-10)})
+	}
+	tourn.Start()
+
+	if elimination, err := tourn.Eliminate("10", "20"); err != nil || elimination.Bounty != MustParseMoney("2.5") {
+		t.Fatalf("invalid elimination: %+v, %+v", elimination, err)
+	}
+	if bounty := tourn.GetBounty("20"); bounty != MustParseMoney("7.5") {
+		t.Errorf("invalid progressive bounty: want 7.5, got %s", bounty)
+	}
+	if elimination, err := tourn.Eliminate("20", "30"); err != nil || elimination.Bounty != MustParseMoney("3.75") {
+		t.Errorf("invalid elimination: %+v, %+v", elimination, err)
+	}
+	if bounty := tourn.GetBounty("30"); bounty != MustParseMoney("8.75") {
+		t.Errorf("invalid progressive bounty: want 8.75, got %s", bounty)
+	}
+}
+
+func TestTournamentOptionsBounty(t *testing.T) {
+	tests := []struct {
+		options TournamentOptions
+		wantErr bool
+	}{
+		{TournamentOptions{Bounty: Percent(5000)}, false},
+		{TournamentOptions{Bounty: Percent(-100)}, true},
+		{TournamentOptions{Bounty: Percent(6000), Rake: Percent(5000)}, true},
+		{TournamentOptions{ProgressiveBounty: true}, true},
+	}
+	for i, test := range tests {
+		if err := test.options.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("invalid error for test %d: %+v", i, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BuyInKind is an additional entry of the joined player
+type BuyInKind string
+
+const (
+	// the player buys the chips again, allowed while the tournament is open
+	BuyInRebuy BuyInKind = "rebuy"
+	// the player enters again after bust, allowed while the tournament is open
+	BuyInReentry BuyInKind = "reentry"
+	// the player buys the extra chips at the break, allowed while the tournament is running
+	BuyInAddon BuyInKind = "addon"
+)
+
+var BuyInKinds = []BuyInKind{BuyInRebuy, BuyInReentry, BuyInAddon}
+
+func (k BuyInKind) Validate() error {
+	for _, kind := range BuyInKinds {
+		if k == kind {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid buy-in kind %q", string(k))
+}
+
+// EntryType returns the ledger entry type of the player deposit
+func (k BuyInKind) EntryType() EntryType {
+	switch k {
+	case BuyInRebuy:
+		return EntryRebuy
+	case BuyInReentry:
+		return EntryReentry
+	case BuyInAddon:
+		return EntryAddon
+	}
+	return EntryJoin
+}
+
+// BuyInLimit is the number of the buy-ins allowed per player and their price
+type BuyInLimit struct {
+	Max int `json:"max"`
+	// the tournament deposit is used if not set
+	Price Money `json:"price,omitempty"`
+}
+
+// ParseBuyInLimit parses the limit with an optional price, e.g. 3 or 3:5.50
+func ParseBuyInLimit(s string) (BuyInLimit, error) {
+	var limit BuyInLimit
+	parts := strings.SplitN(s, ":", 2)
+	max, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return limit, fmt.Errorf("invalid buy-in limit %q: %+v", s, err)
+	}
+	limit.Max = max
+	if len(parts) > 1 {
+		if limit.Price, err = ParseMoney(parts[1]); err != nil {
+			return limit, fmt.Errorf("invalid buy-in limit %q: %+v", s, err)
+		}
+	}
+	if err := limit.Validate(); err != nil {
+		return limit, err
+	}
+	return limit, nil
+}
+
+func (l BuyInLimit) Validate() error {
+	if l.Max < 0 {
+		return fmt.Errorf("invalid buy-in limit: max %d", l.Max)
+	}
+	if l.Price < 0 {
+		return fmt.Errorf("invalid buy-in limit: price %s", l.Price)
+	}
+	return nil
+}
+
+// BuyIn is the additional entry of the player recorded in the tournament funds
+type BuyIn struct {
+	PlayerId string    `json:"playerId"`
+	Kind     BuyInKind `json:"kind"`
+}
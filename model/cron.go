@@ -0,0 +1,130 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a recurrence rule in the cron format: minute hour day-of-month month day-of-week,
+// the fields support *, lists, ranges and steps, e.g. 0 20 * * 1-5 or */30 * * * *
+type Cron struct {
+	minute [60]bool
+	hour   [24]bool
+	dom    [32]bool
+	month  [13]bool
+	dow    [7]bool
+	// the day matches either day-of-month or day-of-week if both restricted
+	domAny bool
+	dowAny bool
+}
+
+var cronShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func ParseCron(s string) (*Cron, error) {
+	if shortcut, ok := cronShortcuts[strings.TrimSpace(s)]; ok {
+		s = shortcut
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron %q: want 5 fields, got %d", s, len(fields))
+	}
+
+	var c Cron
+	for i, field := range []struct {
+		set      []bool
+		min, max int
+	}{
+		{c.minute[:], 0, 59},
+		{c.hour[:], 0, 23},
+		{c.dom[:], 1, 31},
+		{c.month[:], 1, 12},
+		{c.dow[:], 0, 6},
+	} {
+		if err := parseCronField(fields[i], field.set, field.min, field.max); err != nil {
+			return nil, fmt.Errorf("invalid cron %q: %+v", s, err)
+		}
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return &c, nil
+}
+
+// Next returns the first matching time after the passed one
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// NOTE: the rule may never match, e.g. 0 0 31 2 *
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.month[t.Month()]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) day(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[t.Weekday()]
+	switch {
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+func parseCronField(field string, set []bool, min, max int) error {
+	for _, part := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if i := strings.Index(part, "/"); i >= 0 {
+			stepped = true
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return fmt.Errorf("invalid value in %q", part)
+			}
+			to = from
+			if stepped {
+				// e.g. 5/15 is 5-max/15
+				to = max
+			}
+			if len(bounds) > 1 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return fmt.Errorf("invalid value in %q", part)
+				}
+			}
+		}
+		if from < min || to > max || from > to {
+			return fmt.Errorf("value out of range [%d, %d] in %q", min, max, part)
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
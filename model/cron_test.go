@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronParse(t *testing.T) {
+	tests := []struct {
+		s       string
+		wantErr bool
+	}{
+		{"", true},
+		{"* * * *", true},
+		{"60 * * * *", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"qwe * * * *", true},
+		{"* * * * *", false},
+		{"0,30 9-18 * * 1-5", false},
+		{"5/15 */2 1 1,6 *", false},
+		{"@daily", false},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseCron(test.s); (err != nil) != test.wantErr {
+			t.Errorf("invalid error for cron %q: %+v", test.s, err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Monday
+	after := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"5/15 * * * *", time.Date(2024, 1, 1, 10, 20, 0, 0, time.UTC)},
+		{"0 20 * * *", time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// either day of month or day of week
+		{"0 0 15 * 3", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		cron, err := ParseCron(test.s)
+		if err != nil {
+			t.Fatalf("can't parse cron %q: %+v", test.s, err)
+		}
+		if next := cron.Next(after); !next.Equal(test.want) {
+			t.Errorf("invalid next time for cron %q: want %s, got %s", test.s, test.want, next)
+		}
+	}
+}
@@ -1,6 +1,23 @@
 package model
 
-type Fund map[string]float64
+import (
+	"fmt"
+	"time"
+)
+
+type Fund map[string]Money
+
+// Copy returns the fund sharing nothing with f, nil for the nil fund
+func (f Fund) Copy() Fund {
+	if f == nil {
+		return nil
+	}
+	fund := make(Fund, len(f))
+	for id, income := range f {
+		fund[id] = income
+	}
+	return fund
+}
 
 func (f Fund) Invert() Fund {
 	fund := Fund{}
@@ -9,3 +26,64 @@ func (f Fund) Invert() Fund {
 	}
 	return fund
 }
+
+// PendingFund is a fund which should be moved from the tournament pool
+// to the players, but can't be applied right now
+type PendingFund struct {
+	Id           int  `json:"id,omitempty"`
+	TournamentId int  `json:"tournamentId"`
+	Fund         Fund `json:"fund"`
+	// failed sync attempts since the fund was added or retried
+	Attempts  int       `json:"attempts,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// Age returns the time the fund is pending
+func (f *PendingFund) Age(now time.Time) time.Duration {
+	if f.Created.IsZero() {
+		return 0
+	}
+	return now.Sub(f.Created)
+}
+
+// Amount returns the points which should be moved from the tournament pool
+func (f *PendingFund) Amount() Money {
+	var amount Money
+	for _, income := range f.Fund {
+		amount += income
+	}
+	return amount
+}
+
+// Fail counts the failed sync attempt
+func (f *PendingFund) Fail(err error) {
+	f.Attempts++
+	f.LastError = err.Error()
+}
+
+// Retry resets the failed attempts, so the fund is synced again
+func (f *PendingFund) Retry() {
+	f.Attempts = 0
+	f.LastError = ""
+}
+
+// Reassign moves the player income to the other player, e.g. the deleted player account
+func (f *PendingFund) Reassign(from, to string) error {
+	income, ok := f.Fund[from]
+	if !ok {
+		return fmt.Errorf("player %s not found in fund %d", from, f.Id)
+	}
+	if from == to {
+		return fmt.Errorf("fund %d already belongs to player %s", f.Id, to)
+	}
+	delete(f.Fund, from)
+	f.Fund[to] += income
+	return nil
+}
+
+// Copy returns the pending fund sharing nothing with f
+func (f PendingFund) Copy() PendingFund {
+	f.Fund = f.Fund.Copy()
+	return f
+}
@@ -0,0 +1,170 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Account is a ledger account, points are moved only between accounts
+type Account string
+
+const (
+	// points entered or left the service via fund/take
+	ExternalAccount Account = "external"
+	// operator's account
+	HouseAccount Account = "house"
+	// value of the active tickets
+	TicketsAccount Account = "tickets"
+
+	playerAccountPrefix     = "player:"
+	tournamentAccountPrefix = "tournament:"
+)
+
+func PlayerAccount(id string) Account {
+	return Account(playerAccountPrefix + id)
+}
+
+// TournamentAccount is the tournament pool
+func TournamentAccount(id int) Account {
+	return Account(fmt.Sprintf("%s%d", tournamentAccountPrefix, id))
+}
+
+func (a Account) PlayerId() (string, bool) {
+	if !strings.HasPrefix(string(a), playerAccountPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(string(a), playerAccountPrefix), true
+}
+
+type EntryType string
+
+const (
+	// balance the player had before the ledger was introduced
+	EntryOpening EntryType = "opening"
+	EntryFund    EntryType = "fund"
+	EntryTake    EntryType = "take"
+	// the player paid the deposit
+	EntryJoin EntryType = "join"
+	// the backer paid the deposit for the player
+	EntryBacker EntryType = "backer"
+	EntryPrize  EntryType = "prize"
+	// the player paid the buy-in price
+	EntryRebuy   EntryType = "rebuy"
+	EntryReentry EntryType = "reentry"
+	EntryAddon   EntryType = "addon"
+	// pending fund of the legacy dump synced by DB.SyncFunds
+	EntryCompensation EntryType = "compensation"
+	// the rest of the pool moved to the house on tournament close
+	EntrySettle EntryType = "settle"
+	// the deposit returned on tournament cancel
+	EntryRefund EntryType = "refund"
+	// the house part of the collected deposits
+	EntryRake EntryType = "rake"
+	// the house paid the prize pool shortfall to reach the guarantee
+	EntryOverlay EntryType = "overlay"
+	// the bounty paid to the eliminator or to the bounty owner on results
+	EntryBounty EntryType = "bounty"
+	// the season prize paid by the house
+	EntrySeason EntryType = "season"
+	// the ticket awarded instead of the prize
+	EntryTicket EntryType = "ticket"
+	// the ticket redeemed instead of the deposit
+	EntryRedeem EntryType = "redeem"
+	// the unused ticket value returned to the player
+	EntryConvert EntryType = "convert"
+	// the expired ticket value moved to the house
+	EntryExpire EntryType = "expire"
+	// the pending fund which can't be synced moved to the house
+	EntryWriteOff EntryType = "writeoff"
+)
+
+// IsDeposit reports whether the player pays the tournament pool by the entry
+func (t EntryType) IsDeposit() bool {
+	switch t {
+	case EntryJoin, EntryRebuy, EntryReentry, EntryAddon:
+		return true
+	}
+	return false
+}
+
+type Posting struct {
+	Account Account `json:"account"`
+	Amount  Money   `json:"amount"`
+	// resulting balance, set only for the player accounts
+	Balance Money `json:"balance"`
+}
+
+// NOTE:
+// fields open only for marshaling, don't use it directly
+type Entry struct {
+	Id           int       `json:"id"`
+	Type         EntryType `json:"type"`
+	TournamentId int       `json:"tournamentId,omitempty"`
+	Time         time.Time `json:"time"`
+	Postings     []Posting `json:"postings"`
+}
+
+func NewEntry(typ EntryType, tournamentId int, postings ...Posting) *Entry {
+	return &Entry{
+		Type:         typ,
+		TournamentId: tournamentId,
+		Postings:     postings,
+	}
+}
+
+// NewTransfer moves points from one account to another
+func NewTransfer(typ EntryType, tournamentId int, from, to Account, points Money) *Entry {
+	return NewEntry(typ, tournamentId,
+		Posting{Account: from, Amount: -points},
+		Posting{Account: to, Amount: points})
+}
+
+func (e *Entry) GetId() int {
+	return e.Id
+}
+
+func (e *Entry) GetType() EntryType {
+	return e.Type
+}
+
+func (e *Entry) GetTournamentId() int {
+	return e.TournamentId
+}
+
+func (e *Entry) GetTime() time.Time {
+	return e.Time
+}
+
+func (e *Entry) GetPostings() []Posting {
+	return e.Postings
+}
+
+// Amount returns the sum of the account postings
+func (e *Entry) Amount(account Account) Money {
+	var amount Money
+	for _, p := range e.Postings {
+		if p.Account == account {
+			amount += p.Amount
+		}
+	}
+	return amount
+}
+
+// Validate checks the entry is balanced
+func (e *Entry) Validate() error {
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("entry %s has %d postings", e.Type, len(e.Postings))
+	}
+	var sum Money
+	for _, p := range e.Postings {
+		if p.Amount == 0 {
+			return fmt.Errorf("entry %s has zero posting for account %s", e.Type, p.Account)
+		}
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("entry %s is unbalanced by %s points", e.Type, sum)
+	}
+	return nil
+}
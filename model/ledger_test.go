@@ -0,0 +1,36 @@
+package model
+
+import "testing"
+
+func TestLedgerEntry(t *testing.T) {
+	tests := []struct {
+		entry   *Entry
+		wantErr bool
+	}{
+		{NewEntry(EntryFund, 0), true},
+		{NewEntry(EntryFund, 0, Posting{Account: HouseAccount, Amount: 1}), true},
+		{NewEntry(EntryFund, 0,
+			Posting{Account: HouseAccount, Amount: 1},
+			Posting{Account: ExternalAccount, Amount: -2}), true},
+		{NewTransfer(EntryFund, 0, ExternalAccount, PlayerAccount("p"), 0), true},
+		{NewTransfer(EntryFund, 0, ExternalAccount, PlayerAccount("p"), Points(10)), false},
+		{NewTransfer(EntryCompensation, 1, TournamentAccount(1), PlayerAccount("p"), Points(-10)), false},
+	}
+
+	for i, test := range tests {
+		if err := test.entry.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("invalid validation for entry %d: %+v", i, err)
+		}
+	}
+
+	entry := NewTransfer(EntryJoin, 1, PlayerAccount("p"), TournamentAccount(1), Points(10))
+	if entry.Amount(PlayerAccount("p")) != Points(-10) {
+		t.Errorf("invalid amount: want %s, got %s", Points(-10), entry.Amount(PlayerAccount("p")))
+	}
+	if id, ok := PlayerAccount("p").PlayerId(); !ok || id != "p" {
+		t.Errorf("invalid player id: want %s, got %s", "p", id)
+	}
+	if _, ok := TournamentAccount(1).PlayerId(); ok {
+		t.Errorf("tournament account has player id")
+	}
+}
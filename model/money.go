@@ -0,0 +1,152 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Money is a fixed-point amount of points stored in minor units,
+// the number of minor units in a point is defined by the money scale
+type Money int64
+
+const (
+	defaultMoneyScale int = 2
+	maxMoneyScale     int = 9
+)
+
+var (
+	moneyScale  = defaultMoneyScale
+	moneyFactor = pow10(defaultMoneyScale)
+)
+
+// NOTE: not thread safe, call it once on startup before creating any money
+func SetMoneyScale(scale int) error {
+	if scale < 0 || scale > maxMoneyScale {
+		return fmt.Errorf("invalid money scale %d: must be in [0, %d]", scale, maxMoneyScale)
+	}
+	moneyScale = scale
+	moneyFactor = pow10(scale)
+	return nil
+}
+
+func GetMoneyScale() int {
+	return moneyScale
+}
+
+// Points converts the whole number of points to money
+func Points(points int64) Money {
+	return Money(points * moneyFactor)
+}
+
+// ParseMoney parses a decimal string, more digits than the scale are not allowed
+func ParseMoney(s string) (Money, error) {
+	return parseMoney(s, false)
+}
+
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Split splits the money into n parts as equal as possible,
+// the rounding remainder is placed to the last part
+func (m Money) Split(n int) []Money {
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return m.Allocate(weights)
+}
+
+// Allocate splits the money proportionally to the weights,
+// the rounding remainder is placed to the last part
+func (m Money) Allocate(weights []int64) []Money {
+	if len(weights) == 0 {
+		return nil
+	}
+
+	var total int64
+	for _, w := range weights {
+		total += w
+	}
+	parts := make([]Money, len(weights))
+	if total == 0 {
+		parts[len(parts)-1] = m
+		return parts
+	}
+
+	var rest = m
+	for i, w := range weights[:len(weights)-1] {
+		part := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(w))
+		part.Quo(part, big.NewInt(total))
+		parts[i] = Money(part.Int64())
+		rest -= parts[i]
+	}
+	parts[len(parts)-1] = rest
+	return parts
+}
+
+func (m Money) String() string {
+	sign := ""
+	minor := int64(m)
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	if moneyScale == 0 {
+		return fmt.Sprintf("%s%d", sign, minor)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/moneyFactor, moneyScale, minor%moneyFactor)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// NOTE:
+// more digits than the scale are rounded half away from zero,
+// so the old dumps with float64 balances are restored correctly
+func (m *Money) UnmarshalJSON(b []byte) error {
+	money, err := parseMoney(strings.Trim(string(b), `"`), true)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
+
+func parseMoney(s string, round bool) (Money, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.Trim(s, "0123456789.eE+-") != "" {
+		return 0, fmt.Errorf("invalid money %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(moneyFactor))
+	if !r.IsInt() {
+		if !round {
+			return 0, fmt.Errorf("invalid money %q: more than %d decimal places", s, moneyScale)
+		}
+		// round half away from zero
+		half := big.NewRat(1, 2)
+		if r.Sign() < 0 {
+			half.Neg(half)
+		}
+		r.Add(r, half)
+	}
+	minor := new(big.Int).Quo(r.Num(), r.Denom())
+	if !minor.IsInt64() {
+		return 0, fmt.Errorf("invalid money %q: out of range", s)
+	}
+	return Money(minor.Int64()), nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMoneyParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"", 0, true},
+		{"qwe", 0, true},
+		{"0x10", 0, true},
+		{"1/2", 0, true},
+		{"10", 1000, false},
+		{"10.1", 1010, false},
+		{"-0.05", -5, false},
+		{"1e2", 10000, false},
+		{"10.001", 0, true},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMoney(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("invalid error for %q: %+v", test.in, err)
+		}
+		if err == nil && m != test.want {
+			t.Errorf("invalid money for %q: want %d, got %d", test.in, test.want, m)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1010, "10.10"},
+		{Points(-3), "-3.00"},
+	}
+
+	for _, test := range tests {
+		if test.in.String() != test.want {
+			t.Errorf("invalid string for %d: want %s, got %s", test.in, test.want, test.in.String())
+		}
+	}
+}
+
+func TestMoneySplit(t *testing.T) {
+	tests := []struct {
+		in      Money
+		n       int
+		weights []int64
+		want    []Money
+	}{
+		{Points(10), 3, nil, []Money{333, 333, 334}},
+		{Points(-10), 3, nil, []Money{-333, -333, -334}},
+		{Points(10), 0, []int64{70, 20, 10}, []Money{700, 200, 100}},
+		{1, 0, []int64{1, 1}, []Money{0, 1}},
+		{Points(1), 0, []int64{0, 0}, []Money{0, 100}},
+	}
+
+	for _, test := range tests {
+		var parts []Money
+		if test.weights == nil {
+			parts = test.in.Split(test.n)
+		} else {
+			parts = test.in.Allocate(test.weights)
+		}
+		if !reflect.DeepEqual(parts, test.want) {
+			t.Errorf("invalid parts for %s: want %v, got %v", test.in, test.want, parts)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	// NOTE: the old dumps contain float64 values
+	var player Player
+	if err := json.Unmarshal([]byte(`{"id":"p","balance":9.899999999999999}`), &player); err != nil {
+		t.Fatalf("can't unmarshal player: %+v", err)
+	}
+	if player.GetBalance() != 990 {
+		t.Errorf("invalid balance: want %d, got %d", 990, player.GetBalance())
+	}
+	fund := Fund{"p": MustParseMoney("-3.34")}
+	b, err := json.Marshal(fund)
+	if err != nil {
+		t.Fatalf("can't marshal fund: %+v", err)
+	}
+	if string(b) != `{"p":-3.34}` {
+		t.Errorf("invalid json: want %s, got %s", `{"p":-3.34}`, b)
+	}
+	var rfund Fund
+	if err := json.Unmarshal(b, &rfund); err != nil || !reflect.DeepEqual(rfund, fund) {
+		t.Errorf("invalid fund: want %v, got %v: %+v", fund, rfund, err)
+	}
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type PayoutType string
+
+const (
+	// the prize pool is shared by the places percentage table
+	PayoutPercent PayoutType = "percent"
+	// the first place takes all
+	PayoutWinnerTakesAll PayoutType = "wta"
+	// the prize pool is shared equally by the top places
+	PayoutFlat PayoutType = "flat"
+)
+
+// Payout is a prize structure of the tournament
+type Payout struct {
+	Type PayoutType `json:"type"`
+	// percents by place for the percent payout
+	Places []Percent `json:"places,omitempty"`
+	// number of the paid places for the flat payout
+	Top int `json:"top,omitempty"`
+}
+
+// ParsePayout parses the payout structure, e.g. wta, flat:3 or percent:50,30,20
+func ParsePayout(s string) (*Payout, error) {
+	parts := strings.SplitN(s, ":", 2)
+	payout := &Payout{Type: PayoutType(parts[0])}
+	switch payout.Type {
+	case PayoutWinnerTakesAll:
+		if len(parts) > 1 {
+			return nil, fmt.Errorf("invalid payout %q: unexpected parameters", s)
+		}
+	case PayoutFlat:
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid payout %q: places number not passed", s)
+		}
+		top, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid payout %q: %+v", s, err)
+		}
+		payout.Top = top
+	case PayoutPercent:
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid payout %q: places percents not passed", s)
+		}
+		for _, place := range strings.Split(parts[1], ",") {
+			percent, err := ParsePercent(place)
+			if err != nil {
+				return nil, fmt.Errorf("invalid payout %q: %+v", s, err)
+			}
+			payout.Places = append(payout.Places, percent)
+		}
+	default:
+		return nil, fmt.Errorf("invalid payout %q: unknown type", s)
+	}
+	if err := payout.Validate(); err != nil {
+		return nil, err
+	}
+	return payout, nil
+}
+
+func (p *Payout) Validate() error {
+	switch p.Type {
+	case PayoutWinnerTakesAll:
+	case PayoutFlat:
+		if p.Top <= 0 {
+			return fmt.Errorf("invalid payout: %d places paid", p.Top)
+		}
+	case PayoutPercent:
+		var total Percent
+		for _, percent := range p.Places {
+			if percent <= 0 {
+				return fmt.Errorf("invalid payout: place percent %s", percent)
+			}
+			total += percent
+		}
+		if total != Hundred {
+			return fmt.Errorf("invalid payout: places percents sum %s isn't %s", total, Hundred)
+		}
+	default:
+		return fmt.Errorf("invalid payout: unknown type %s", p.Type)
+	}
+	return nil
+}
+
+// PaidPlaces returns the number of the paid places for the entrants number
+func (p *Payout) PaidPlaces(entrants int) int {
+	places := 1
+	switch p.Type {
+	case PayoutFlat:
+		places = p.Top
+	case PayoutPercent:
+		places = len(p.Places)
+	}
+	if places > entrants {
+		places = entrants
+	}
+	return places
+}
+
+// Prizes shares the prize pool by the paid places, the rounding remainder goes to the first place,
+// if there are less entrants than the paid places, the pool is shared by the first places only
+func (p *Payout) Prizes(pool Money, entrants int) []Money {
+	places := p.PaidPlaces(entrants)
+	if places <= 0 {
+		return nil
+	}
+
+	weights := make([]int64, places)
+	for i := range weights {
+		weights[i] = 1
+		if p.Type == PayoutPercent {
+			weights[i] = int64(p.Places[i])
+		}
+	}
+	// NOTE: Allocate places the remainder last
+	for i, j := 0, len(weights)-1; i < j; i, j = i+1, j-1 {
+		weights[i], weights[j] = weights[j], weights[i]
+	}
+	prizes := pool.Allocate(weights)
+	for i, j := 0, len(prizes)-1; i < j; i, j = i+1, j-1 {
+		prizes[i], prizes[j] = prizes[j], prizes[i]
+	}
+	return prizes
+}
+
+func (p *Payout) String() string {
+	switch p.Type {
+	case PayoutFlat:
+		return fmt.Sprintf("%s:%d", p.Type, p.Top)
+	case PayoutPercent:
+		var places []string
+		for _, percent := range p.Places {
+			places = append(places, percent.String())
+		}
+		return fmt.Sprintf("%s:%s", p.Type, strings.Join(places, ","))
+	}
+	return string(p.Type)
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPayoutParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *Payout
+		wantErr bool
+	}{
+		{"", nil, true},
+		{"qwe", nil, true},
+		{"wta:1", nil, true},
+		{"flat", nil, true},
+		{"flat:0", nil, true},
+		{"flat:qwe", nil, true},
+		{"percent", nil, true},
+		{"percent:50,30", nil, true},
+		{"percent:50,50,0", nil, true},
+		{"wta", &Payout{Type: PayoutWinnerTakesAll}, false},
+		{"flat:3", &Payout{Type: PayoutFlat, Top: 3}, false},
+		{"percent:50,30%,20", &Payout{Type: PayoutPercent, Places: []Percent{5000, 3000, 2000}}, false},
+	}
+
+	for _, test := range tests {
+		payout, err := ParsePayout(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("invalid error for %q: %+v", test.in, err)
+		}
+		if !reflect.DeepEqual(payout, test.want) {
+			t.Errorf("invalid payout for %q: want %+v, got %+v", test.in, test.want, payout)
+		}
+	}
+}
+
+func TestPayoutPrizes(t *testing.T) {
+	tests := []struct {
+		payout   string
+		pool     Money
+		entrants int
+		want     []Money
+	}{
+		{"wta", Points(10), 0, nil},
+		{"wta", Points(10), 5, []Money{Points(10)}},
+		{"flat:3", Points(10), 5, []Money{334, 333, 333}},
+		{"flat:3", Points(10), 2, []Money{Points(5), Points(5)}},
+		{"percent:50,30,20", MustParseMoney("10.01"), 5, []Money{501, 300, 200}},
+		{"percent:50,30,20", Points(16), 2, []Money{Points(10), Points(6)}},
+	}
+
+	for _, test := range tests {
+		payout, _ := ParsePayout(test.payout)
+		if prizes := payout.Prizes(test.pool, test.entrants); !reflect.DeepEqual(prizes, test.want) {
+			t.Errorf("invalid prizes for %s, pool %s and %d entrants: want %v, got %v",
+				test.payout, test.pool, test.entrants, test.want, prizes)
+		}
+	}
+}
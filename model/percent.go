@@ -0,0 +1,64 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Percent is a fixed-point percent stored in hundredths of a percent
+type Percent int64
+
+const (
+	percentScale int   = 2
+	percentUnit  int64 = 100
+
+	// 100%
+	Hundred Percent = Percent(100 * percentUnit)
+)
+
+// ParsePercent parses a decimal percent with an optional percent sign, e.g. 12.5%
+func ParsePercent(s string) (Percent, error) {
+	return parsePercent(strings.TrimSuffix(strings.TrimSpace(s), "%"), 1)
+}
+
+// ParseRatio parses a decimal ratio as percent, e.g. 1.2 is 120%
+func ParseRatio(s string) (Percent, error) {
+	return parsePercent(strings.TrimSpace(s), 100)
+}
+
+func parsePercent(s string, factor int64) (Percent, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.Trim(s, "0123456789.") != "" {
+		return 0, fmt.Errorf("invalid percent %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(percentUnit*factor))
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return 0, fmt.Errorf("invalid percent %q: more than %d decimal places", s, percentScale)
+	}
+	return Percent(r.Num().Int64()), nil
+}
+
+// Of returns the percent of the money rounded toward zero
+func (p Percent) Of(m Money) Money {
+	part := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(p)))
+	part.Quo(part, big.NewInt(int64(Hundred)))
+	return Money(part.Int64())
+}
+
+func (p Percent) String() string {
+	return fmt.Sprintf("%d.%0*d%%", int64(p)/percentUnit, percentScale, int64(p)%percentUnit)
+}
+
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%s"`, p)), nil
+}
+
+func (p *Percent) UnmarshalJSON(b []byte) error {
+	percent, err := ParsePercent(strings.Trim(string(b), `"`))
+	if err != nil {
+		return err
+	}
+	*p = percent
+	return nil
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Percent
+		wantErr bool
+	}{
+		{"", 0, true},
+		{"%", 0, true},
+		{"qwe", 0, true},
+		{"-10%", 0, true},
+		{"1e2%", 0, true},
+		{"12.345%", 0, true},
+		{"70%", 7000, false},
+		{"12.5", 1250, false},
+		{"100%", Hundred, false},
+	}
+
+	for _, test := range tests {
+		p, err := ParsePercent(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("invalid error for %q: %+v", test.in, err)
+		}
+		if err == nil && p != test.want {
+			t.Errorf("invalid percent for %q: want %d, got %d", test.in, test.want, p)
+		}
+	}
+
+	if part := Percent(3333).Of(Points(10)); part != 333 {
+		t.Errorf("invalid part: want %d, got %d", 333, part)
+	}
+	if part := Percent(5000).Of(Points(-3)); part != -150 {
+		t.Errorf("invalid part: want %d, got %d", -150, part)
+	}
+
+	b, err := json.Marshal(Percent(1250))
+	if err != nil || string(b) != `"12.50%"` {
+		t.Errorf("invalid json: want %s, got %s: %+v", `"12.50%"`, b, err)
+	}
+	var p Percent
+	if err := json.Unmarshal([]byte(`"12.5%"`), &p); err != nil || p != 1250 {
+		t.Errorf("invalid percent: want %d, got %d: %+v", 1250, p, err)
+	}
+}
+
+func TestPercentRatio(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Percent
+		wantErr bool
+	}{
+		{"", 0, true},
+		{"1.2%", 0, true},
+		{"1.00001", 0, true},
+		{"1", Hundred, false},
+		{"1.2", 12000, false},
+		{"1.0525", 10525, false},
+	}
+
+	for _, test := range tests {
+		p, err := ParseRatio(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("invalid error for %q: %+v", test.in, err)
+		}
+		if err == nil && p != test.want {
+			t.Errorf("invalid percent for %q: want %d, got %d", test.in, test.want, p)
+		}
+	}
+}
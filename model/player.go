@@ -2,18 +2,23 @@ package model
 
 import (
 	"fmt"
-	"sync"
-
-	"github.com/cnaize/lifland/util"
+	"strings"
 )
 
 // NOTE:
-// fields open only for marshaling, don't use it directly
+// fields open only for marshaling, don't use it directly,
+// the player is a value guarded by DB, it isn't thread safe
 type Player struct {
-	Id string `json:"id"`
+	Id      string `json:"id"`
+	Balance Money  `json:"balance"`
+}
 
-	mu      sync.Mutex
-	Balance float64 `json:"balance"`
+// ValidatePlayerId rejects the empty id and the id with '#', which separates the entry number in the entry keys
+func ValidatePlayerId(id string) error {
+	if id == "" || strings.Contains(id, "#") {
+		return fmt.Errorf("invalid player id %q", id)
+	}
+	return nil
 }
 
 func NewPlayer(id string) *Player {
@@ -27,27 +32,21 @@ func (p *Player) GetId() string {
 	return p.Id
 }
 
-func (p *Player) IncrBalance(points float64) error {
-	if points == 0.0 {
+func (p *Player) IncrBalance(points Money) error {
+	if points == 0 {
 		return nil
 	}
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	fmt.Printf("player %s: increasing balance %f by %f points\n",
+	fmt.Printf("player %s: increasing balance %s by %s points\n",
 		p.Id, p.Balance, points)
-	if util.Round(p.Balance+points) < 0 {
-		return fmt.Errorf("player %s can't apply increasing balance %f by %f points",
+	if p.Balance+points < 0 {
+		return fmt.Errorf("player %s can't apply increasing balance %s by %s points",
 			p.Id, p.Balance, points)
 	}
 	p.Balance += points
 	return nil
 }
 
-func (p *Player) GetBalance() float64 {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
+func (p *Player) GetBalance() Money {
 	return p.Balance
 }
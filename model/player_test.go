@@ -4,23 +4,23 @@ import "testing"
 
 func TestPlayer(t *testing.T) {
 	player := NewPlayer("new")
-	player.IncrBalance(5)
-	if player.GetBalance() != 5.0 {
-		t.Errorf("invalid balance: want %f, got %f", 5.0, player.GetBalance())
+	player.IncrBalance(Points(5))
+	if player.GetBalance() != Points(5) {
+		t.Errorf("invalid balance: want %s, got %s", Points(5), player.GetBalance())
 	}
-	if err := player.IncrBalance(-10); err == nil {
+	if err := player.IncrBalance(-Points(10)); err == nil {
 		t.Errorf("invalid incr no errors")
 	}
-	player.IncrBalance(5)
-	if player.GetBalance() != 10.0 {
-		t.Errorf("invalid balance: want %f, got %f", 10.0, player.GetBalance())
+	player.IncrBalance(Points(5))
+	if player.GetBalance() != Points(10) {
+		t.Errorf("invalid balance: want %s, got %s", Points(10), player.GetBalance())
 	}
-	player.IncrBalance(0)
-	if player.GetBalance() != 10.0 {
-		t.Errorf("invalid balance: want %f, got %f", 10.0, player.GetBalance())
+	player.IncrBalance(Points(0))
+	if player.GetBalance() != Points(10) {
+		t.Errorf("invalid balance: want %s, got %s", Points(10), player.GetBalance())
 	}
-	player.IncrBalance(-10.0)
-	if player.GetBalance() != 0.0 {
-		t.Errorf("invalid balance: want %f, got %f", 0.0, player.GetBalance())
+	player.IncrBalance(-Points(10))
+	if player.GetBalance() != Points(0) {
+		t.Errorf("invalid balance: want %s, got %s", Points(0), player.GetBalance())
 	}
 }
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// Response is a stored response of the mutating request,
+// it's returned again when the request is retried with the same idempotency key
+type Response struct {
+	Path string `json:"path"`
+	// hash of the request params, the retry with other params is rejected, see Matches
+	Params      string    `json:"params,omitempty"`
+	Code        int       `json:"code"`
+	ContentType string    `json:"contentType,omitempty"`
+	Body        string    `json:"body,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+func NewResponse(path, params string, code int, contentType, body string) *Response {
+	return &Response{
+		Path:        path,
+		Params:      params,
+		Code:        code,
+		ContentType: contentType,
+		Body:        body,
+		Time:        time.Now(),
+	}
+}
+
+// Matches reports whether the request is the retry of the stored one,
+// the responses stored before the params hash match any params
+func (r *Response) Matches(path, params string) bool {
+	return r.Path == path && (r.Params == "" || r.Params == params)
+}
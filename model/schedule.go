@@ -0,0 +1,36 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Schedule is the tournament timetable, the transitions are made by the server scheduler
+type Schedule struct {
+	// registration opens at the time, it's opened on announce if not set
+	Registration time.Time `json:"registration"`
+	Start        time.Time `json:"start"`
+	// the players can join the running tournament until the time, no late registration if not set
+	LateRegistration time.Time `json:"lateRegistration"`
+}
+
+func (s Schedule) Validate() error {
+	if s.Start.IsZero() {
+		return fmt.Errorf("invalid schedule: start time not set")
+	}
+	if !s.Registration.IsZero() && s.Registration.After(s.Start) {
+		return fmt.Errorf("invalid schedule: registration %s after start %s", s.Registration, s.Start)
+	}
+	if !s.LateRegistration.IsZero() && s.LateRegistration.Before(s.Start) {
+		return fmt.Errorf("invalid schedule: late registration %s before start %s", s.LateRegistration, s.Start)
+	}
+	return nil
+}
+
+// JoinUntil returns the time the joins are closed
+func (s Schedule) JoinUntil() time.Time {
+	if !s.LateRegistration.IsZero() {
+		return s.LateRegistration
+	}
+	return s.Start
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		schedule Schedule
+		wantErr  bool
+	}{
+		{Schedule{}, true},
+		{Schedule{Start: now}, false},
+		{Schedule{Registration: now.Add(time.Hour), Start: now}, true},
+		{Schedule{Start: now, LateRegistration: now.Add(-time.Hour)}, true},
+		{Schedule{Registration: now.Add(-time.Hour), Start: now, LateRegistration: now.Add(time.Hour)}, false},
+	}
+
+	for i, test := range tests {
+		if err := test.schedule.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("invalid error for test %d: %+v", i, err)
+		}
+	}
+}
+
+func TestTournamentSchedule(t *testing.T) {
+	now := time.Now()
+	tourn := NewTournament(1, Points(10))
+	if _, ok := tourn.Due(now); ok {
+		t.Errorf("tournament without schedule is due")
+	}
+	tourn.SetSchedule(Schedule{
+		Registration:     now.Add(time.Minute),
+		Start:            now.Add(time.Hour),
+		LateRegistration: now.Add(2 * time.Hour),
+	})
+	if !tourn.GetStartTime().Equal(now.Add(time.Hour)) {
+		t.Errorf("start time isn't scheduled")
+	}
+
+	tests := []struct {
+		now       time.Time
+		wantState TournamentState
+		wantDue   bool
+	}{
+		{now, "", false},
+		{now.Add(time.Minute), StateRegistration, true},
+		{now.Add(time.Hour), StateRunning, true},
+		{now.Add(2 * time.Hour), "", false},
+	}
+	for i, test := range tests {
+		state, ok := tourn.Due(test.now)
+		if ok != test.wantDue || state != test.wantState {
+			t.Errorf("invalid due state for test %d: want %s, got %s", i, test.wantState, state)
+		}
+		if ok {
+			tourn.transit(state)
+		}
+	}
+	// the late registration is open
+	if err := tourn.CanJoin(); err != nil {
+		t.Errorf("can't join running tournament with late registration: %+v", err)
+	}
+
+	tourn = NewTournament(2, Points(10))
+	tourn.SetSchedule(Schedule{Start: now.Add(-time.Minute)})
+	tourn.OpenRegistration()
+	if err := tourn.CanJoin(); err == nil {
+		t.Errorf("joined tournament after start time")
+	}
+}
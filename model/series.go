@@ -0,0 +1,226 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formula awards the ranking points by the field size and the finishing place
+type Formula struct {
+	kind  string
+	table []int64
+	scale float64
+}
+
+// ParseFormula parses the ranking points formula:
+// linear - the field size minus the place plus one,
+// table:100,60,40 - the points by place, nothing for the places below,
+// sqrt:10 - the scale multiplied by the square root of the field size divided by the place square root
+func ParseFormula(s string) (*Formula, error) {
+	parts := strings.SplitN(s, ":", 2)
+	f := Formula{kind: parts[0]}
+	switch {
+	case f.kind == "linear" && len(parts) == 1:
+	case f.kind == "table" && len(parts) == 2:
+		for _, p := range strings.Split(parts[1], ",") {
+			points, err := strconv.ParseInt(p, 10, 64)
+			if err != nil || points < 0 {
+				return nil, fmt.Errorf("invalid formula %q points %s", s, p)
+			}
+			f.table = append(f.table, points)
+		}
+	case f.kind == "sqrt" && len(parts) == 2:
+		scale, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || scale <= 0 || math.IsInf(scale, 0) {
+			return nil, fmt.Errorf("invalid formula %q scale %s", s, parts[1])
+		}
+		f.scale = scale
+	default:
+		return nil, fmt.Errorf("invalid formula %q", s)
+	}
+	return &f, nil
+}
+
+// Points returns the ranking points of the place starting from one
+func (f *Formula) Points(entrants, place int) int64 {
+	if place <= 0 || place > entrants {
+		return 0
+	}
+	switch f.kind {
+	case "linear":
+		return int64(entrants - place + 1)
+	case "table":
+		if place <= len(f.table) {
+			return f.table[place-1]
+		}
+	case "sqrt":
+		return int64(math.Round(f.scale * math.Sqrt(float64(entrants)) / math.Sqrt(float64(place))))
+	}
+	return 0
+}
+
+// Standing is the player position in the series
+type Standing struct {
+	// the players with equal points share the rank
+	Rank        int    `json:"rank"`
+	PlayerId    string `json:"playerId"`
+	Points      int64  `json:"points"`
+	Tournaments int    `json:"tournaments"`
+}
+
+// NOTE:
+// fields opened only for marshaling, don't use it directly
+type Series struct {
+	Id      string `json:"id"`
+	Formula string `json:"formula"`
+	// season prizes by the standings position paid by the house
+	Prizes []Money `json:"prizes,omitempty"`
+
+	mu sync.Mutex
+	// the standings are frozen at the payout
+	PaidAt time.Time `json:"paidAt"`
+}
+
+func NewSeries(id, formula string, prizes []Money) (*Series, error) {
+	if id == "" {
+		return nil, fmt.Errorf("empty series id")
+	}
+	if _, err := ParseFormula(formula); err != nil {
+		return nil, err
+	}
+	for _, prize := range prizes {
+		if prize <= 0 {
+			return nil, fmt.Errorf("invalid series prize %s", prize)
+		}
+	}
+	fmt.Printf("creating series %s, formula: %s\n", id, formula)
+	return &Series{
+		Id:      id,
+		Formula: formula,
+		Prizes:  prizes,
+	}, nil
+}
+
+func (s *Series) GetId() string {
+	return s.Id
+}
+
+func (s *Series) GetFormula() string {
+	return s.Formula
+}
+
+func (s *Series) GetPrizes() []Money {
+	return append([]Money{}, s.Prizes...)
+}
+
+// Clone returns the copy of the series
+func (s *Series) Clone() *Series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &Series{
+		Id:      s.Id,
+		Formula: s.Formula,
+		Prizes:  append([]Money(nil), s.Prizes...),
+		PaidAt:  s.PaidAt,
+	}
+}
+
+func (s *Series) GetPaidAt() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.PaidAt, !s.PaidAt.IsZero()
+}
+
+// Pay freezes the standings at the time, the series can be paid once
+func (s *Series) Pay(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.PaidAt.IsZero() {
+		return fmt.Errorf("Series %s already paid at %s", s.Id, s.PaidAt)
+	}
+	fmt.Printf("paying series %s\n", s.Id)
+	s.PaidAt = now
+	return nil
+}
+
+// Standings recomputes the standings from the results of the series tournaments finished before the payout,
+// the team places award the points to every team member
+func (s *Series) Standings(tournaments []*Tournament) []Standing {
+	formula, err := ParseFormula(s.Formula)
+	if err != nil {
+		return nil
+	}
+	paidAt, paid := s.GetPaidAt()
+
+	byPlayer := make(map[string]*Standing)
+	for _, t := range tournaments {
+		if t.GetOptions().SeriesId != s.Id || t.GetState() != StateFinished {
+			continue
+		}
+		if finished, _ := t.GetStateTime(StateFinished); paid && finished.After(paidAt) {
+			continue
+		}
+		entrants := t.GetEntrants()
+		for i, key := range t.GetPlaces() {
+			playerIds := []string{key}
+			if team, ok := t.GetTeam(key); ok {
+				playerIds = team.Members
+			}
+			for _, id := range playerIds {
+				standing, ok := byPlayer[id]
+				if !ok {
+					standing = &Standing{PlayerId: id}
+					byPlayer[id] = standing
+				}
+				standing.Points += formula.Points(entrants, i+1)
+				standing.Tournaments++
+			}
+		}
+	}
+
+	standings := make([]Standing, 0, len(byPlayer))
+	for _, standing := range byPlayer {
+		standings = append(standings, *standing)
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Points != standings[j].Points {
+			return standings[i].Points > standings[j].Points
+		}
+		return standings[i].PlayerId < standings[j].PlayerId
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+		if i > 0 && standings[i].Points == standings[i-1].Points {
+			standings[i].Rank = standings[i-1].Rank
+		}
+	}
+	return standings
+}
+
+// Payouts returns the season prizes by player, the tied players share the prizes of their positions
+func (s *Series) Payouts(standings []Standing) map[string]Money {
+	payouts := make(map[string]Money)
+	for i := 0; i < len(standings) && i < len(s.Prizes); {
+		j := i
+		for j < len(standings) && standings[j].Rank == standings[i].Rank {
+			j++
+		}
+		var prize Money
+		for k := i; k < j && k < len(s.Prizes); k++ {
+			prize += s.Prizes[k]
+		}
+		for k, part := range prize.Split(j - i) {
+			payouts[standings[i+k].PlayerId] = part
+		}
+		i = j
+	}
+	return payouts
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormula(t *testing.T) {
+	tests := []struct {
+		formula  string
+		entrants int
+		place    int
+		want     int64
+		wantErr  bool
+	}{
+		{"qwe", 0, 0, 0, true},
+		{"linear:1", 0, 0, 0, true},
+		{"table:10,-1", 0, 0, 0, true},
+		{"sqrt:0", 0, 0, 0, true},
+		{"linear", 10, 1, 10, false},
+		{"linear", 10, 10, 1, false},
+		{"linear", 10, 11, 0, false},
+		{"table:100,60,40", 10, 2, 60, false},
+		{"table:100,60,40", 10, 4, 0, false},
+		{"sqrt:10", 100, 4, 50, false},
+		{"sqrt:10", 10, 3, 18, false},
+	}
+	for i, test := range tests {
+		f, err := ParseFormula(test.formula)
+		if (err != nil) != test.wantErr {
+			t.Errorf("invalid error for test %d: %+v", i, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if points := f.Points(test.entrants, test.place); points != test.want {
+			t.Errorf("invalid points for test %d: want %d, got %d", i, test.want, points)
+		}
+	}
+}
+
+func TestSeriesStandings(t *testing.T) {
+	series, err := NewSeries("S", "linear", []Money{Points(10), Points(5)})
+	if err != nil {
+		t.Fatalf("can't create series: %+v", err)
+	}
+
+	var tournaments []*Tournament
+	for i, places := range [][]string{{"30", "20"}, {"10"}, {"10"}} {
+		tourn := NewTournament(i+1, Points(5))
+		seriesId := "S"
+		if i == 2 {
+			seriesId = "other"
+		}
+		tourn.SetOptions(TournamentOptions{SeriesId: seriesId})
+		tourn.OpenRegistration()
+		for _, id := range []string{"10", "20", "30"}[:3-i] {
+			tourn.AddPlayer(id, Fund{id: Points(-5)})
+		}
+		tourn.Start()
+		tourn.Close()
+		tourn.FinishWithPlaces(places)
+		tournaments = append(tournaments, tourn)
+	}
+	// the running tournament isn't counted
+	running := NewTournament(4, Points(5))
+	running.SetOptions(TournamentOptions{SeriesId: "S"})
+	tournaments = append(tournaments, running)
+
+	standings := series.Standings(tournaments)
+	want := []Standing{
+		{Rank: 1, PlayerId: "30", Points: 3, Tournaments: 1},
+		{Rank: 2, PlayerId: "10", Points: 2, Tournaments: 1},
+		{Rank: 2, PlayerId: "20", Points: 2, Tournaments: 1},
+	}
+	if len(standings) != len(want) {
+		t.Fatalf("invalid standings: %+v", standings)
+	}
+	for i := range want {
+		if standings[i] != want[i] {
+			t.Errorf("invalid standing %d: want %+v, got %+v", i, want[i], standings[i])
+		}
+	}
+
+	// the tied players share the prizes of their positions
+	payouts := series.Payouts(standings)
+	if len(payouts) != 3 || payouts["30"] != Points(10) ||
+		payouts["10"] != MustParseMoney("2.5") || payouts["20"] != MustParseMoney("2.5") {
+		t.Errorf("invalid payouts: %+v", payouts)
+	}
+
+	if err := series.Pay(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("can't pay series: %+v", err)
+	}
+	if err := series.Pay(time.Now()); err == nil {
+		t.Errorf("paid series twice")
+	}
+	// the standings are frozen at the payout
+	if standings := series.Standings(tournaments); len(standings) != 0 {
+		t.Errorf("invalid frozen standings: %+v", standings)
+	}
+}
@@ -0,0 +1,63 @@
+package model
+
+import "fmt"
+
+type TournamentState string
+
+const (
+	StateAnnounced    TournamentState = "announced"
+	StateRegistration TournamentState = "registration"
+	// registration closed, the tournament is running
+	StateRunning   TournamentState = "running"
+	StateSettling  TournamentState = "settling"
+	StateFinished  TournamentState = "finished"
+	StateCancelled TournamentState = "cancelled"
+)
+
+var transitions = map[TournamentState][]TournamentState{
+	StateAnnounced:    {StateRegistration, StateCancelled},
+	StateRegistration: {StateRunning, StateSettling, StateCancelled},
+	StateRunning:      {StateSettling, StateCancelled},
+	StateSettling:     {StateFinished},
+}
+
+func (s TournamentState) CanTransit(to TournamentState) bool {
+	for _, state := range transitions[s] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOpen reports the tournament is started, but not closed yet
+func (s TournamentState) IsOpen() bool {
+	return s == StateRegistration || s == StateRunning
+}
+
+// IsEnded reports the tournament can't change anymore
+func (s TournamentState) IsEnded() bool {
+	return s == StateFinished || s == StateCancelled
+}
+
+// TransitionError is returned on illegal tournament state change
+type TransitionError struct {
+	TournamentId int
+	From         TournamentState
+	To           TournamentState
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("Tournament %d can't change state from %s to %s", e.TournamentId, e.From, e.To)
+}
+
+// StateError is returned when the action isn't allowed in the tournament state
+type StateError struct {
+	TournamentId int
+	State        TournamentState
+	Action       string
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("Tournament %d is %s, can't %s", e.TournamentId, e.State, e.Action)
+}
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Team is the entry of the team tournament, the members share the deposit with the backers,
+// the team id is the entry key
+type Team struct {
+	Id      string   `json:"id"`
+	Members []string `json:"members"`
+}
+
+func (t Team) Validate(size int) error {
+	if t.Id == "" || strings.Contains(t.Id, "#") {
+		return fmt.Errorf("invalid team id %q", t.Id)
+	}
+	if len(t.Members) == 0 || len(t.Members) > size {
+		return fmt.Errorf("invalid team %s members number %d, max %d", t.Id, len(t.Members), size)
+	}
+	for i, member := range t.Members {
+		for j, id := range t.Members {
+			if i != j && id == member {
+				return fmt.Errorf("duplicated member %s in team %s", member, t.Id)
+			}
+		}
+	}
+	return nil
+}
+
+// AddTeam registers the team, the fund must contain all the team members
+func (t *Tournament) AddTeam(team Team, fund Fund) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.canJoin(); err != nil {
+		return err
+	}
+	if t.isFull() {
+		return fmt.Errorf("Team %s can't join full tournament %d", team.Id, t.Id)
+	}
+	if _, ok := t.Funds[team.Id]; ok {
+		return fmt.Errorf("Team %s already joined tournament %d", team.Id, t.Id)
+	}
+	if err := t.checkTeam(team, fund); err != nil {
+		return err
+	}
+
+	fmt.Printf("team %s joined tournament %d\n", team.Id, t.Id)
+	t.Funds[team.Id] = fund
+	if t.Teams == nil {
+		t.Teams = make(map[string]Team)
+	}
+	t.Teams[team.Id] = team
+	return nil
+}
+
+// AmendTeam replaces the team members and fund before the tournament start,
+// the passed old fund must be the current one, so the concurrent amends don't lose refunds
+func (t *Tournament) AmendTeam(team Team, fund, old Fund) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.State != StateRegistration {
+		return &StateError{TournamentId: t.Id, State: t.State, Action: "amend team"}
+	}
+	current, ok := t.Teams[team.Id]
+	if !ok {
+		return fmt.Errorf("Team %s didn't join tournament %d", team.Id, t.Id)
+	}
+	if !equalFunds(t.Funds[team.Id], old) {
+		return fmt.Errorf("Team %s fund changed in tournament %d", team.Id, t.Id)
+	}
+	if err := t.checkTeam(team, fund); err != nil {
+		return err
+	}
+
+	fmt.Printf("team %s amended in tournament %d, members: %v -> %v\n",
+		team.Id, t.Id, current.Members, team.Members)
+	t.Funds[team.Id] = fund
+	delete(t.Stakes, team.Id)
+	t.Teams[team.Id] = team
+	return nil
+}
+
+func (t *Tournament) GetTeam(id string) (Team, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	team, ok := t.Teams[id]
+	if !ok {
+		return Team{}, false
+	}
+	return Team{Id: team.Id, Members: append([]string{}, team.Members...)}, true
+}
+
+// GetTeams returns the tournament teams ordered by id
+func (t *Tournament) GetTeams() []Team {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	teams := []Team{}
+	for _, team := range t.Teams {
+		teams = append(teams, Team{Id: team.Id, Members: append([]string{}, team.Members...)})
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		return teams[i].Id < teams[j].Id
+	})
+	return teams
+}
+
+// NOTE: not thread safe
+func (t *Tournament) checkTeam(team Team, fund Fund) error {
+	if t.TeamSize == 0 {
+		return fmt.Errorf("Tournament %d isn't a team tournament", t.Id)
+	}
+	if err := team.Validate(t.TeamSize); err != nil {
+		return err
+	}
+	for _, member := range team.Members {
+		if _, ok := fund[member]; !ok {
+			return fmt.Errorf("Member %s doesn't pay team %s deposit", member, team.Id)
+		}
+		for id, other := range t.Teams {
+			if id == team.Id {
+				continue
+			}
+			for _, otherMember := range other.Members {
+				if otherMember == member {
+					return fmt.Errorf("Member %s already in team %s", member, id)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func equalFunds(a, b Fund) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, income := range a {
+		if other, ok := b[id]; !ok || other != income {
+			return false
+		}
+	}
+	return true
+}
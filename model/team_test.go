@@ -0,0 +1,57 @@
+package model
+
+import "testing"
+
+func TestTournamentTeam(t *testing.T) {
+	tourn := NewTournament(1, Points(10))
+	tourn.SetOptions(TournamentOptions{TeamSize: 2, MaxPlayers: 2})
+	tourn.OpenRegistration()
+	if err := tourn.AddPlayer("10", Fund{"10": Points(-10)}); err == nil {
+		t.Errorf("player joined team tournament without team")
+	}
+
+	tests := []struct {
+		team    Team
+		fund    Fund
+		wantErr bool
+	}{
+		{Team{Id: "A#2", Members: []string{"10"}}, Fund{"10": Points(-10)}, true},
+		{Team{Id: "A", Members: []string{"10", "10"}}, Fund{"10": Points(-10)}, true},
+		{Team{Id: "A", Members: []string{"10", "20"}}, Fund{"10": Points(-10)}, true},
+		{Team{Id: "A", Members: []string{"10", "20"}}, Fund{"10": Points(-5), "20": Points(-5)}, false},
+		{Team{Id: "A", Members: []string{"30"}}, Fund{"30": Points(-10)}, true},
+		{Team{Id: "B", Members: []string{"20"}}, Fund{"20": Points(-10)}, true},
+		{Team{Id: "B", Members: []string{"30"}}, Fund{"30": Points(-4), "40": Points(-6)}, false},
+		{Team{Id: "C", Members: []string{"50"}}, Fund{"50": Points(-10)}, true},
+	}
+	for i, test := range tests {
+		if err := tourn.AddTeam(test.team, test.fund); (err != nil) != test.wantErr {
+			t.Errorf("invalid error for test %d: %+v", i, err)
+		}
+	}
+
+	team := Team{Id: "A", Members: []string{"20"}}
+	if err := tourn.AmendTeam(team, Fund{"20": Points(-10)}, Fund{"10": Points(-10)}); err == nil {
+		t.Errorf("amended team with stale fund")
+	}
+	if err := tourn.AmendTeam(team, Fund{"20": Points(-10)}, Fund{"10": Points(-5), "20": Points(-5)}); err != nil {
+		t.Fatalf("can't amend team: %+v", err)
+	}
+	if team, ok := tourn.GetTeam("A"); !ok || len(team.Members) != 1 || team.Members[0] != "20" {
+		t.Errorf("invalid amended team: %+v", team)
+	}
+	if entrants := tourn.GetEntrants(); entrants != 2 {
+		t.Errorf("invalid entrants: want 2, got %d", entrants)
+	}
+
+	if _, err := tourn.Remove("B"); err != nil {
+		t.Fatalf("can't remove team: %+v", err)
+	}
+	if teams := tourn.GetTeams(); len(teams) != 1 || teams[0].Id != "A" {
+		t.Errorf("invalid teams: %+v", teams)
+	}
+	tourn.Start()
+	if err := tourn.AmendTeam(team, Fund{"20": Points(-10)}, Fund{"20": Points(-10)}); err == nil {
+		t.Errorf("amended team after start")
+	}
+}
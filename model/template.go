@@ -0,0 +1,145 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultTemplateAhead = 24 * time.Hour
+
+// TemplateSettings are the settings of the tournaments created by the template
+type TemplateSettings struct {
+	Deposit Money `json:"deposit"`
+	TournamentOptions
+	// start time recurrence in the cron format, see Cron
+	Recurrence string `json:"recurrence"`
+	// registration opens the time before the start, on the tournament creation if not set
+	RegistrationBefore time.Duration `json:"registrationBefore,omitempty"`
+	// late registration lasts the time after the start, no late registration if not set
+	LateRegistration time.Duration `json:"lateRegistration,omitempty"`
+	// the tournaments are created the time before the start, one day if not set
+	Ahead time.Duration `json:"ahead,omitempty"`
+}
+
+func (s TemplateSettings) Validate() error {
+	if s.Deposit <= 0 {
+		return fmt.Errorf("invalid deposit %s", s.Deposit)
+	}
+	if err := s.TournamentOptions.Validate(); err != nil {
+		return err
+	}
+	if _, err := ParseCron(s.Recurrence); err != nil {
+		return err
+	}
+	if s.RegistrationBefore < 0 || s.LateRegistration < 0 || s.Ahead < 0 {
+		return fmt.Errorf("invalid template durations: registration %s, late registration %s, ahead %s",
+			s.RegistrationBefore, s.LateRegistration, s.Ahead)
+	}
+	return nil
+}
+
+// NOTE:
+// fields opened only for marshaling, don't use it directly
+type Template struct {
+	Id string `json:"id"`
+	TemplateSettings
+
+	mu sync.Mutex
+	// start time of the last created tournament
+	LastStart time.Time `json:"lastStart"`
+}
+
+// NewTemplate returns the template creating the tournaments started after now
+func NewTemplate(id string, settings TemplateSettings) (*Template, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	fmt.Printf("creating template %s, recurrence: %s\n", id, settings.Recurrence)
+	return &Template{
+		Id:               id,
+		TemplateSettings: settings,
+		LastStart:        time.Now(),
+	}, nil
+}
+
+func (t *Template) GetId() string {
+	return t.Id
+}
+
+func (t *Template) GetSettings() TemplateSettings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.TemplateSettings
+}
+
+// Clone returns the copy of the template
+func (t *Template) Clone() *Template {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	settings := t.TemplateSettings
+	settings.TournamentOptions = t.TournamentOptions.clone()
+	return &Template{
+		Id:               t.Id,
+		TemplateSettings: settings,
+		LastStart:        t.LastStart,
+	}
+}
+
+func (t *Template) SetSettings(settings TemplateSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.TemplateSettings = settings
+	return nil
+}
+
+// Upcoming returns the start times of the tournaments to create at the time,
+// the starts already passed are skipped
+func (t *Template) Upcoming(now time.Time) []time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cron, err := ParseCron(t.Recurrence)
+	if err != nil {
+		return nil
+	}
+	ahead := t.Ahead
+	if ahead == 0 {
+		ahead = defaultTemplateAhead
+	}
+
+	var starts []time.Time
+	for next := cron.Next(t.LastStart); !next.IsZero() && !next.After(now.Add(ahead)); next = cron.Next(next) {
+		t.LastStart = next
+		if next.After(now) {
+			starts = append(starts, next)
+		}
+	}
+	return starts
+}
+
+// NewTournament returns the tournament of the template scheduled to the start time
+func (t *Template) NewTournament(id int, start time.Time) *Tournament {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tournament := NewTournament(id, t.Deposit)
+	tournament.TemplateId = t.Id
+	tournament.SetOptions(t.TournamentOptions)
+	schedule := Schedule{Start: start}
+	if t.RegistrationBefore > 0 {
+		schedule.Registration = start.Add(-t.RegistrationBefore)
+	}
+	if t.LateRegistration > 0 {
+		schedule.LateRegistration = start.Add(t.LateRegistration)
+	}
+	tournament.SetSchedule(schedule)
+	return tournament
+}
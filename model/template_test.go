@@ -0,0 +1,57 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemplate(t *testing.T) {
+	if _, err := NewTemplate("invalid", TemplateSettings{Deposit: Points(10), Recurrence: "qwe"}); err == nil {
+		t.Errorf("template created with invalid recurrence")
+	}
+	if _, err := NewTemplate("invalid", TemplateSettings{Recurrence: "@hourly"}); err == nil {
+		t.Errorf("template created without deposit")
+	}
+
+	template, err := NewTemplate("hourly", TemplateSettings{
+		Deposit:            Points(10),
+		TournamentOptions:  TournamentOptions{MaxPlayers: 9},
+		Recurrence:         "0 * * * *",
+		RegistrationBefore: 30 * time.Minute,
+		LateRegistration:   10 * time.Minute,
+		Ahead:              3 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("can't create template: %+v", err)
+	}
+	now := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	template.LastStart = now.Add(-2 * time.Hour)
+
+	// the passed starts are skipped
+	starts := template.Upcoming(now)
+	want := []time.Time{
+		time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC),
+	}
+	if len(starts) != len(want) {
+		t.Fatalf("invalid upcoming starts: want %v, got %v", want, starts)
+	}
+	for i := range want {
+		if !starts[i].Equal(want[i]) {
+			t.Errorf("invalid upcoming start %d: want %s, got %s", i, want[i], starts[i])
+		}
+	}
+	if starts := template.Upcoming(now); len(starts) != 0 {
+		t.Errorf("upcoming starts created twice: %v", starts)
+	}
+
+	tourn := template.NewTournament(1, want[0])
+	schedule, ok := tourn.GetSchedule()
+	if !ok || !schedule.Registration.Equal(now) || !schedule.LateRegistration.Equal(want[0].Add(10*time.Minute)) {
+		t.Errorf("invalid tournament schedule: %+v", schedule)
+	}
+	if tourn.GetTemplateId() != "hourly" || tourn.GetDeposit() != Points(10) || tourn.GetOptions().MaxPlayers != 9 {
+		t.Errorf("tournament doesn't match template")
+	}
+}
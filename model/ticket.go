@@ -0,0 +1,143 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type TicketState string
+
+const (
+	TicketActive TicketState = "active"
+	// redeemed in the target tournament
+	TicketUsed TicketState = "used"
+	// the value went to the house
+	TicketExpired TicketState = "expired"
+	// the value returned to the player, the target tournament was cancelled
+	TicketConverted TicketState = "converted"
+)
+
+// NOTE:
+// fields opened only for marshaling, don't use it directly
+type Ticket struct {
+	Id       int    `json:"id"`
+	PlayerId string `json:"playerId"`
+	// the satellite the ticket awarded by
+	SourceId int `json:"sourceId"`
+	// the tournament the ticket is redeemable in
+	TournamentId int   `json:"tournamentId"`
+	Value        Money `json:"value"`
+	// the ticket can't be redeemed after the time, no expiry if not set
+	Expires time.Time `json:"expires"`
+
+	mu    sync.Mutex
+	State TicketState `json:"state"`
+}
+
+// NewTicket returns the ticket worth the target tournament deposit, the id is set by DB
+func NewTicket(playerId string, sourceId int, target *Tournament, expires time.Time) *Ticket {
+	fmt.Printf("awarding player %s ticket to tournament %d\n", playerId, target.GetId())
+	return &Ticket{
+		PlayerId:     playerId,
+		SourceId:     sourceId,
+		TournamentId: target.GetId(),
+		Value:        target.GetDeposit(),
+		Expires:      expires,
+		State:        TicketActive,
+	}
+}
+
+func (t *Ticket) GetId() int {
+	return t.Id
+}
+
+func (t *Ticket) GetPlayerId() string {
+	return t.PlayerId
+}
+
+func (t *Ticket) GetSourceId() int {
+	return t.SourceId
+}
+
+func (t *Ticket) GetTournamentId() int {
+	return t.TournamentId
+}
+
+func (t *Ticket) GetValue() Money {
+	return t.Value
+}
+
+func (t *Ticket) GetExpires() time.Time {
+	return t.Expires
+}
+
+func (t *Ticket) GetState() TicketState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.State
+}
+
+// IsExpired reports whether the ticket expires at the time
+func (t *Ticket) IsExpired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// Use redeems the ticket in the tournament
+func (t *Ticket) Use(playerId string, tournamentId int, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.PlayerId != playerId {
+		return fmt.Errorf("ticket %d doesn't belong to player %s", t.Id, playerId)
+	}
+	if t.TournamentId != tournamentId {
+		return fmt.Errorf("ticket %d isn't redeemable in tournament %d", t.Id, tournamentId)
+	}
+	if t.IsExpired(now) {
+		return fmt.Errorf("ticket %d expired at %s", t.Id, t.Expires)
+	}
+	return t.close(TicketUsed)
+}
+
+// Clone returns the copy of the ticket
+func (t *Ticket) Clone() *Ticket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &Ticket{
+		Id:           t.Id,
+		PlayerId:     t.PlayerId,
+		SourceId:     t.SourceId,
+		TournamentId: t.TournamentId,
+		Value:        t.Value,
+		Expires:      t.Expires,
+		State:        t.State,
+	}
+}
+
+// Close makes the active ticket used, expired or converted
+func (t *Ticket) Close(state TicketState) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.close(state)
+}
+
+// Reopen activates the ticket if its value can't be moved
+func (t *Ticket) Reopen() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.State = TicketActive
+}
+
+// NOTE: not thread safe
+func (t *Ticket) close(state TicketState) error {
+	if t.State != TicketActive {
+		return fmt.Errorf("ticket %d is %s", t.Id, t.State)
+	}
+	t.State = state
+	return nil
+}
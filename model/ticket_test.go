@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTicket(t *testing.T) {
+	now := time.Now()
+	target := NewTournament(2, Points(10))
+	ticket := NewTicket("10", 1, target, now.Add(time.Hour))
+	if ticket.GetValue() != Points(10) || ticket.GetState() != TicketActive {
+		t.Fatalf("invalid ticket: %+v", ticket)
+	}
+
+	if err := ticket.Use("20", 2, now); err == nil {
+		t.Errorf("used ticket of another player")
+	}
+	if err := ticket.Use("10", 3, now); err == nil {
+		t.Errorf("used ticket in another tournament")
+	}
+	if err := ticket.Use("10", 2, now.Add(time.Hour)); err == nil {
+		t.Errorf("used expired ticket")
+	}
+	if err := ticket.Use("10", 2, now); err != nil {
+		t.Fatalf("can't use ticket: %+v", err)
+	}
+	if err := ticket.Use("10", 2, now); err == nil {
+		t.Errorf("used ticket twice")
+	}
+	if err := ticket.Close(TicketConverted); err == nil {
+		t.Errorf("converted used ticket")
+	}
+	ticket.Reopen()
+	if err := ticket.Close(TicketExpired); err != nil || ticket.GetState() != TicketExpired {
+		t.Errorf("can't expire ticket: %+v", err)
+	}
+}
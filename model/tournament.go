@@ -6,35 +6,207 @@ import (
 	"time"
 )
 
+// TournamentOptions are the tournament settings passed on announce
+type TournamentOptions struct {
+	// prize structure, the prizes are passed with results if not set
+	Payout *Payout `json:"payout,omitempty"`
+	// house part of the collected deposits, either percent or fixed fee per entry
+	Rake Percent `json:"rake,omitempty"`
+	Fee  Money   `json:"fee,omitempty"`
+	// minimal prize pool, the overlay is paid by the house
+	Guarantee Money `json:"guarantee,omitempty"`
+	// rebuys, re-entries and add-ons allowed per player
+	Limits map[BuyInKind]BuyInLimit `json:"limits,omitempty"`
+	// the players over the max wait for a seat, no limit if not set
+	MaxPlayers int `json:"maxPlayers,omitempty"`
+	// the tournament is cancelled on start with less players
+	MinPlayers int `json:"minPlayers,omitempty"`
+	// deposits part put on the entrant head and collected by the eliminator
+	Bounty Percent `json:"bounty,omitempty"`
+	// the eliminator collects half of the bounty, the rest is added to the eliminator bounty
+	ProgressiveBounty bool `json:"progressiveBounty,omitempty"`
+	// the entries are teams of up to the members number, individual entries if not set
+	TeamSize int `json:"teamSize,omitempty"`
+	// the series the finishing places award the ranking points in
+	SeriesId string `json:"seriesId,omitempty"`
+}
+
+// clone returns the options sharing nothing with o
+func (o TournamentOptions) clone() TournamentOptions {
+	if o.Payout != nil {
+		payout := *o.Payout
+		payout.Places = append([]Percent(nil), o.Payout.Places...)
+		o.Payout = &payout
+	}
+	if o.Limits != nil {
+		limits := make(map[BuyInKind]BuyInLimit, len(o.Limits))
+		for kind, limit := range o.Limits {
+			limits[kind] = limit
+		}
+		o.Limits = limits
+	}
+	return o
+}
+
+func (o TournamentOptions) Validate() error {
+	if o.Payout != nil {
+		if err := o.Payout.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.Rake < 0 || o.Rake > Hundred {
+		return fmt.Errorf("invalid rake %s", o.Rake)
+	}
+	if o.Fee < 0 {
+		return fmt.Errorf("invalid fee %s", o.Fee)
+	}
+	if o.Rake > 0 && o.Fee > 0 {
+		return fmt.Errorf("both rake %s and fee %s set", o.Rake, o.Fee)
+	}
+	if o.Bounty < 0 || o.Rake+o.Bounty > Hundred {
+		return fmt.Errorf("invalid bounty %s with rake %s", o.Bounty, o.Rake)
+	}
+	if o.ProgressiveBounty && o.Bounty == 0 {
+		return fmt.Errorf("progressive bounty without bounty")
+	}
+	if o.TeamSize < 0 {
+		return fmt.Errorf("invalid team size %d", o.TeamSize)
+	}
+	if o.Guarantee < 0 {
+		return fmt.Errorf("invalid guarantee %s", o.Guarantee)
+	}
+	if o.MaxPlayers < 0 || o.MinPlayers < 0 || (o.MaxPlayers > 0 && o.MinPlayers > o.MaxPlayers) {
+		return fmt.Errorf("invalid players limits: min %d, max %d", o.MinPlayers, o.MaxPlayers)
+	}
+	for kind, limit := range o.Limits {
+		if err := kind.Validate(); err != nil {
+			return err
+		}
+		if err := limit.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // NOTE:
 // fields opened only for marshaling, don't use it directly
 type Tournament struct {
-	Id        int       `json:"id"`
-	Deposit   float64   `json:"deposit"`
+	Id      int   `json:"id"`
+	Deposit Money `json:"deposit"`
+	// the scheduled start or the announce time for the tournaments without schedule
 	StartTime time.Time `json:"startTime"`
+	Schedule  *Schedule `json:"schedule,omitempty"`
+	// template the tournament created by
+	TemplateId string `json:"templateId,omitempty"`
+	TournamentOptions
 
-	mu   sync.Mutex
-	Open bool `json:"open"`
-	// backers (including player) and their income by the player id
+	mu sync.Mutex
+	// seats reserved for the waiting players being charged
+	seats int
+	State TournamentState `json:"state"`
+	// time the tournament entered the state
+	StateTimes map[TournamentState]time.Time `json:"stateTimes"`
+	// backers (including player) and their income by the entry key,
+	// the player id is the key of the player first entry
 	Funds map[string]Fund `json:"funds"`
+	// backers (including player) and their share of the action by the entry key,
+	// the shares equal to the paid incomes if not set
+	Stakes map[string]Fund `json:"stakes,omitempty"`
+	// rebuys, re-entries and add-ons by the entry key
+	BuyIns map[string]BuyIn `json:"buyIns,omitempty"`
+	// members of the team tournament entries by the team id
+	Teams map[string]Team `json:"teams,omitempty"`
+	// players waiting for a seat in the joining order
+	Waitlist []Waiting `json:"waitlist,omitempty"`
+	// knockouts of the bounty tournament
+	Eliminations []Elimination `json:"eliminations,omitempty"`
+	// finishing places of the entries set on finish
+	Places       []string `json:"places,omitempty"`
+	CancelReason string   `json:"cancelReason,omitempty"`
 }
 
-func NewTournament(id int, deposit float64) *Tournament {
-	fmt.Printf("creating tournament %d, deposit: %f\n", id, deposit)
+// Waiting is the join of the player deferred until a seat opens,
+// nothing is charged until the player takes the seat
+type Waiting struct {
+	PlayerId string `json:"playerId"`
+	// backers (including player) and their incomes to charge
+	Fund   Fund `json:"fund"`
+	Stakes Fund `json:"stakes,omitempty"`
+}
+
+// NewTournament returns announced tournament, registration should be opened explicitly
+func NewTournament(id int, deposit Money) *Tournament {
+	fmt.Printf("creating tournament %d, deposit: %s\n", id, deposit)
+	now := time.Now()
 	return &Tournament{
-		Id:        id,
-		Deposit:   deposit,
-		StartTime: time.Now(),
-		Open:      true,
-		Funds:     make(map[string]Fund),
+		Id:         id,
+		Deposit:    deposit,
+		StartTime:  now,
+		State:      StateAnnounced,
+		StateTimes: map[TournamentState]time.Time{StateAnnounced: now},
+		Funds:      make(map[string]Fund),
+		Stakes:     make(map[string]Fund),
+	}
+}
+
+// Clone returns the copy of the tournament sharing nothing with it,
+// the seats reserved for the waiting players are copied too
+func (t *Tournament) Clone() *Tournament {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tournament := &Tournament{
+		Id:                t.Id,
+		Deposit:           t.Deposit,
+		StartTime:         t.StartTime,
+		TemplateId:        t.TemplateId,
+		TournamentOptions: t.TournamentOptions.clone(),
+		seats:             t.seats,
+		State:             t.State,
+		Funds:             cloneFunds(t.Funds),
+		Stakes:            cloneFunds(t.Stakes),
+		Eliminations:      append([]Elimination(nil), t.Eliminations...),
+		Places:            append([]string(nil), t.Places...),
+		CancelReason:      t.CancelReason,
+	}
+	if t.Schedule != nil {
+		schedule := *t.Schedule
+		tournament.Schedule = &schedule
 	}
+	if t.StateTimes != nil {
+		tournament.StateTimes = make(map[TournamentState]time.Time, len(t.StateTimes))
+		for state, tm := range t.StateTimes {
+			tournament.StateTimes[state] = tm
+		}
+	}
+	if t.BuyIns != nil {
+		tournament.BuyIns = make(map[string]BuyIn, len(t.BuyIns))
+		for key, buyIn := range t.BuyIns {
+			tournament.BuyIns[key] = buyIn
+		}
+	}
+	if t.Teams != nil {
+		tournament.Teams = make(map[string]Team, len(t.Teams))
+		for id, team := range t.Teams {
+			tournament.Teams[id] = Team{Id: team.Id, Members: append([]string(nil), team.Members...)}
+		}
+	}
+	for _, waiting := range t.Waitlist {
+		tournament.Waitlist = append(tournament.Waitlist, Waiting{
+			PlayerId: waiting.PlayerId,
+			Fund:     waiting.Fund.Copy(),
+			Stakes:   waiting.Stakes.Copy(),
+		})
+	}
+	return tournament
 }
 
 func (t *Tournament) GetId() int {
 	return t.Id
 }
 
-func (t *Tournament) GetDeposit() float64 {
+func (t *Tournament) GetDeposit() Money {
 	return t.Deposit
 }
 
@@ -42,47 +214,618 @@ func (t *Tournament) GetStartTime() time.Time {
 	return t.StartTime
 }
 
+func (t *Tournament) GetTemplateId() string {
+	return t.TemplateId
+}
+
+// SetSchedule sets the tournament timetable
+// NOTE: call it before the tournament added to DB
+func (t *Tournament) SetSchedule(schedule Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.StartTime = schedule.Start
+	t.Schedule = &schedule
+	return nil
+}
+
+func (t *Tournament) GetSchedule() (Schedule, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.Schedule == nil {
+		return Schedule{}, false
+	}
+	return *t.Schedule, true
+}
+
+// Due returns the state the scheduled tournament should transit to at the time
+func (t *Tournament) Due(now time.Time) (TournamentState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.Schedule == nil {
+		return "", false
+	}
+	switch t.State {
+	case StateAnnounced:
+		if !now.Before(t.Schedule.Registration) {
+			return StateRegistration, true
+		}
+	case StateRegistration:
+		if !now.Before(t.Schedule.Start) {
+			return StateRunning, true
+		}
+	}
+	return "", false
+}
+
+func (t *Tournament) SetOptions(options TournamentOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.TournamentOptions = options
+	return nil
+}
+
+func (t *Tournament) GetOptions() TournamentOptions {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.TournamentOptions
+}
+
+// GetEntrants returns the number of the joined players, the buy-ins aren't counted
+func (t *Tournament) GetEntrants() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.Funds) - len(t.BuyIns)
+}
+
+// GetPrizePool returns the prize pool built from the collected deposits,
+// the rake taken by the house and the overlay paid by the house to reach the guarantee,
+// the fee is taken from every entry including the buy-ins, the bounties are excluded
+func (t *Tournament) GetPrizePool() (pool, rake, overlay Money) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var collected Money
+	for _, fund := range t.Funds {
+		for _, income := range fund {
+			collected -= income
+		}
+	}
+	rake = t.Rake.Of(collected) + t.Fee*Money(len(t.Funds))
+	// NOTE: the bounties are paid on eliminations, not from the prize pool
+	collected -= t.bountyPool()
+	if rake > collected {
+		rake = collected
+	}
+	pool = collected - rake
+	if pool < t.Guarantee {
+		overlay = t.Guarantee - pool
+		pool = t.Guarantee
+	}
+	return pool, rake, overlay
+}
+
+func (t *Tournament) GetState() TournamentState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.State
+}
+
+// GetStateTime returns the time the tournament entered the state
+func (t *Tournament) GetStateTime(state TournamentState) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tm, ok := t.StateTimes[state]
+	return tm, ok
+}
+
+func (t *Tournament) OpenRegistration() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.transit(StateRegistration)
+}
+
+// Start closes the registration
+func (t *Tournament) Start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.transit(StateRunning)
+}
+
+// StartOrCancel starts the tournament or cancels it if there are less than min players,
+// the funds to refund are returned for the cancelled tournament
+func (t *Tournament) StartOrCancel() (bool, map[string]Fund, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if entrants := len(t.Funds) - len(t.BuyIns); entrants < t.MinPlayers {
+		if err := t.cancel(fmt.Sprintf("%d players joined, %d required", entrants, t.MinPlayers)); err != nil {
+			return false, nil, err
+		}
+		return true, t.refunds(), nil
+	}
+	return false, nil, t.transit(StateRunning)
+}
+
+// CanJoin reports an error if the players can't join the tournament now
+func (t *Tournament) CanJoin() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.canJoin()
+}
+
 func (t *Tournament) AddPlayer(id string, fund Fund) error {
+	return t.AddPlayerWithStakes(id, fund, nil)
+}
+
+// AddPlayerWithStakes adds the player whose backers own the action shares
+// different from the paid incomes, e.g. bought with markup
+func (t *Tournament) AddPlayerWithStakes(id string, fund, stakes Fund) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if !t.Open {
-		return fmt.Errorf("Tournament %d already closed", t.Id)
+	if t.isFull() {
+		return fmt.Errorf("Player %s can't join full tournament %d", id, t.Id)
 	}
-	if fund == nil {
-		return fmt.Errorf("Player %s trying to join tournament %d without fund", id, t.Id)
+	return t.addPlayer(id, fund, stakes)
+}
+
+// Wait adds the player to the waitlist if the tournament is full and returns the position,
+// zero position is returned if there is a free seat
+func (t *Tournament) Wait(id string, fund, stakes Fund) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.canJoin(); err != nil {
+		return 0, err
 	}
 	if _, ok := t.Funds[id]; ok {
-		return fmt.Errorf("Player %s already joined tournament %d", id, t.Id)
+		return 0, fmt.Errorf("Player %s already joined tournament %d", id, t.Id)
+	}
+	if t.waiting(id) > 0 {
+		return 0, fmt.Errorf("Player %s already waits for tournament %d", id, t.Id)
+	}
+	if !t.isFull() {
+		return 0, nil
 	}
 
-	fmt.Printf("player %s joined tournament %d\n", id, t.Id)
-	t.Funds[id] = fund
+	t.Waitlist = append(t.Waitlist, Waiting{PlayerId: id, Fund: fund, Stakes: stakes})
+	fmt.Printf("player %s waits for tournament %d at position %d\n", id, t.Id, len(t.Waitlist))
+	return len(t.Waitlist), nil
+}
+
+// PopWaiting returns the first waiting player if there is a free seat,
+// the player should join the tournament after the fund charged
+func (t *Tournament) PopWaiting() (Waiting, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.canJoin() != nil || t.isFull() || len(t.Waitlist) == 0 {
+		return Waiting{}, false
+	}
+	waiting := t.Waitlist[0]
+	t.Waitlist = t.Waitlist[1:]
+	t.seats++
+	return waiting, true
+}
+
+// Seat adds the waiting player to the seat reserved by PopWaiting
+func (t *Tournament) Seat(id string, fund, stakes Fund) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.seats--
+	return t.addPlayer(id, fund, stakes)
+}
+
+// ReleaseSeat releases the seat reserved by PopWaiting if the waiting player can't be charged
+func (t *Tournament) ReleaseSeat() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.seats--
+}
+
+// GetWaiting returns the player waitlist position and the waitlist size,
+// zero position is returned if the player doesn't wait
+func (t *Tournament) GetWaiting(id string) (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.waiting(id), len(t.Waitlist)
+}
+
+// CanBuyIn reports an error if the player can't make the buy-in now
+func (t *Tournament) CanBuyIn(id string, kind BuyInKind) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.canBuyIn(id, kind)
+}
+
+// GetBuyInPrice returns the price of the buy-in, the deposit if the price not set
+func (t *Tournament) GetBuyInPrice(kind BuyInKind) Money {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if price := t.Limits[kind].Price; price > 0 {
+		return price
+	}
+	return t.Deposit
+}
+
+// AddBuyIn records the buy-in of the player as a separate entry
+func (t *Tournament) AddBuyIn(id string, kind BuyInKind, fund, stakes Fund) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.canBuyIn(id, kind); err != nil {
+		return err
+	}
+	if fund == nil {
+		return fmt.Errorf("Player %s trying to %s tournament %d without fund", id, kind, t.Id)
+	}
+	if err := ValidatePlayerId(id); err != nil {
+		return err
+	}
+
+	var key string
+	for i := 2; ; i++ {
+		key = fmt.Sprintf("%s#%d", id, i)
+		if _, ok := t.Funds[key]; !ok {
+			break
+		}
+	}
+	fmt.Printf("player %s made %s in tournament %d\n", id, kind, t.Id)
+	t.Funds[key] = fund
+	if stakes != nil {
+		if t.Stakes == nil {
+			t.Stakes = make(map[string]Fund)
+		}
+		t.Stakes[key] = stakes
+	}
+	if t.BuyIns == nil {
+		t.BuyIns = make(map[string]BuyIn)
+	}
+	t.BuyIns[key] = BuyIn{PlayerId: id, Kind: kind}
 	return nil
 }
 
+// GetBuyIns returns the number of the player buy-ins of the kind
+func (t *Tournament) GetBuyIns(id string, kind BuyInKind) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.buyIns(id, kind)
+}
+
+// GetSplit returns the incomes and the action shares of the player first entry
+func (t *Tournament) GetSplit(id string) (fund, stakes Fund) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fund = Fund{}
+	for backerId, income := range t.Funds[id] {
+		fund[backerId] = income
+	}
+	return fund, t.entryStakes(id)
+}
+
+// GetStakes returns the action shares of the player backers (including the player)
+// summed by all the player entries
+func (t *Tournament) GetStakes(id string) Fund {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stakes := Fund{}
+	for key := range t.Funds {
+		if t.playerId(key) != id {
+			continue
+		}
+		for backerId, stake := range t.entryStakes(key) {
+			stakes[backerId] += stake
+		}
+	}
+	return stakes
+}
+
 func (t *Tournament) HasPlayer(id string) bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	_, ok := t.Funds[id]
-	return ok
+	return ok && t.playerId(id) == id
+}
+
+// Remove removes the player entries before the tournament start and returns the funds to refund
+func (t *Tournament) Remove(id string) (map[string]Fund, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.State != StateRegistration {
+		return nil, &StateError{TournamentId: t.Id, State: t.State, Action: "leave"}
+	}
+	if position := t.waiting(id); position > 0 {
+		// nothing charged yet
+		t.Waitlist = append(t.Waitlist[:position-1], t.Waitlist[position:]...)
+		fmt.Printf("player %s left tournament %d waitlist\n", id, t.Id)
+		return map[string]Fund{}, nil
+	}
+	if _, ok := t.Funds[id]; !ok || t.playerId(id) != id {
+		return nil, fmt.Errorf("Player %s didn't join tournament %d", id, t.Id)
+	}
+
+	funds := make(map[string]Fund)
+	for key := range t.Funds {
+		if t.playerId(key) != id {
+			continue
+		}
+		funds[key] = t.refund(key)
+		delete(t.Funds, key)
+		delete(t.Stakes, key)
+		delete(t.BuyIns, key)
+		delete(t.Teams, key)
+	}
+	fmt.Printf("player %s left tournament %d\n", id, t.Id)
+	return funds, nil
 }
 
-func (t *Tournament) Close() (map[string]Fund, error) {
+// Close starts the tournament settling and returns the funds to pay prizes,
+// the passed players must be in the tournament, so nobody leaves it before the results,
+// the tournament should be finished after the prizes paid
+func (t *Tournament) Close(playerIds ...string) (map[string]Fund, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if !t.Open {
-		return nil, fmt.Errorf("Tournament %d already closed", t.Id)
+	for _, id := range playerIds {
+		if _, ok := t.Funds[id]; !ok || t.playerId(id) != id {
+			return nil, fmt.Errorf("Player %s isn't in tournament %d", id, t.Id)
+		}
+	}
+	if err := t.transit(StateSettling); err != nil {
+		return nil, err
 	}
-	t.Open = false
 	return t.Funds, nil
 }
 
+func (t *Tournament) Finish() error {
+	return t.FinishWithPlaces(nil)
+}
+
+// FinishWithPlaces finishes the tournament recording the finishing places of the entries
+func (t *Tournament) FinishWithPlaces(places []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.transit(StateFinished); err != nil {
+		return err
+	}
+	t.Places = places
+	return nil
+}
+
+func (t *Tournament) GetPlaces() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string{}, t.Places...)
+}
+
+// Cancel closes the tournament without results and returns the funds to refund,
+// cancelling already cancelled tournament returns nothing
+func (t *Tournament) Cancel(reason string) (map[string]Fund, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.State == StateCancelled {
+		return nil, nil
+	}
+	if err := t.cancel(reason); err != nil {
+		return nil, err
+	}
+	return t.refunds(), nil
+}
+
+func (t *Tournament) IsCancelled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.State == StateCancelled
+}
+
+func (t *Tournament) GetCancelReason() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.CancelReason
+}
+
 func (t *Tournament) IsOpen() bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	return t.Open
+	return t.State.IsOpen()
+}
+
+// NOTE: not thread safe
+func (t *Tournament) transit(to TournamentState) error {
+	if !t.State.CanTransit(to) {
+		return &TransitionError{TournamentId: t.Id, From: t.State, To: to}
+	}
+	fmt.Printf("tournament %d: %s -> %s\n", t.Id, t.State, to)
+	t.State = to
+	t.StateTimes[to] = time.Now()
+	return nil
+}
+
+// NOTE: not thread safe
+func (t *Tournament) cancel(reason string) error {
+	if err := t.transit(StateCancelled); err != nil {
+		return err
+	}
+	fmt.Printf("tournament %d cancelled: %s\n", t.Id, reason)
+	t.CancelReason = reason
+	// nothing charged from the waiting players
+	t.Waitlist = nil
+	return nil
+}
+
+// NOTE: not thread safe
+func (t *Tournament) addPlayer(id string, fund, stakes Fund) error {
+	if err := t.canJoin(); err != nil {
+		return err
+	}
+	if fund == nil {
+		return fmt.Errorf("Player %s trying to join tournament %d without fund", id, t.Id)
+	}
+	if t.TeamSize > 0 {
+		return fmt.Errorf("Player %s can't join team tournament %d without team", id, t.Id)
+	}
+	if _, ok := t.Funds[id]; ok {
+		return fmt.Errorf("Player %s already joined tournament %d", id, t.Id)
+	}
+
+	fmt.Printf("player %s joined tournament %d\n", id, t.Id)
+	t.Funds[id] = fund
+	if stakes != nil {
+		if t.Stakes == nil {
+			t.Stakes = make(map[string]Fund)
+		}
+		t.Stakes[id] = stakes
+	}
+	return nil
+}
+
+// NOTE: not thread safe
+func (t *Tournament) isFull() bool {
+	return t.MaxPlayers > 0 && len(t.Funds)-len(t.BuyIns)+t.seats >= t.MaxPlayers
+}
+
+// waiting returns the player waitlist position starting from one
+// NOTE: not thread safe
+func (t *Tournament) waiting(id string) int {
+	for i, waiting := range t.Waitlist {
+		if waiting.PlayerId == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// NOTE: not thread safe
+func (t *Tournament) canJoin() error {
+	late := t.State == StateRunning && t.Schedule != nil && !t.Schedule.LateRegistration.IsZero()
+	if t.State != StateRegistration && !late {
+		return &StateError{TournamentId: t.Id, State: t.State, Action: "join"}
+	}
+	if t.Schedule != nil && !time.Now().Before(t.Schedule.JoinUntil()) {
+		return fmt.Errorf("Tournament %d registration closed at %s", t.Id, t.Schedule.JoinUntil())
+	}
+	return nil
+}
+
+// NOTE: not thread safe
+func (t *Tournament) canBuyIn(id string, kind BuyInKind) error {
+	if err := kind.Validate(); err != nil {
+		return err
+	}
+	open := t.State.IsOpen()
+	if kind == BuyInAddon {
+		open = t.State == StateRunning
+	}
+	if !open {
+		return &StateError{TournamentId: t.Id, State: t.State, Action: string(kind)}
+	}
+	if _, ok := t.Funds[id]; !ok || t.playerId(id) != id {
+		return fmt.Errorf("Player %s didn't join tournament %d", id, t.Id)
+	}
+	if max := t.Limits[kind].Max; t.buyIns(id, kind) >= max {
+		return fmt.Errorf("Player %s reached %s limit %d in tournament %d", id, kind, max, t.Id)
+	}
+	return nil
+}
+
+// NOTE: not thread safe
+func (t *Tournament) buyIns(id string, kind BuyInKind) int {
+	var n int
+	for _, buyIn := range t.BuyIns {
+		if buyIn.PlayerId == id && buyIn.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// playerId returns the player id of the entry
+// NOTE: not thread safe
+func (t *Tournament) playerId(key string) string {
+	if buyIn, ok := t.BuyIns[key]; ok {
+		return buyIn.PlayerId
+	}
+	return key
+}
+
+// refund returns the entry incomes to refund, the backers get back their action shares,
+// so the markup premium the player got stays with the player
+// NOTE: not thread safe
+func (t *Tournament) refund(key string) Fund {
+	fund := Fund{}
+	for backerId, stake := range t.entryStakes(key) {
+		fund[backerId] = -stake
+	}
+	return fund
+}
+
+// refunds returns the incomes to refund of all the entries, see refund
+// NOTE: not thread safe
+func (t *Tournament) refunds() map[string]Fund {
+	funds := make(map[string]Fund)
+	for key := range t.Funds {
+		funds[key] = t.refund(key)
+	}
+	return funds
+}
+
+// NOTE: not thread safe
+func (t *Tournament) entryStakes(key string) Fund {
+	stakes := Fund{}
+	if entry, ok := t.Stakes[key]; ok {
+		for backerId, stake := range entry {
+			stakes[backerId] = stake
+		}
+		return stakes
+	}
+	for backerId, income := range t.Funds[key] {
+		stakes[backerId] = -income
+	}
+	return stakes
+}
+
+func cloneFunds(funds map[string]Fund) map[string]Fund {
+	if funds == nil {
+		return nil
+	}
+	clone := make(map[string]Fund, len(funds))
+	for key, fund := range funds {
+		clone[key] = fund.Copy()
+	}
+	return clone
 }
@@ -1,23 +1,30 @@
 package model
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 )
 
 func TestTournament(t *testing.T) {
 	player100 := NewPlayer("player100")
-	player100.IncrBalance(100)
-	ifund := Fund{"invalid": 100}
-	fund := Fund{player100.GetId(): 100}
+	player100.IncrBalance(Points(100))
+	ifund := Fund{"invalid": Points(100)}
+	fund := Fund{player100.GetId(): Points(100)}
 	wfunds := map[string]Fund{player100.GetId(): fund}
 
-	tourn := NewTournament(1, 100)
+	tourn := NewTournament(1, Points(100))
+	if err := tourn.AddPlayer(player100.GetId(), fund); err == nil {
+		t.Errorf("player joined announced tournament")
+	}
+	if err := tourn.OpenRegistration(); err != nil {
+		t.Errorf("can't open registration: %+v", err)
+	}
 	if tourn.GetId() != 1 {
 		t.Errorf("invalid tournament id: want %d, got %d", 1, tourn.GetId())
 	}
-	if tourn.GetDeposit() != 100.0 {
-		t.Errorf("invalid tourn deposit: want %f, got %f", 100.0, tourn.GetDeposit())
+	if tourn.GetDeposit() != Points(100) {
+		t.Errorf("invalid tourn deposit: want %s, got %s", Points(100), tourn.GetDeposit())
 	}
 	if err := tourn.AddPlayer(player100.GetId(), fund); err != nil {
 		t.Errorf("player %s can't join to the tournament: %+v", player100.GetId(), err)
@@ -45,3 +52,316 @@ func TestTournament(t *testing.T) {
 		t.Errorf("player joined closed tournament")
 	}
 }
+
+func TestTournamentCancel(t *testing.T) {
+	fund := Fund{"player": Points(-100)}
+	wfunds := map[string]Fund{"player": fund}
+
+	tourn := NewTournament(1, Points(100))
+	tourn.OpenRegistration()
+	tourn.AddPlayer("player", fund)
+	funds, err := tourn.Cancel("reason")
+	if err != nil || !reflect.DeepEqual(funds, wfunds) {
+		t.Errorf("invalid funds: want %#v, got %#v: %+v", wfunds, funds, err)
+	}
+	if !tourn.IsCancelled() || tourn.IsOpen() || tourn.GetCancelReason() != "reason" {
+		t.Errorf("tournament not cancelled")
+	}
+	if funds, err := tourn.Cancel("again"); err != nil || funds != nil {
+		t.Errorf("double cancelling returned funds %#v: %+v", funds, err)
+	}
+	if tourn.GetCancelReason() != "reason" {
+		t.Errorf("invalid cancel reason: want %s, got %s", "reason", tourn.GetCancelReason())
+	}
+	if _, err := tourn.Close(); err == nil {
+		t.Errorf("closing cancelled tournament")
+	}
+
+	tourn = NewTournament(2, Points(100))
+	tourn.OpenRegistration()
+	tourn.Close()
+	if _, err := tourn.Cancel("reason"); err == nil || tourn.IsCancelled() {
+		t.Errorf("cancelling closed tournament")
+	}
+}
+
+func TestTournamentState(t *testing.T) {
+	tests := []struct {
+		actions   []func(*Tournament) error
+		wantErr   []bool
+		wantState TournamentState
+	}{
+		{[]func(*Tournament) error{(*Tournament).Start},
+			[]bool{true}, StateAnnounced},
+		{[]func(*Tournament) error{(*Tournament).Finish},
+			[]bool{true}, StateAnnounced},
+		{[]func(*Tournament) error{(*Tournament).OpenRegistration, (*Tournament).OpenRegistration},
+			[]bool{false, true}, StateRegistration},
+		{[]func(*Tournament) error{(*Tournament).OpenRegistration, (*Tournament).Start, (*Tournament).Finish},
+			[]bool{false, false, true}, StateRunning},
+		{[]func(*Tournament) error{(*Tournament).OpenRegistration, (*Tournament).Start,
+			closeTournament, (*Tournament).Finish},
+			[]bool{false, false, false, false}, StateFinished},
+		{[]func(*Tournament) error{(*Tournament).OpenRegistration, closeTournament,
+			(*Tournament).Start, (*Tournament).Finish, closeTournament},
+			[]bool{false, false, true, false, true}, StateFinished},
+		{[]func(*Tournament) error{cancelTournament, (*Tournament).OpenRegistration},
+			[]bool{false, true}, StateCancelled},
+	}
+
+	for i, test := range tests {
+		tourn := NewTournament(1, Points(100))
+		for j, action := range test.actions {
+			err := action(tourn)
+			if (err != nil) != test.wantErr[j] {
+				t.Errorf("invalid error for test %d action %d: %+v", i, j, err)
+			}
+			if _, ok := err.(*TransitionError); err != nil && !ok {
+				t.Errorf("invalid error type for test %d action %d: %T", i, j, err)
+			}
+		}
+		if tourn.GetState() != test.wantState {
+			t.Errorf("invalid state for test %d: want %s, got %s", i, test.wantState, tourn.GetState())
+		}
+		if _, ok := tourn.GetStateTime(test.wantState); !ok {
+			t.Errorf("state %s time not set for test %d", test.wantState, i)
+		}
+	}
+
+	tourn := NewTournament(1, Points(100))
+	tourn.OpenRegistration()
+	tourn.Start()
+	if _, ok := tourn.AddPlayer("player", Fund{}).(*StateError); !ok {
+		t.Errorf("player joined running tournament")
+	}
+}
+
+func closeTournament(t *Tournament) error {
+	_, err := t.Close()
+	return err
+}
+
+func cancelTournament(t *Tournament) error {
+	_, err := t.Cancel("")
+	return err
+}
+
+func TestTournamentStakes(t *testing.T) {
+	tourn := NewTournament(1, Points(10))
+	tourn.OpenRegistration()
+	tourn.AddPlayer("10", Fund{"10": Points(-4), "20": Points(-6)})
+	tourn.AddPlayerWithStakes("30", Fund{"30": Points(-4), "20": Points(-6)},
+		Fund{"30": Points(5), "20": Points(5)})
+
+	tests := []struct {
+		playerId string
+		want     Fund
+	}{
+		{"10", Fund{"10": Points(4), "20": Points(6)}},
+		{"30", Fund{"30": Points(5), "20": Points(5)}},
+		{"40", Fund{}},
+	}
+
+	for _, test := range tests {
+		if stakes := tourn.GetStakes(test.playerId); !reflect.DeepEqual(stakes, test.want) {
+			t.Errorf("invalid stakes for player %s: want %v, got %v", test.playerId, test.want, stakes)
+		}
+	}
+}
+
+func TestTournamentPrizePool(t *testing.T) {
+	tests := []struct {
+		options     TournamentOptions
+		wantPool    Money
+		wantRake    Money
+		wantOverlay Money
+	}{
+		{TournamentOptions{}, Points(20), 0, 0},
+		{TournamentOptions{Rake: 1000}, Points(18), Points(2), 0},
+		{TournamentOptions{Fee: MustParseMoney("1.5")}, Points(17), Points(3), 0},
+		{TournamentOptions{Fee: Points(1), Guarantee: Points(50)}, Points(50), Points(2), Points(32)},
+	}
+
+	for _, test := range tests {
+		tourn := NewTournament(1, Points(10))
+		tourn.SetOptions(test.options)
+		tourn.OpenRegistration()
+		tourn.AddPlayer("10", Fund{"10": Points(-10)})
+		tourn.AddPlayer("20", Fund{"20": Points(-4), "30": Points(-6)})
+
+		pool, rake, overlay := tourn.GetPrizePool()
+		if pool != test.wantPool || rake != test.wantRake || overlay != test.wantOverlay {
+			t.Errorf("invalid prize pool for options %+v: want %s/%s/%s, got %s/%s/%s", test.options,
+				test.wantPool, test.wantRake, test.wantOverlay, pool, rake, overlay)
+		}
+	}
+}
+
+func TestTournamentBuyIn(t *testing.T) {
+	tourn := NewTournament(1, Points(10))
+	tourn.SetOptions(TournamentOptions{Limits: map[BuyInKind]BuyInLimit{
+		BuyInRebuy: {Max: 2},
+		BuyInAddon: {Max: 1, Price: Points(5)},
+	}})
+	tourn.OpenRegistration()
+	tourn.AddPlayer("10", Fund{"10": Points(-4), "20": Points(-6)})
+	tourn.AddPlayer("30", Fund{"30": Points(-10)})
+
+	tests := []struct {
+		playerId string
+		kind     BuyInKind
+		fund     Fund
+		wantErr  bool
+	}{
+		{"40", BuyInRebuy, Fund{"40": Points(-10)}, true},
+		{"10", BuyInReentry, Fund{"10": Points(-10)}, true},
+		{"10", BuyInAddon, Fund{"10": Points(-5)}, true},
+		{"10", BuyInRebuy, Fund{"10": Points(-10)}, false},
+		{"10", BuyInRebuy, Fund{"10": Points(-2), "20": Points(-8)}, false},
+		{"10", BuyInRebuy, Fund{"10": Points(-10)}, true},
+		{"10", BuyInRebuy + "s", Fund{"10": Points(-10)}, true},
+	}
+	for i, test := range tests {
+		if err := tourn.AddBuyIn(test.playerId, test.kind, test.fund, nil); (err != nil) != test.wantErr {
+			t.Errorf("invalid error for test %d: %+v", i, err)
+		}
+	}
+
+	tourn.Start()
+	if err := tourn.AddBuyIn("30", BuyInAddon, Fund{"30": Points(-5)}, Fund{"30": Points(4)}); err != nil {
+		t.Errorf("can't make addon: %+v", err)
+	}
+	if err := tourn.AddBuyIn("30", BuyInAddon, Fund{"30": Points(-5)}, nil); err == nil {
+		t.Errorf("addon limit exceeded")
+	}
+
+	if entrants := tourn.GetEntrants(); entrants != 2 {
+		t.Errorf("invalid entrants: want 2, got %d", entrants)
+	}
+	if tourn.HasPlayer("10#2") {
+		t.Errorf("buy-in entry reported as player")
+	}
+	if price := tourn.GetBuyInPrice(BuyInRebuy); price != Points(10) {
+		t.Errorf("invalid rebuy price: want 10, got %s", price)
+	}
+	if pool, _, _ := tourn.GetPrizePool(); pool != Points(45) {
+		t.Errorf("invalid prize pool: want 45, got %s", pool)
+	}
+	for id, want := range map[string]Fund{
+		"10": {"10": Points(16), "20": Points(14)},
+		"30": {"30": Points(14)},
+	} {
+		if stakes := tourn.GetStakes(id); !reflect.DeepEqual(stakes, want) {
+			t.Errorf("invalid stakes for player %s: want %v, got %v", id, want, stakes)
+		}
+	}
+}
+
+func TestTournamentRemove(t *testing.T) {
+	tourn := NewTournament(1, Points(10))
+	tourn.SetOptions(TournamentOptions{Limits: map[BuyInKind]BuyInLimit{BuyInRebuy: {Max: 1}}})
+	if _, err := tourn.Remove("10"); err == nil {
+		t.Errorf("player left announced tournament")
+	}
+	tourn.OpenRegistration()
+	tourn.AddPlayerWithStakes("10", Fund{"10": Points(-4), "20": Points(-6)}, Fund{"10": Points(5), "20": Points(5)})
+	tourn.AddBuyIn("10", BuyInRebuy, Fund{"10": Points(-10)}, nil)
+	tourn.AddPlayer("30", Fund{"30": Points(-10)})
+
+	if _, err := tourn.Remove("40"); err == nil {
+		t.Errorf("not joined player left tournament")
+	}
+	funds, err := tourn.Remove("10")
+	if err != nil {
+		t.Fatalf("can't remove player: %+v", err)
+	}
+	// the action shares are refunded
+	want := map[string]Fund{
+		"10":   {"10": Points(-5), "20": Points(-5)},
+		"10#2": {"10": Points(-10)},
+	}
+	if !reflect.DeepEqual(funds, want) {
+		t.Errorf("invalid removed funds: want %v, got %v", want, funds)
+	}
+	if tourn.HasPlayer("10") || tourn.GetEntrants() != 1 || tourn.GetBuyIns("10", BuyInRebuy) != 0 {
+		t.Errorf("player entries not removed")
+	}
+	if _, err := tourn.Close("10"); err == nil {
+		t.Errorf("tournament closed with removed winner")
+	}
+
+	tourn.Start()
+	if _, err := tourn.Remove("30"); err == nil {
+		t.Errorf("player left running tournament")
+	} else if _, ok := err.(*StateError); !ok {
+		t.Errorf("invalid error type: %T", err)
+	}
+}
+
+func TestTournamentWaitlist(t *testing.T) {
+	tourn := NewTournament(1, Points(10))
+	tourn.SetOptions(TournamentOptions{MaxPlayers: 1})
+	tourn.OpenRegistration()
+
+	if position, err := tourn.Wait("10", Fund{"10": Points(-10)}, nil); err != nil || position != 0 {
+		t.Errorf("player waits for free seat: position %d, err %+v", position, err)
+	}
+	tourn.AddPlayer("10", Fund{"10": Points(-10)})
+	if err := tourn.AddPlayer("20", Fund{"20": Points(-10)}); err == nil {
+		t.Errorf("player joined full tournament")
+	}
+	for i, id := range []string{"20", "30"} {
+		if position, err := tourn.Wait(id, Fund{id: Points(-10)}, nil); err != nil || position != i+1 {
+			t.Errorf("invalid player %s position %d, err %+v", id, position, err)
+		}
+	}
+	if _, err := tourn.Wait("20", Fund{"20": Points(-10)}, nil); err == nil {
+		t.Errorf("player waits twice")
+	}
+	if _, ok := tourn.PopWaiting(); ok {
+		t.Errorf("waiting player popped without free seat")
+	}
+
+	tourn.Remove("10")
+	waiting, ok := tourn.PopWaiting()
+	if !ok || waiting.PlayerId != "20" {
+		t.Fatalf("invalid waiting player popped: %+v", waiting)
+	}
+	// the seat is reserved for the popped player
+	if err := tourn.AddPlayer("40", Fund{"40": Points(-10)}); err == nil {
+		t.Errorf("player joined reserved seat")
+	}
+	if err := tourn.Seat(waiting.PlayerId, waiting.Fund, waiting.Stakes); err != nil {
+		t.Errorf("can't seat waiting player: %+v", err)
+	}
+	if position, size := tourn.GetWaiting("30"); position != 1 || size != 1 {
+		t.Errorf("invalid waiting player position %d, size %d", position, size)
+	}
+
+	tourn.SetOptions(TournamentOptions{MaxPlayers: 3, MinPlayers: 2})
+	if cancelled, funds, err := tourn.StartOrCancel(); !cancelled || err != nil || len(funds) != 1 {
+		t.Errorf("tournament isn't cancelled: %v, funds %v, err %+v", cancelled, funds, err)
+	}
+	if position, size := tourn.GetWaiting("30"); position != 0 || size != 0 {
+		t.Errorf("waitlist isn't cleared on cancel")
+	}
+}
+
+func TestTournamentClone(t *testing.T) {
+	tournament := NewTournament(1, Points(10))
+	tournament.SetOptions(TournamentOptions{Payout: &Payout{Type: PayoutPercent, Places: []Percent{Hundred}}})
+	tournament.OpenRegistration()
+	tournament.AddPlayerWithStakes("10", Fund{"10": Points(-5), "20": Points(-5)}, Fund{"20": Points(5)})
+	before, _ := json.Marshal(tournament)
+
+	clone := tournament.Clone()
+	if data, _ := json.Marshal(clone); string(data) != string(before) {
+		t.Fatalf("invalid clone: want %s, got %s", before, data)
+	}
+	clone.AddPlayer("30", Fund{"30": Points(-10)})
+	clone.GetOptions().Payout.Places[0] = 0
+	clone.Funds["10"]["10"] = 0
+	if data, _ := json.Marshal(tournament); string(data) != string(before) {
+		t.Errorf("tournament changed by clone: want %s, got %s", before, data)
+	}
+}
@@ -1,6 +1,7 @@
 package handle
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/cnaize/lifland/db"
@@ -8,6 +9,9 @@ import (
 
 func Reset(dbi db.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		dbi.Reset()
+		if err := dbi.Reset(r.Context()); err != nil {
+			fmt.Printf("ERROR: Reset(): can't reset db: %+v\n", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
 	}
 }
@@ -0,0 +1,148 @@
+package handle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+// Funds reports the pending funds waiting for the sync and the dead funds which need the operator,
+// the funds are restored from the dumps made before the payouts were transactional, nothing adds them now
+func Funds(dbi db.Interface) http.HandlerFunc {
+	type item struct {
+		Id           int         `json:"id"`
+		TournamentId int         `json:"tournamentId"`
+		Fund         model.Fund  `json:"fund"`
+		Amount       model.Money `json:"amount"`
+		Attempts     int         `json:"attempts"`
+		LastError    string      `json:"lastError,omitempty"`
+		Created      time.Time   `json:"created"`
+		Age          string      `json:"age"`
+	}
+	items := func(funds []model.PendingFund, now time.Time) []item {
+		items := []item{}
+		for _, fund := range funds {
+			items = append(items, item{
+				Id:           fund.Id,
+				TournamentId: fund.TournamentId,
+				Fund:         fund.Fund,
+				Amount:       fund.Amount(),
+				Attempts:     fund.Attempts,
+				LastError:    fund.LastError,
+				Created:      fund.Created,
+				Age:          fund.Age(now).Round(time.Second).String(),
+			})
+		}
+		return items
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := r.Context()
+		pending, err := dbi.GetFunds(ctx)
+		if err != nil {
+			fmt.Printf("ERROR: Funds(): can't get funds: %+v\n", err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		dead, err := dbi.GetDeadFunds(ctx)
+		if err != nil {
+			fmt.Printf("ERROR: Funds(): can't get dead funds: %+v\n", err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		now := time.Now()
+		data := map[string]interface{}{
+			"pending": items(pending, now),
+			"dead":    items(dead, now),
+		}
+		resp, err := json.Marshal(data)
+		if err != nil {
+			fmt.Printf("ERROR: Funds(): can't marshal data %v: %+v\n", data, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(resp); err != nil {
+			fmt.Printf("ERROR: Funds(): can't write response %s: %+v\n", resp, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RetryFund resets the fund attempts, the dead fund is synced again
+func RetryFund(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id, err := handleFundIn(w, r)
+		if err != nil {
+			fmt.Printf("ERROR: RetryFund(): can't handle input: %+v\n", err)
+			return
+		}
+		if _, err := dbi.RetryFund(ctx, id, nil); err != nil {
+			fmt.Printf("ERROR: RetryFund(): can't retry fund %d: %+v\n", id, err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		dump(ctx, dbi)
+	}
+}
+
+// ReassignFund moves the player part of the fund to the other player and retries the fund,
+// e.g. when the player account was deleted
+func ReassignFund(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id, err := handleFundIn(w, r)
+		if err != nil {
+			fmt.Printf("ERROR: ReassignFund(): can't handle input: %+v\n", err)
+			return
+		}
+		query := r.URL.Query()
+		from, to := query.Get("playerId"), query.Get("toPlayerId")
+		if _, err := dbi.GetPlayer(ctx, to); err != nil {
+			fmt.Printf("ERROR: ReassignFund(): can't get player %s: %+v\n", to, err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		_, err = dbi.RetryFund(ctx, id, func(f *model.PendingFund) error {
+			return f.Reassign(from, to)
+		})
+		if errors.Is(err, db.ErrNotFound) {
+			fmt.Printf("ERROR: ReassignFund(): fund %d not found\n", id)
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fmt.Printf("ERROR: ReassignFund(): can't reassign fund %d from player %s to player %s: %+v\n",
+				id, from, to, err)
+			http.Error(w, "", http.StatusUnprocessableEntity)
+			return
+		}
+		dump(ctx, dbi)
+	}
+}
+
+// WriteOffFund drops the fund which can't be synced, its points are moved to the house
+func WriteOffFund(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id, err := handleFundIn(w, r)
+		if err != nil {
+			fmt.Printf("ERROR: WriteOffFund(): can't handle input: %+v\n", err)
+			return
+		}
+		if _, err := dbi.WriteOffFund(ctx, id); err != nil {
+			fmt.Printf("ERROR: WriteOffFund(): can't write off fund %d: %+v\n", id, err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		dump(ctx, dbi)
+	}
+}
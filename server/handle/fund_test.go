@@ -0,0 +1,95 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func TestFunds(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	mux := initTestMux(dbi)
+	dbi.AddPlayer(ctx, model.NewPlayer("10"))
+	// NOTE: the funds stand for the ones restored from the legacy dump, the funds of the missing players die
+	dbi.AddFund(ctx, 1, model.Fund{"30": model.Points(5)})
+	dbi.AddFund(ctx, 1, model.Fund{"40": model.Points(2)})
+	for i := 0; i < db.DefaultMaxFundAttempts; i++ {
+		dbi.SyncFunds(ctx)
+	}
+	dbi.AddFund(ctx, 1, model.Fund{"50": model.Points(3)})
+
+	type item struct {
+		Id        int         `json:"id"`
+		Amount    model.Money `json:"amount"`
+		Attempts  int         `json:"attempts"`
+		LastError string      `json:"lastError"`
+	}
+	getFunds := func() (pending, dead []item) {
+		r, _ := http.NewRequest(http.MethodGet, "/funds", nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("invalid code %d for uri /funds", w.Code)
+		}
+		var data struct {
+			Pending []item `json:"pending"`
+			Dead    []item `json:"dead"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+			t.Fatalf("can't unmarshal body: %+v", err)
+		}
+		return data.Pending, data.Dead
+	}
+
+	pending, dead := getFunds()
+	if len(pending) != 1 || pending[0].Id != 3 || pending[0].Attempts != 0 {
+		t.Errorf("invalid pending funds: %+v", pending)
+	}
+	if len(dead) != 2 || dead[0].Id != 1 || dead[0].Amount != model.Points(5) ||
+		dead[0].Attempts != db.DefaultMaxFundAttempts || dead[0].LastError == "" {
+		t.Errorf("invalid dead funds: %+v", dead)
+	}
+
+	steps := []struct {
+		uri      string
+		wantCode int
+	}{
+		{"/retryFund?fundId=qwe", http.StatusBadRequest},
+		{"/retryFund?fundId=9", http.StatusNotFound},
+		{"/retryFund?fundId=2", http.StatusOK},
+		{"/reassignFund?fundId=1&playerId=30&toPlayerId=99", http.StatusNotFound},
+		{"/reassignFund?fundId=9&playerId=30&toPlayerId=10", http.StatusNotFound},
+		{"/reassignFund?fundId=1&playerId=20&toPlayerId=10", http.StatusUnprocessableEntity},
+		{"/reassignFund?fundId=1&playerId=30&toPlayerId=10", http.StatusOK},
+		{"/writeOffFund?fundId=3", http.StatusOK},
+		{"/writeOffFund?fundId=3", http.StatusNotFound},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(http.MethodPost, step.uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Errorf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+	}
+
+	// the reassigned fund is synced, the retried one fails again
+	dbi.SyncFunds(ctx)
+	pending, dead = getFunds()
+	if len(pending) != 1 || pending[0].Id != 2 || pending[0].Attempts != 1 || len(dead) != 0 {
+		t.Errorf("invalid funds: pending %+v, dead %+v", pending, dead)
+	}
+	if balance := getBalance(ctx, dbi, "10"); balance != model.Points(5) {
+		t.Errorf("invalid reassigned fund balance %s", balance)
+	}
+	if balance := getAccountBalance(ctx, dbi, model.HouseAccount); balance != model.Points(3) {
+		t.Errorf("invalid written off fund house balance %s", balance)
+	}
+}
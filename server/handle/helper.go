@@ -2,56 +2,377 @@ package handle
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cnaize/lifland/db"
 	"github.com/cnaize/lifland/model"
 )
 
+const (
+	defaultHistoryLimit int = 50
+	maxHistoryLimit     int = 1000
+
+	defaultStandingsLimit int = 50
+	maxStandingsLimit     int = 1000
+)
+
 type inAnnounce struct {
 	TournamentId int
-	Deposit      float64
+	Deposit      model.Money
+	// open registration on announce
+	Registration bool
+	Options      model.TournamentOptions
+	Schedule     *model.Schedule
+}
+
+type inTemplate struct {
+	TemplateId string
+	Settings   model.TemplateSettings
+}
+
+type inSeries struct {
+	SeriesId string
+	Formula  string
+	Prizes   []model.Money
+}
+
+type inStandings struct {
+	Series *model.Series
+	Offset int
+	Limit  int
 }
 
 type inJoin struct {
 	Tournament *model.Tournament
 	PlayerId   string
 	Backers    []string
+	// deposit parts (action shares) bought by the backers
+	Stakes []model.Money
+	// price of the backers stakes
+	Markup model.Percent
+	// redeemed instead of the deposit, the ticket joins aren't backed
+	Ticket *model.Ticket
+}
+
+type inBuyIn struct {
+	Tournament *model.Tournament
+	PlayerId   string
+	Kind       model.BuyInKind
+	Backers    []string
+	// negative incomes paid by the backers
+	Incomes []model.Money
+	// price parts (action shares) bought by the backers
+	Stakes []model.Money
 }
 
 type inResult struct {
 	Tournament *model.Tournament
 	Winners    model.Fund
+	// finishing places for the tournaments with payout structure
+	Places []string
+	// awarded instead of the prizes, the ids are set on award
+	Tickets []*model.Ticket
+	// finishing places, either the passed places or the winners order
+	Ranking []string
 }
 
 func handleAnnounceIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inAnnounce, error) {
 	query := r.URL.Query()
 	tid, err := strconv.Atoi(query.Get("tournamentId"))
-	deposit, e := strconv.ParseFloat(query.Get("deposit"), 64)
+	deposit, e := model.ParseMoney(query.Get("deposit"))
 	if err != nil || e != nil || deposit <= 0 {
 		http.Error(w, "", http.StatusBadRequest)
 		return nil, fmt.Errorf("invalid input: %v", r.URL.RawQuery)
 	}
+	registration := true
+	if query.Get("registration") != "" {
+		if registration, err = strconv.ParseBool(query.Get("registration")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("can't parse registration %s: %+v", query.Get("registration"), err)
+		}
+	}
+	options, err := handleOptionsIn(w, r, dbi, deposit)
+	if err != nil {
+		return nil, err
+	}
+	var schedule *model.Schedule
+	if query.Get("startTime") != "" {
+		schedule = &model.Schedule{}
+		for param, tm := range map[string]*time.Time{
+			"startTime":            &schedule.Start,
+			"registrationTime":     &schedule.Registration,
+			"lateRegistrationTime": &schedule.LateRegistration,
+		} {
+			if query.Get(param) == "" {
+				continue
+			}
+			if *tm, err = time.Parse(time.RFC3339, query.Get(param)); err != nil {
+				http.Error(w, "", http.StatusBadRequest)
+				return nil, fmt.Errorf("can't parse %s %s: %+v", param, query.Get(param), err)
+			}
+		}
+		if err := schedule.Validate(); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, err
+		}
+		// the registration opens by the schedule
+		registration = !schedule.Registration.After(time.Now())
+	} else if query.Get("registrationTime") != "" || query.Get("lateRegistrationTime") != "" {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("passed registration times without start time")
+	}
 	return &inAnnounce{
 		TournamentId: tid,
 		Deposit:      deposit,
+		Registration: registration,
+		Options:      options,
+		Schedule:     schedule,
 	}, nil
 }
 
+func handleSeriesIn(w http.ResponseWriter, r *http.Request) (*inSeries, error) {
+	query := r.URL.Query()
+	in := &inSeries{
+		SeriesId: query.Get("seriesId"),
+		Formula:  query.Get("formula"),
+	}
+	if in.SeriesId == "" {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("series id not passed")
+	}
+	if prizes := query.Get("prizes"); prizes != "" {
+		for _, p := range strings.Split(prizes, ",") {
+			prize, err := model.ParseMoney(p)
+			if err != nil {
+				http.Error(w, "", http.StatusBadRequest)
+				return nil, fmt.Errorf("can't parse prizes %s: %+v", prizes, err)
+			}
+			in.Prizes = append(in.Prizes, prize)
+		}
+	}
+	return in, nil
+}
+
+func handleStandingsIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inStandings, error) {
+	query := r.URL.Query()
+	series, err := dbi.GetSeries(r.Context(), query.Get("seriesId"))
+	if err != nil {
+		http.Error(w, "", dbCode(err))
+		return nil, fmt.Errorf("can't get series %s: %+v", query.Get("seriesId"), err)
+	}
+	in := &inStandings{
+		Series: series,
+		Limit:  defaultStandingsLimit,
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if in.Offset, err = strconv.Atoi(offset); err != nil || in.Offset < 0 {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("invalid offset %s", offset)
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if in.Limit, err = strconv.Atoi(limit); err != nil || in.Limit <= 0 || in.Limit > maxStandingsLimit {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("invalid limit %s", limit)
+		}
+	}
+	return in, nil
+}
+
+func handleTemplateIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inTemplate, error) {
+	query := r.URL.Query()
+	templateId := query.Get("templateId")
+	deposit, err := model.ParseMoney(query.Get("deposit"))
+	if templateId == "" || err != nil || deposit <= 0 {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("invalid input: %v", r.URL.RawQuery)
+	}
+	options, err := handleOptionsIn(w, r, dbi, deposit)
+	if err != nil {
+		return nil, err
+	}
+	settings := model.TemplateSettings{
+		Deposit:           deposit,
+		TournamentOptions: options,
+		Recurrence:        query.Get("recurrence"),
+	}
+	for param, d := range map[string]*time.Duration{
+		"registrationBefore": &settings.RegistrationBefore,
+		"lateRegistration":   &settings.LateRegistration,
+		"ahead":              &settings.Ahead,
+	} {
+		if query.Get(param) == "" {
+			continue
+		}
+		if *d, err = time.ParseDuration(query.Get(param)); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("can't parse %s %s: %+v", param, query.Get(param), err)
+		}
+	}
+	if err := settings.Validate(); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("invalid template settings: %+v", err)
+	}
+	return &inTemplate{
+		TemplateId: templateId,
+		Settings:   settings,
+	}, nil
+}
+
+// handleOptionsIn parses the tournament options passed on announce
+func handleOptionsIn(w http.ResponseWriter, r *http.Request, dbi db.Interface, deposit model.Money) (model.TournamentOptions, error) {
+	query := r.URL.Query()
+	var err error
+	var options model.TournamentOptions
+	if query.Get("payout") != "" {
+		if options.Payout, err = model.ParsePayout(query.Get("payout")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("can't parse payout %s: %+v", query.Get("payout"), err)
+		}
+	}
+	if query.Get("rake") != "" {
+		if options.Rake, err = model.ParsePercent(query.Get("rake")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("can't parse rake %s: %+v", query.Get("rake"), err)
+		}
+	}
+	if query.Get("fee") != "" {
+		if options.Fee, err = model.ParseMoney(query.Get("fee")); err != nil || options.Fee > deposit {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("invalid fee %s", query.Get("fee"))
+		}
+	}
+	if query.Get("teamSize") != "" {
+		if options.TeamSize, err = strconv.Atoi(query.Get("teamSize")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("can't parse team size %s: %+v", query.Get("teamSize"), err)
+		}
+	}
+	if query.Get("bounty") != "" {
+		if options.Bounty, err = model.ParsePercent(query.Get("bounty")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("can't parse bounty %s: %+v", query.Get("bounty"), err)
+		}
+	}
+	if query.Get("progressiveBounty") != "" {
+		if options.ProgressiveBounty, err = strconv.ParseBool(query.Get("progressiveBounty")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("can't parse progressive bounty %s: %+v", query.Get("progressiveBounty"), err)
+		}
+	}
+	if query.Get("guarantee") != "" {
+		if options.Guarantee, err = model.ParseMoney(query.Get("guarantee")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("can't parse guarantee %s: %+v", query.Get("guarantee"), err)
+		}
+	}
+	if query.Get("maxPlayers") != "" {
+		if options.MaxPlayers, err = strconv.Atoi(query.Get("maxPlayers")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("can't parse max players %s: %+v", query.Get("maxPlayers"), err)
+		}
+	}
+	if query.Get("minPlayers") != "" {
+		if options.MinPlayers, err = strconv.Atoi(query.Get("minPlayers")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("can't parse min players %s: %+v", query.Get("minPlayers"), err)
+		}
+	}
+	for _, kind := range model.BuyInKinds {
+		if query.Get(string(kind)) == "" {
+			continue
+		}
+		limit, err := model.ParseBuyInLimit(query.Get(string(kind)))
+		if err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return options, fmt.Errorf("can't parse %s limit %s: %+v", kind, query.Get(string(kind)), err)
+		}
+		if options.Limits == nil {
+			options.Limits = make(map[model.BuyInKind]model.BuyInLimit)
+		}
+		options.Limits[kind] = limit
+	}
+	if options.SeriesId = query.Get("seriesId"); options.SeriesId != "" {
+		if _, err := dbi.GetSeries(r.Context(), options.SeriesId); err != nil {
+			http.Error(w, "", dbCode(err))
+			return options, fmt.Errorf("can't get series %s: %+v", options.SeriesId, err)
+		}
+	}
+	if err := options.Validate(); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return options, fmt.Errorf("invalid tournament options: %+v", err)
+	}
+	return options, nil
+}
+
 func handleJoinIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inJoin, error) {
 	query := r.URL.Query()
-	tid, err := strconv.Atoi(query.Get("tournamentId"))
+	tournament, err := handleTournamentIn(w, r, dbi)
 	if err != nil {
+		return nil, err
+	}
+	backers, stakes, markup, err := handleSplitIn(w, r, dbi, tournament.GetId(), tournament.GetDeposit())
+	if err != nil {
+		return nil, err
+	}
+	if tournament.GetOptions().TeamSize > 0 {
 		http.Error(w, "", http.StatusBadRequest)
-		return nil, fmt.Errorf("can't parse tournament id %s: %+v", query.Get("tournamentId"), err)
+		return nil, fmt.Errorf("player %s joining team tournament %d without team",
+			query.Get("playerId"), tournament.GetId())
 	}
-	tournament := dbi.GetTournament(tid)
-	if tournament == nil {
-		http.Error(w, "", http.StatusNotFound)
-		return nil, fmt.Errorf("tournament %d not found", tid)
+	if err := tournament.CanJoin(); err != nil {
+		http.Error(w, "", stateCode(err, http.StatusConflict))
+		return nil, err
+	}
+	var ticket *model.Ticket
+	if query.Get("ticketId") != "" {
+		if ticket, err = handleTicketIn(w, r, dbi, tournament); err != nil {
+			return nil, err
+		}
 	}
+	return &inJoin{
+		Tournament: tournament,
+		PlayerId:   query.Get("playerId"),
+		Backers:    backers,
+		Stakes:     stakes,
+		Markup:     markup,
+		Ticket:     ticket,
+	}, nil
+}
+
+func handleTicketIn(w http.ResponseWriter, r *http.Request, dbi db.Interface, tournament *model.Tournament) (*model.Ticket, error) {
+	query := r.URL.Query()
+	if len(query["backerId"]) > 0 || len(query["stake"]) > 0 || query.Get("playerStake") != "" || query.Get("markup") != "" {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("passed backers with ticket to tournament %d", tournament.GetId())
+	}
+	ticketId, err := strconv.Atoi(query.Get("ticketId"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("invalid ticket id %s", query.Get("ticketId"))
+	}
+	ticket, err := dbi.GetTicket(r.Context(), ticketId)
+	if err != nil {
+		http.Error(w, "", dbCode(err))
+		return nil, fmt.Errorf("can't get ticket %d: %+v", ticketId, err)
+	}
+	if ticket.GetPlayerId() != query.Get("playerId") || ticket.GetTournamentId() != tournament.GetId() {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("ticket %d isn't redeemable by player %s in tournament %d",
+			ticketId, query.Get("playerId"), tournament.GetId())
+	}
+	return ticket, nil
+}
+
+// handleSplitIn parses the backers (the player placed in last position),
+// their parts of the price and the markup
+func handleSplitIn(w http.ResponseWriter, r *http.Request, dbi db.Interface, tid int, price model.Money) ([]string, []model.Money, model.Percent, error) {
+	query := r.URL.Query()
 	// NOTE: the player placed in last position
 	qplayers := append(query["backerId"], query.Get("playerId"))
 	for i, backerId := range qplayers {
@@ -60,28 +381,277 @@ func handleJoinIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*in
 			if i != j && id == backerId {
 				// duplicate found
 				http.Error(w, "", http.StatusBadRequest)
-				return nil, fmt.Errorf("passed duplicated player %s to tournament %d", backerId, tid)
+				return nil, nil, 0, fmt.Errorf("passed duplicated player %s to tournament %d", backerId, tid)
+			}
+		}
+
+		if _, err := dbi.GetPlayer(r.Context(), backerId); err != nil {
+			http.Error(w, "", dbCode(err))
+			return nil, nil, 0, fmt.Errorf("can't get player %s: %+v", backerId, err)
+		}
+	}
+	// NOTE: the player stake placed in last position too
+	qstakes := query["stake"]
+	if query.Get("playerStake") != "" {
+		qstakes = append(qstakes, query.Get("playerStake"))
+	}
+	stakes, err := parseStakes(qstakes, price, len(qplayers))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, nil, 0, fmt.Errorf("invalid stakes for tournament %d: %+v", tid, err)
+	}
+	markup := model.Hundred
+	if query.Get("markup") != "" {
+		if markup, err = model.ParseRatio(query.Get("markup")); err != nil || markup < model.Hundred {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, nil, 0, fmt.Errorf("invalid markup %s for tournament %d", query.Get("markup"), tid)
+		}
+	}
+	return qplayers, stakes, markup, nil
+}
+
+func handleBuyInIn(w http.ResponseWriter, r *http.Request, dbi db.Interface, kind model.BuyInKind) (*inBuyIn, error) {
+	query := r.URL.Query()
+	tournament, err := handleTournamentIn(w, r, dbi)
+	if err != nil {
+		return nil, err
+	}
+	tid := tournament.GetId()
+	playerId := query.Get("playerId")
+	if !tournament.HasPlayer(playerId) {
+		http.Error(w, "", http.StatusNotFound)
+		return nil, fmt.Errorf("player %s not found in tournament %d", playerId, tid)
+	}
+	// the original backers split is reused if no backers passed
+	reuse := len(query["backerId"]) == 0
+	if query.Get("reuse") != "" {
+		if reuse, err = strconv.ParseBool(query.Get("reuse")); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("can't parse reuse %s: %+v", query.Get("reuse"), err)
+		}
+	}
+	if reuse && (len(query["backerId"]) > 0 || len(query["stake"]) > 0 ||
+		query.Get("playerStake") != "" || query.Get("markup") != "") {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("passed new split to reuse in tournament %d", tid)
+	}
+
+	price := tournament.GetBuyInPrice(kind)
+	in := &inBuyIn{
+		Tournament: tournament,
+		PlayerId:   playerId,
+		Kind:       kind,
+	}
+	if reuse {
+		fund, stakes := tournament.GetSplit(playerId)
+		var paid []model.Money
+		in.Backers, paid = fundStakes(playerId, fund.Invert())
+		in.Stakes = price.Allocate(weights(fundParts(in.Backers, stakes)))
+		in.Incomes = price.Allocate(weights(paid))
+		for i := range in.Incomes {
+			in.Incomes[i] = -in.Incomes[i]
+		}
+	} else {
+		var markup model.Percent
+		if in.Backers, in.Stakes, markup, err = handleSplitIn(w, r, dbi, tid, price); err != nil {
+			return nil, err
+		}
+		in.Incomes = markupStakes(in.Stakes, markup)
+	}
+	if err := tournament.CanBuyIn(playerId, kind); err != nil {
+		http.Error(w, "", stateCode(err, http.StatusConflict))
+		return nil, err
+	}
+	return in, nil
+}
+
+// handleTournamentIn returns the tournament by the required tournament id,
+// unlike the results there is no fallback to the oldest open tournament
+func handleTournamentIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*model.Tournament, error) {
+	query := r.URL.Query()
+	tid, err := strconv.Atoi(query.Get("tournamentId"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("can't parse tournament id %s: %+v", query.Get("tournamentId"), err)
+	}
+	tournament, err := dbi.GetTournament(r.Context(), tid)
+	if err != nil {
+		http.Error(w, "", dbCode(err))
+		return nil, fmt.Errorf("can't get tournament %d: %+v", tid, err)
+	}
+	return tournament, nil
+}
+
+func handleLeaveIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inLeave, error) {
+	tournament, err := handleTournamentIn(w, r, dbi)
+	if err != nil {
+		return nil, err
+	}
+	playerId := r.URL.Query().Get("playerId")
+	if teamId := r.URL.Query().Get("teamId"); teamId != "" {
+		// the whole team leaves
+		playerId = teamId
+	}
+	if position, _ := tournament.GetWaiting(playerId); !tournament.HasPlayer(playerId) && position == 0 {
+		http.Error(w, "", http.StatusNotFound)
+		return nil, fmt.Errorf("player %s not found in tournament %d", playerId, tournament.GetId())
+	}
+	return &inLeave{
+		Tournament: tournament,
+		PlayerId:   playerId,
+	}, nil
+}
+
+// handleTeamIn parses the team members and backers with their parts of the deposit,
+// the deposit is split equally if no stakes passed
+func handleTeamIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inTeam, error) {
+	query := r.URL.Query()
+	tournament, err := handleTournamentIn(w, r, dbi)
+	if err != nil {
+		return nil, err
+	}
+	size := tournament.GetOptions().TeamSize
+	if size == 0 {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("tournament %d isn't a team tournament", tournament.GetId())
+	}
+	team := model.Team{Id: query.Get("teamId"), Members: query["memberId"]}
+	if err := team.Validate(size); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("invalid team for tournament %d: %+v", tournament.GetId(), err)
+	}
+	// NOTE: the team id is the entry key, so it can't be taken by a player
+	if _, err := dbi.GetPlayer(r.Context(), team.Id); err == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("team id %s taken by player", team.Id)
+	} else if !errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "", dbCode(err))
+		return nil, fmt.Errorf("can't get player %s: %+v", team.Id, err)
+	}
+	ids := append(query["backerId"], team.Members...)
+	for i, contributorId := range ids {
+		for j, id := range ids {
+			if i != j && id == contributorId {
+				http.Error(w, "", http.StatusBadRequest)
+				return nil, fmt.Errorf("passed duplicated player %s to team %s", contributorId, team.Id)
 			}
 		}
+		if _, err := dbi.GetPlayer(r.Context(), contributorId); err != nil {
+			http.Error(w, "", dbCode(err))
+			return nil, fmt.Errorf("can't get player %s: %+v", contributorId, err)
+		}
+	}
+	qstakes := append(query["stake"], query["memberStake"]...)
+	parts, err := parseStakes(qstakes, tournament.GetDeposit(), len(ids))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("invalid stakes for team %s: %+v", team.Id, err)
+	}
+	return &inTeam{
+		Tournament:   tournament,
+		Team:         team,
+		Contributors: ids,
+		Parts:        parts,
+	}, nil
+}
 
-		backer := dbi.GetPlayer(backerId)
-		if backer == nil {
+func handleEliminateIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inEliminate, error) {
+	query := r.URL.Query()
+	tournament, err := handleTournamentIn(w, r, dbi)
+	if err != nil {
+		return nil, err
+	}
+	playerId, eliminatorId := query.Get("playerId"), query.Get("eliminatorId")
+	if playerId == eliminatorId {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("player %s eliminated by the same player", playerId)
+	}
+	for _, id := range []string{playerId, eliminatorId} {
+		if !tournament.HasPlayer(id) {
 			http.Error(w, "", http.StatusNotFound)
-			return nil, fmt.Errorf("player %s not found", backerId)
+			return nil, fmt.Errorf("player %s not found in tournament %d", id, tournament.GetId())
 		}
 	}
-	return &inJoin{
+	return &inEliminate{
+		Tournament:   tournament,
+		PlayerId:     playerId,
+		EliminatorId: eliminatorId,
+	}, nil
+}
+
+func handleCancelIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inCancel, error) {
+	tournament, err := handleTournamentIn(w, r, dbi)
+	if err != nil {
+		return nil, err
+	}
+	return &inCancel{
 		Tournament: tournament,
-		PlayerId:   query.Get("playerId"),
-		Backers:    qplayers,
+		Reason:     r.URL.Query().Get("reason"),
 	}, nil
 }
 
-func handleResultIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inResult, error) {
+// parseStakes returns the deposit parts paid by each of n backers,
+// stakes are either percents of the deposit or points and must cover the deposit exactly,
+// the deposit is split equally if no stakes passed
+func parseStakes(stakes []string, deposit model.Money, n int) ([]model.Money, error) {
+	if len(stakes) == 0 {
+		return deposit.Split(n), nil
+	}
+	if len(stakes) != n {
+		return nil, fmt.Errorf("passed %d stakes for %d backers", len(stakes), n)
+	}
+
+	percents := strings.HasSuffix(stakes[0], "%")
+	weights := make([]int64, n)
+	var total int64
+	for i, stake := range stakes {
+		if strings.HasSuffix(stake, "%") != percents {
+			return nil, fmt.Errorf("passed both percent and points stakes")
+		}
+		if percents {
+			percent, err := model.ParsePercent(stake)
+			if err != nil {
+				return nil, err
+			}
+			weights[i] = int64(percent)
+		} else {
+			points, err := model.ParseMoney(stake)
+			if err != nil {
+				return nil, err
+			}
+			weights[i] = int64(points)
+		}
+		if weights[i] <= 0 {
+			return nil, fmt.Errorf("invalid stake %s", stake)
+		}
+		total += weights[i]
+	}
+
+	parts := deposit.Allocate(weights)
+	if percents && total != int64(model.Hundred) {
+		return nil, fmt.Errorf("stakes sum %s isn't %s", model.Percent(total), model.Hundred)
+	}
+	if !percents && total != int64(deposit) {
+		return nil, fmt.Errorf("stakes sum %s isn't deposit %s", model.Money(total), deposit)
+	}
+	for i, part := range parts {
+		if part <= 0 {
+			return nil, fmt.Errorf("stake %s is less than a point unit", stakes[i])
+		}
+	}
+	return parts, nil
+}
+
+func handleResultIn(w http.ResponseWriter, r *http.Request, dbi db.Interface, legacy bool) (*inResult, error) {
 	type inData struct {
-		Winners []struct {
-			PlayerId string  `json:"playerId"`
-			Prize    float64 `json:"prize"`
+		TournamentId *int     `json:"tournamentId"`
+		Places       []string `json:"places"`
+		Winners      []struct {
+			PlayerId string      `json:"playerId"`
+			Prize    model.Money `json:"prize"`
+			// the tournament the ticket awarded to instead of the prize
+			Ticket  *int       `json:"ticket"`
+			Expires *time.Time `json:"expires"`
 		} `json:"winners"`
 	}
 
@@ -94,15 +664,26 @@ func handleResultIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*
 		http.Error(w, "", http.StatusBadRequest)
 		return nil, fmt.Errorf("can't parse in json: %+v", err)
 	}
-	tournament := dbi.GetOldestTournament()
-	if tournament == nil {
-		http.Error(w, "", http.StatusNotFound)
-		return nil, fmt.Errorf("tournament not found")
+	var tournament *model.Tournament
+	var err error
+	if in.TournamentId != nil {
+		tournament, err = dbi.GetTournament(r.Context(), *in.TournamentId)
+	} else if legacy {
+		tournament, err = dbi.GetOldestTournament(r.Context())
+	} else {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("tournament id not passed")
+	}
+	if err != nil {
+		http.Error(w, "", dbCode(err))
+		return nil, fmt.Errorf("can't get tournament: %+v", err)
 	}
 	winners := make(model.Fund)
+	var tickets []*model.Ticket
+	ranking := in.Places
 	for i, winner := range in.Winners {
 		for j, wnr := range in.Winners {
-			if i != j && winner == wnr {
+			if i != j && winner.PlayerId == wnr.PlayerId {
 				http.Error(w, "", http.StatusBadRequest)
 				return nil, fmt.Errorf("passed duplicated player %s to tournament %d",
 					winner.PlayerId, tournament.GetId())
@@ -114,19 +695,180 @@ func handleResultIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*
 			return nil, fmt.Errorf("player %s not in tournament %d",
 				winner.PlayerId, tournament.GetId())
 		}
-		if winner.Prize <= 0 {
+		if winner.Ticket != nil {
+			if winner.Prize != 0 {
+				http.Error(w, "", http.StatusBadRequest)
+				return nil, fmt.Errorf("passed both prize and ticket for player %s", winner.PlayerId)
+			}
+		} else if winner.Prize <= 0 {
 			http.Error(w, "", http.StatusBadRequest)
-			return nil, fmt.Errorf("invalid prize %f for player %s", winner.Prize, winner.PlayerId)
+			return nil, fmt.Errorf("invalid prize %s for player %s", winner.Prize, winner.PlayerId)
 		}
-		player := dbi.GetPlayer(winner.PlayerId)
-		if player == nil {
-			http.Error(w, "", http.StatusNotFound)
-			return nil, fmt.Errorf("player %s not found", winner.PlayerId)
+		// NOTE: the winners of the team tournament are teams
+		_, team := tournament.GetTeam(winner.PlayerId)
+		if !team {
+			if _, err := dbi.GetPlayer(r.Context(), winner.PlayerId); err != nil {
+				http.Error(w, "", dbCode(err))
+				return nil, fmt.Errorf("can't get player %s: %+v", winner.PlayerId, err)
+			}
+		}
+		if team && winner.Ticket != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("passed ticket for team %s", winner.PlayerId)
+		}
+		ranking = append(ranking, winner.PlayerId)
+		if winner.Ticket == nil {
+			winners[winner.PlayerId] = winner.Prize
+			continue
+		}
+		target, err := dbi.GetTournament(r.Context(), *winner.Ticket)
+		if err != nil {
+			http.Error(w, "", dbCode(err))
+			return nil, fmt.Errorf("can't get ticket tournament %d: %+v", *winner.Ticket, err)
+		}
+		if target.GetId() == tournament.GetId() || target.GetState().IsEnded() {
+			http.Error(w, "", http.StatusUnprocessableEntity)
+			return nil, fmt.Errorf("can't award ticket to %s tournament %d", target.GetState(), target.GetId())
+		}
+		var expires time.Time
+		if winner.Expires != nil {
+			expires = *winner.Expires
+		}
+		tickets = append(tickets, model.NewTicket(winner.PlayerId, tournament.GetId(), target, expires))
+	}
+	payout := tournament.GetOptions().Payout
+	if payout == nil && len(in.Places) > 0 {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil, fmt.Errorf("passed places to tournament %d without payout", tournament.GetId())
+	}
+	// prizes plus rake can't exceed the collected pool
+	var prizes model.Money
+	for _, prize := range winners {
+		prizes += prize
+	}
+	for _, ticket := range tickets {
+		prizes += ticket.GetValue()
+	}
+	if pool, rake, _ := tournament.GetPrizePool(); prizes > pool {
+		http.Error(w, "", http.StatusUnprocessableEntity)
+		return nil, fmt.Errorf("prizes %s exceed tournament %d pool %s (rake %s)",
+			prizes, tournament.GetId(), pool, rake)
+	}
+	if payout != nil {
+		if len(in.Winners) > 0 {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("passed prizes to tournament %d with payout", tournament.GetId())
+		}
+		if paid := payout.PaidPlaces(tournament.GetEntrants()); len(in.Places) < paid {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("passed %d places to tournament %d with %d paid places",
+				len(in.Places), tournament.GetId(), paid)
+		}
+	}
+	for i, playerId := range in.Places {
+		for j, id := range in.Places {
+			if i != j && id == playerId {
+				http.Error(w, "", http.StatusBadRequest)
+				return nil, fmt.Errorf("passed duplicated player %s to tournament %d",
+					playerId, tournament.GetId())
+			}
+		}
+		if !tournament.HasPlayer(playerId) {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("player %s not in tournament %d", playerId, tournament.GetId())
 		}
-		winners[winner.PlayerId] = winner.Prize
 	}
 	return &inResult{
 		Tournament: tournament,
 		Winners:    winners,
+		Places:     in.Places,
+		Tickets:    tickets,
+		Ranking:    ranking,
 	}, nil
 }
+
+type inCancel struct {
+	Tournament *model.Tournament
+	Reason     string
+}
+
+type inLeave struct {
+	Tournament *model.Tournament
+	PlayerId   string
+}
+
+type inTeam struct {
+	Tournament *model.Tournament
+	Team       model.Team
+	// backers and members, the members placed in last positions
+	Contributors []string
+	// deposit parts paid by the contributors
+	Parts []model.Money
+}
+
+type inEliminate struct {
+	Tournament   *model.Tournament
+	PlayerId     string
+	EliminatorId string
+}
+
+type inHistory struct {
+	Player model.Player
+	Types  map[model.EntryType]bool
+	From   time.Time
+	To     time.Time
+	Offset int
+	Limit  int
+}
+
+func handleHistoryIn(w http.ResponseWriter, r *http.Request, dbi db.Interface) (*inHistory, error) {
+	query := r.URL.Query()
+	player, err := dbi.GetPlayer(r.Context(), query.Get("playerId"))
+	if err != nil {
+		http.Error(w, "", dbCode(err))
+		return nil, fmt.Errorf("can't get player %s: %+v", query.Get("playerId"), err)
+	}
+	in := &inHistory{
+		Player: player,
+		Types:  make(map[model.EntryType]bool),
+		Limit:  defaultHistoryLimit,
+	}
+	for _, typ := range query["type"] {
+		in.Types[model.EntryType(typ)] = true
+	}
+	if from := query.Get("from"); from != "" {
+		if in.From, err = time.Parse(time.RFC3339, from); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("can't parse from %s: %+v", from, err)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if in.To, err = time.Parse(time.RFC3339, to); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("can't parse to %s: %+v", to, err)
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if in.Offset, err = strconv.Atoi(offset); err != nil || in.Offset < 0 {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("invalid offset %s", offset)
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if in.Limit, err = strconv.Atoi(limit); err != nil || in.Limit <= 0 || in.Limit > maxHistoryLimit {
+			http.Error(w, "", http.StatusBadRequest)
+			return nil, fmt.Errorf("invalid limit %s", limit)
+		}
+	}
+	return in, nil
+}
+
+func handleFundIn(w http.ResponseWriter, r *http.Request) (int, error) {
+	query := r.URL.Query()
+	id, err := strconv.Atoi(query.Get("fundId"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return 0, fmt.Errorf("can't parse fund id %s: %+v", query.Get("fundId"), err)
+	}
+	return id, nil
+}
@@ -0,0 +1,178 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func Audit(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := r.Context()
+		query := r.URL.Query()
+		player, err := dbi.GetPlayer(ctx, query.Get("playerId"))
+		if err != nil {
+			fmt.Printf("ERROR: Audit(): can't get player %s: %+v\n", query.Get("playerId"), err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+
+		account := model.PlayerAccount(player.GetId())
+		balance, err := dbi.GetAccountBalance(ctx, account)
+		if err != nil {
+			fmt.Printf("ERROR: Audit(): can't get account %s balance: %+v\n", account, err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		entries, err := dbi.GetEntries(ctx, account)
+		if err != nil {
+			fmt.Printf("ERROR: Audit(): can't get account %s entries: %+v\n", account, err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		data := map[string]interface{}{
+			"playerId":      player.GetId(),
+			"balance":       player.GetBalance(),
+			"ledgerBalance": balance,
+			"entries":       len(entries),
+		}
+		resp, err := json.Marshal(data)
+		if err != nil {
+			fmt.Printf("ERROR: Audit(): can't marshal data %v: %+v\n", data, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(resp); err != nil {
+			fmt.Printf("ERROR: Audit(): can't write response %s: %+v\n", resp, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// HouseBalance reports the operator revenue: the house account balance and its amounts by entry type
+func HouseBalance(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := r.Context()
+		entries, err := dbi.GetEntries(ctx, model.HouseAccount)
+		if err != nil {
+			fmt.Printf("ERROR: HouseBalance(): can't get house entries: %+v\n", err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		balance, err := dbi.GetAccountBalance(ctx, model.HouseAccount)
+		if err != nil {
+			fmt.Printf("ERROR: HouseBalance(): can't get house balance: %+v\n", err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		amounts := make(map[model.EntryType]model.Money)
+		for _, entry := range entries {
+			amounts[entry.GetType()] += entry.Amount(model.HouseAccount)
+		}
+		data := map[string]interface{}{
+			"balance": balance,
+			"amounts": amounts,
+		}
+		resp, err := json.Marshal(data)
+		if err != nil {
+			fmt.Printf("ERROR: HouseBalance(): can't marshal data %v: %+v\n", data, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(resp); err != nil {
+			fmt.Printf("ERROR: HouseBalance(): can't write response %s: %+v\n", resp, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func History(dbi db.Interface) http.HandlerFunc {
+	type item struct {
+		Id           int             `json:"id"`
+		Time         time.Time       `json:"time"`
+		Type         model.EntryType `json:"type"`
+		TournamentId int             `json:"tournamentId,omitempty"`
+		Amount       model.Money     `json:"amount"`
+		Balance      model.Money     `json:"balance"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		in, err := handleHistoryIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: History(): can't handle input: %+v\n", err)
+			return
+		}
+
+		account := model.PlayerAccount(in.Player.GetId())
+		entries, err := dbi.GetEntries(r.Context(), account)
+		if err != nil {
+			fmt.Printf("ERROR: History(): can't get account %s entries: %+v\n", account, err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		items := []item{}
+		for _, entry := range entries {
+			if len(in.Types) > 0 && !in.Types[entry.GetType()] {
+				continue
+			}
+			if !in.From.IsZero() && entry.GetTime().Before(in.From) {
+				continue
+			}
+			if !in.To.IsZero() && !entry.GetTime().Before(in.To) {
+				continue
+			}
+			var balance model.Money
+			for _, p := range entry.GetPostings() {
+				if p.Account == account {
+					balance = p.Balance
+				}
+			}
+			items = append(items, item{
+				Id:           entry.GetId(),
+				Time:         entry.GetTime(),
+				Type:         entry.GetType(),
+				TournamentId: entry.GetTournamentId(),
+				Amount:       entry.Amount(account),
+				Balance:      balance,
+			})
+		}
+
+		total := len(items)
+		if in.Offset > total {
+			in.Offset = total
+		}
+		if end := in.Offset + in.Limit; end < total {
+			items = items[:end]
+		}
+		data := map[string]interface{}{
+			"playerId": in.Player.GetId(),
+			"total":    total,
+			"offset":   in.Offset,
+			"limit":    in.Limit,
+			"entries":  items[in.Offset:],
+		}
+		resp, err := json.Marshal(data)
+		if err != nil {
+			fmt.Printf("ERROR: History(): can't marshal data %v: %+v\n", data, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(resp); err != nil {
+			fmt.Printf("ERROR: History(): can't write response %s: %+v\n", resp, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func initTestLedger(t *testing.T) (db.Interface, *http.ServeMux) {
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	mux := initTestMux(dbi)
+
+	steps := []struct {
+		method string
+		uri    string
+		body   string
+	}{
+		{http.MethodPost, "/fund?playerId=10&points=10", ""},
+		{http.MethodPost, "/fund?playerId=20&points=20", ""},
+		{http.MethodPost, "/take?playerId=20&points=5", ""},
+		{http.MethodPost, "/announceTournament?tournamentId=1&deposit=10", ""},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=10&backerId=20", ""},
+		{http.MethodPost, "/resultTournament", `{"winners": [{"playerId": "10", "prize": 7}]}`},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(step.method, step.uri, strings.NewReader(step.body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+	}
+	return dbi, mux
+}
+
+func TestLedgerAudit(t *testing.T) {
+	ctx := context.Background()
+	dbi, mux := initTestLedger(t)
+
+	tests := []struct {
+		playerId    string
+		wantCode    int
+		wantBalance string
+		wantEntries int
+	}{
+		{"", http.StatusNotFound, "", 0},
+		{"30", http.StatusNotFound, "", 0},
+		{"10", http.StatusOK, "8.50", 3},
+		{"20", http.StatusOK, "13.50", 4},
+	}
+	for _, test := range tests {
+		uri := fmt.Sprintf("/audit?playerId=%s", test.playerId)
+		r, _ := http.NewRequest(http.MethodGet, uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("invalid code %d for uri %s", w.Code, uri)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var data struct {
+			Balance       model.Money `json:"balance"`
+			LedgerBalance model.Money `json:"ledgerBalance"`
+			Entries       int         `json:"entries"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+			t.Errorf("can't unmarshal body: %+v", err)
+		}
+		if data.Balance != model.MustParseMoney(test.wantBalance) || data.Balance != data.LedgerBalance {
+			t.Errorf("invalid balance for uri %s: want %s, got %s (ledger %s)",
+				uri, test.wantBalance, data.Balance, data.LedgerBalance)
+		}
+		if data.Entries != test.wantEntries {
+			t.Errorf("invalid entries for uri %s: want %d, got %d", uri, test.wantEntries, data.Entries)
+		}
+	}
+
+	accounts := []struct {
+		account model.Account
+		want    model.Money
+	}{
+		{model.ExternalAccount, model.Points(-25)},
+		{model.TournamentAccount(1), 0},
+		{model.HouseAccount, model.Points(3)},
+	}
+	for _, test := range accounts {
+		if balance := getAccountBalance(ctx, dbi, test.account); balance != test.want {
+			t.Errorf("invalid balance for account %s: want %s, got %s", test.account, test.want, balance)
+		}
+	}
+}
+
+func TestLedgerHistory(t *testing.T) {
+	_, mux := initTestLedger(t)
+
+	tests := []struct {
+		query       string
+		wantCode    int
+		wantTotal   int
+		wantTypes   []model.EntryType
+		wantAmounts []string
+		wantBalance []string
+	}{
+		{"playerId=30", http.StatusNotFound, 0, nil, nil, nil},
+		{"playerId=20&limit=0", http.StatusBadRequest, 0, nil, nil, nil},
+		{"playerId=20&offset=-1", http.StatusBadRequest, 0, nil, nil, nil},
+		{"playerId=20&from=qwe", http.StatusBadRequest, 0, nil, nil, nil},
+		{"playerId=20", http.StatusOK, 4,
+			[]model.EntryType{model.EntryFund, model.EntryTake, model.EntryBacker, model.EntryPrize},
+			[]string{"20", "-5", "-5", "3.5"},
+			[]string{"20", "15", "10", "13.5"}},
+		{"playerId=20&offset=1&limit=2", http.StatusOK, 4,
+			[]model.EntryType{model.EntryTake, model.EntryBacker},
+			[]string{"-5", "-5"},
+			[]string{"15", "10"}},
+		{"playerId=20&offset=10", http.StatusOK, 4, nil, nil, nil},
+		{"playerId=20&type=backer&type=prize", http.StatusOK, 2,
+			[]model.EntryType{model.EntryBacker, model.EntryPrize},
+			[]string{"-5", "3.5"},
+			[]string{"10", "13.5"}},
+		{"playerId=10&type=join", http.StatusOK, 1,
+			[]model.EntryType{model.EntryJoin},
+			[]string{"-5"},
+			[]string{"5"}},
+		{"playerId=20&from=2100-01-01T00:00:00Z", http.StatusOK, 0, nil, nil, nil},
+		{"playerId=20&to=2000-01-01T00:00:00Z", http.StatusOK, 0, nil, nil, nil},
+	}
+
+	for _, test := range tests {
+		uri := "/history?" + test.query
+		r, _ := http.NewRequest(http.MethodGet, uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("invalid code %d for uri %s", w.Code, uri)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var data struct {
+			Total   int `json:"total"`
+			Entries []struct {
+				Type         model.EntryType `json:"type"`
+				TournamentId int             `json:"tournamentId"`
+				Amount       model.Money     `json:"amount"`
+				Balance      model.Money     `json:"balance"`
+			} `json:"entries"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+			t.Errorf("can't unmarshal body: %+v", err)
+		}
+		if data.Total != test.wantTotal || len(data.Entries) != len(test.wantTypes) {
+			t.Errorf("invalid entries for uri %s: want %d of %d, got %d of %d",
+				uri, len(test.wantTypes), test.wantTotal, len(data.Entries), data.Total)
+			continue
+		}
+		for i, entry := range data.Entries {
+			if entry.Type != test.wantTypes[i] ||
+				entry.Amount != model.MustParseMoney(test.wantAmounts[i]) ||
+				entry.Balance != model.MustParseMoney(test.wantBalance[i]) {
+				t.Errorf("invalid entry %d for uri %s: %+v", i, uri, entry)
+			}
+			if (entry.Type == model.EntryBacker || entry.Type == model.EntryPrize) && entry.TournamentId != 1 {
+				t.Errorf("invalid tournament id for uri %s: want %d, got %d", uri, 1, entry.TournamentId)
+			}
+		}
+	}
+}
+
+func TestLedgerHouseBalance(t *testing.T) {
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	mux := initTestMux(dbi)
+
+	steps := []struct {
+		uri      string
+		body     string
+		wantCode int
+	}{
+		{"/fund?playerId=10&points=10", "", http.StatusOK},
+		{"/fund?playerId=20&points=20", "", http.StatusOK},
+		{"/announceTournament?tournamentId=1&deposit=10&fee=11", "", http.StatusBadRequest},
+		{"/announceTournament?tournamentId=1&deposit=10&fee=1&rake=10", "", http.StatusBadRequest},
+		{"/announceTournament?tournamentId=1&deposit=10&fee=1", "", http.StatusOK},
+		{"/joinTournament?tournamentId=1&playerId=10", "", http.StatusOK},
+		{"/joinTournament?tournamentId=1&playerId=20", "", http.StatusOK},
+		// the pool is 20 minus 2 fees
+		{"/resultTournament", `{"tournamentId": 1, "winners": [{"playerId": "10", "prize": 18.01}]}`,
+			http.StatusUnprocessableEntity},
+		{"/resultTournament", `{"tournamentId": 1, "winners": [{"playerId": "10", "prize": 15}]}`, http.StatusOK},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(http.MethodPost, step.uri, strings.NewReader(step.body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/houseBalance", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("invalid code %d for uri /houseBalance", w.Code)
+	}
+	var data struct {
+		Balance model.Money                     `json:"balance"`
+		Amounts map[model.EntryType]model.Money `json:"amounts"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+		t.Fatalf("can't unmarshal body: %+v", err)
+	}
+	if want := model.Points(5); data.Balance != want {
+		t.Errorf("invalid house balance: want %s, got %s", want, data.Balance)
+	}
+	for typ, want := range map[model.EntryType]model.Money{
+		model.EntryRake:   model.Points(2),
+		model.EntrySettle: model.Points(3),
+	} {
+		if data.Amounts[typ] != want {
+			t.Errorf("invalid house %s amount: want %s, got %s", typ, want, data.Amounts[typ])
+		}
+	}
+}
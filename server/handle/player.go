@@ -2,9 +2,9 @@ package handle
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/cnaize/lifland/db"
 	"github.com/cnaize/lifland/model"
@@ -12,58 +12,65 @@ import (
 
 func Take(dbi db.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		query := r.URL.Query()
-		player := dbi.GetPlayer(query.Get("playerId"))
-		if player == nil {
-			fmt.Printf("ERROR: Take(): player %s not found\n", query.Get("playerId"))
-			http.Error(w, "", http.StatusNotFound)
+		player, err := dbi.GetPlayer(ctx, query.Get("playerId"))
+		if err != nil {
+			fmt.Printf("ERROR: Take(): can't get player %s: %+v\n", query.Get("playerId"), err)
+			http.Error(w, "", dbCode(err))
 			return
 		}
 
-		points, err := strconv.ParseFloat(query.Get("points"), 64)
+		points, err := model.ParseMoney(query.Get("points"))
 		if err != nil || points <= 0 {
 			fmt.Printf("ERROR: Take(): invalid points: %s\n", query.Get("points"))
 			http.Error(w, "", http.StatusBadRequest)
 			return
 		}
 
-		if err := player.IncrBalance(-points); err != nil {
-			fmt.Printf("ERROR: Take(): can't take %f points from player %s: %+v\n",
+		entry := model.NewTransfer(model.EntryTake, 0,
+			model.PlayerAccount(player.GetId()), model.ExternalAccount, points)
+		if err := dbi.Post(ctx, entry); err != nil {
+			fmt.Printf("ERROR: Take(): can't take %s points from player %s: %+v\n",
 				points, player.GetId(), err)
 			http.Error(w, "", http.StatusUnprocessableEntity)
 			return
 		}
-		dbi.Dump()
+		dump(ctx, dbi)
 	}
 }
 
 func Fund(dbi db.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		query := r.URL.Query()
 		pid := query.Get("playerId")
-		points, err := strconv.ParseFloat(query.Get("points"), 64)
-		if pid == "" || err != nil || points <= 0 {
+		points, err := model.ParseMoney(query.Get("points"))
+		if model.ValidatePlayerId(pid) != nil || err != nil || points <= 0 {
 			fmt.Printf("ERROR: Fund(): invalid input: %v\n", r.URL.RawQuery)
 			http.Error(w, "", http.StatusBadRequest)
 			return
 		}
 
-		player := dbi.GetPlayer(pid)
-		if player == nil {
-			player = model.NewPlayer(pid)
-			if err := dbi.AddPlayer(player); err != nil {
-				fmt.Printf("ERROR: Fund(): can't add player: %+v\n", err)
-				http.Error(w, "", http.StatusInternalServerError)
-				return
-			}
+		player, err := dbi.GetPlayer(ctx, pid)
+		if errors.Is(err, db.ErrNotFound) {
+			player = *model.NewPlayer(pid)
+			err = dbi.AddPlayer(ctx, &player)
+		}
+		if err != nil {
+			fmt.Printf("ERROR: Fund(): can't add player: %+v\n", err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
 		}
-		if err := player.IncrBalance(points); err != nil {
-			fmt.Printf("ERROR: Fund(): can't give %f points to player %s: %+v\n",
+		entry := model.NewTransfer(model.EntryFund, 0,
+			model.ExternalAccount, model.PlayerAccount(player.GetId()), points)
+		if err := dbi.Post(ctx, entry); err != nil {
+			fmt.Printf("ERROR: Fund(): can't give %s points to player %s: %+v\n",
 				points, player.GetId(), err)
 			http.Error(w, "", http.StatusUnprocessableEntity)
 			return
 		}
-		dbi.Dump()
+		dump(ctx, dbi)
 	}
 }
 
@@ -72,10 +79,10 @@ func Balance(dbi db.Interface) http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 
 		query := r.URL.Query()
-		player := dbi.GetPlayer(query.Get("playerId"))
-		if player == nil {
-			fmt.Printf("ERROR: Balance(): player %s not found\n", query.Get("playerId"))
-			http.Error(w, "", http.StatusNotFound)
+		player, err := dbi.GetPlayer(r.Context(), query.Get("playerId"))
+		if err != nil {
+			fmt.Printf("ERROR: Balance(): can't get player %s: %+v\n", query.Get("playerId"), err)
+			http.Error(w, "", dbCode(err))
 			return
 		}
 
@@ -1,6 +1,7 @@
 package handle
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -11,10 +12,10 @@ import (
 
 	"github.com/cnaize/lifland/db"
 	"github.com/cnaize/lifland/model"
-	"github.com/cnaize/lifland/util"
 )
 
 func TestPlayerFund(t *testing.T) {
+	ctx := context.Background()
 	makeUri := func(id, points string) string {
 		return fmt.Sprintf("/fund?playerId=%s&points=%s", id, points)
 	}
@@ -23,25 +24,26 @@ func TestPlayerFund(t *testing.T) {
 		playerId    string
 		points      string
 		wantCode    int
-		wantBalance float64
+		wantBalance model.Money
 	}{
-		{"", "", http.StatusBadRequest, 10},
-		{"10", "", http.StatusBadRequest, 10},
-		{"", "10", http.StatusBadRequest, 10},
-		{"qwe", "10", http.StatusOK, 10},
-		{"10", "qwe", http.StatusBadRequest, 10},
-		{"10", "0", http.StatusBadRequest, 10},
-		{"10", "-10", http.StatusBadRequest, 10},
-		{"10", "20", http.StatusOK, 30},
-		{"30", "30", http.StatusOK, 30},
+		{"", "", http.StatusBadRequest, model.Points(10)},
+		{"10", "", http.StatusBadRequest, model.Points(10)},
+		{"", "10", http.StatusBadRequest, model.Points(10)},
+		{"qwe", "10", http.StatusOK, model.Points(10)},
+		{"qwe%232", "10", http.StatusBadRequest, 0},
+		{"10", "qwe", http.StatusBadRequest, model.Points(10)},
+		{"10", "0", http.StatusBadRequest, model.Points(10)},
+		{"10", "-10", http.StatusBadRequest, model.Points(10)},
+		{"10", "20", http.StatusOK, model.Points(30)},
+		{"30", "30", http.StatusOK, model.Points(30)},
 	}
 
 	for _, test := range tests {
 		player10 := model.NewPlayer("10")
-		player10.IncrBalance(10)
+		player10.IncrBalance(model.Points(10))
 		dbi := db.NewDB()
 		dbi.SetDebug(true)
-		dbi.AddPlayer(player10)
+		dbi.AddPlayer(ctx, player10)
 
 		uri := makeUri(test.playerId, test.points)
 		r, _ := http.NewRequest(http.MethodPost, uri, nil)
@@ -50,18 +52,19 @@ func TestPlayerFund(t *testing.T) {
 		if w.Code != test.wantCode {
 			t.Errorf("invalid code %d for uri %s", w.Code, uri)
 		}
-		player := dbi.GetPlayer(test.playerId)
-		if test.wantCode != http.StatusOK || player == nil {
+		player, err := dbi.GetPlayer(ctx, test.playerId)
+		if test.wantCode != http.StatusOK || err != nil {
 			continue
 		}
-		if util.Round(player.GetBalance()) != util.Round(test.wantBalance) {
-			t.Errorf("invalid balance for uri %s: want %f, got %f",
+		if player.GetBalance() != test.wantBalance {
+			t.Errorf("invalid balance for uri %s: want %s, got %s",
 				uri, test.wantBalance, player.GetBalance())
 		}
 	}
 }
 
 func TestPlayerTake(t *testing.T) {
+	ctx := context.Background()
 	makeUri := func(id, points string) string {
 		return fmt.Sprintf("/take?playerId=%s&points=%s", id, points)
 	}
@@ -70,7 +73,7 @@ func TestPlayerTake(t *testing.T) {
 		playerId    string
 		points      string
 		wantCode    int
-		wantBalance float64
+		wantBalance model.Money
 	}{
 		{"", "", http.StatusNotFound, 0},
 		{"10", "", http.StatusBadRequest, 0},
@@ -79,15 +82,15 @@ func TestPlayerTake(t *testing.T) {
 		{"10", "qwe", http.StatusBadRequest, 0},
 		{"10", "-10", http.StatusBadRequest, 0},
 		{"10", "10.1", http.StatusUnprocessableEntity, 0},
-		{"10", "9.9", http.StatusOK, 0.1},
+		{"10", "9.9", http.StatusOK, model.MustParseMoney("0.1")},
 	}
 
 	for _, test := range tests {
 		player10 := model.NewPlayer("10")
-		player10.IncrBalance(10)
+		player10.IncrBalance(model.Points(10))
 		dbi := db.NewDB()
 		dbi.SetDebug(true)
-		dbi.AddPlayer(player10)
+		dbi.AddPlayer(ctx, player10)
 
 		uri := makeUri(test.playerId, test.points)
 		r, _ := http.NewRequest(http.MethodPost, uri, nil)
@@ -96,31 +99,32 @@ func TestPlayerTake(t *testing.T) {
 		if w.Code != test.wantCode {
 			t.Errorf("invalid code %d for uri %s", w.Code, uri)
 		}
-		player := dbi.GetPlayer(test.playerId)
-		if test.wantCode != http.StatusOK || player == nil {
+		player, err := dbi.GetPlayer(ctx, test.playerId)
+		if test.wantCode != http.StatusOK || err != nil {
 			continue
 		}
-		if util.Round(player.GetBalance()) != util.Round(test.wantBalance) {
-			t.Errorf("invalid balance for uri %s: want %f, got %f",
+		if player.GetBalance() != test.wantBalance {
+			t.Errorf("invalid balance for uri %s: want %s, got %s",
 				uri, test.wantBalance, player.GetBalance())
 		}
 	}
 }
 
 func TestPlayerBalance(t *testing.T) {
+	ctx := context.Background()
 	makeUri := func(id string) string {
 		return fmt.Sprintf("/balance?playerId=%s", id)
 	}
 
 	player10 := model.NewPlayer("10")
-	player10.IncrBalance(10)
+	player10.IncrBalance(model.Points(10))
 	player10Data := map[string]interface{}{
 		"playerId": "10",
 		"balance":  10.0,
 	}
 	dbi := db.NewDB()
 	dbi.SetDebug(true)
-	dbi.AddPlayer(player10)
+	dbi.AddPlayer(ctx, player10)
 
 	tests := []struct {
 		playerId string
@@ -0,0 +1,82 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+const maxIdAttempts int = 3
+
+// Schedule creates the upcoming tournaments of the templates
+// and makes the scheduled tournaments transitions due at the time,
+// the expired tickets and the tickets of the cancelled tournaments are settled too
+func Schedule(ctx context.Context, dbi db.Interface, now time.Time) {
+	var changed bool
+	templates, err := dbi.GetTemplates(ctx)
+	if err != nil {
+		fmt.Printf("ERROR: Schedule(): can't get templates: %+v\n", err)
+	}
+	for _, template := range templates {
+		var starts []time.Time
+		updated, err := dbi.UpdateTemplate(ctx, template.GetId(), func(t *model.Template) error {
+			starts = t.Upcoming(now)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("ERROR: Schedule(): can't update template %s: %+v\n", template.GetId(), err)
+			continue
+		}
+		template = updated
+		for _, start := range starts {
+			// NOTE: the generated id may be taken by the announced tournament meanwhile
+			for i := 0; i < maxIdAttempts; i++ {
+				id, err := dbi.NextTournamentId(ctx)
+				if err == nil {
+					tournament := template.NewTournament(id, start)
+					if err = dbi.AddTournament(ctx, tournament); err == nil {
+						break
+					}
+				}
+				fmt.Printf("ERROR: Schedule(): can't add template %s tournament: %+v\n",
+					template.GetId(), err)
+			}
+			changed = true
+		}
+	}
+	tournaments, err := dbi.GetTournaments(ctx)
+	if err != nil {
+		fmt.Printf("ERROR: Schedule(): can't get tournaments: %+v\n", err)
+	}
+	for _, tournament := range tournaments {
+		state, ok := tournament.Due(now)
+		if !ok {
+			continue
+		}
+		var err error
+		switch state {
+		case model.StateRegistration:
+			_, err = dbi.UpdateTournament(ctx, tournament.GetId(), (*model.Tournament).OpenRegistration)
+		case model.StateRunning:
+			var cancelled bool
+			if tournament, cancelled, err = startTournament(ctx, dbi, tournament.GetId()); cancelled {
+				fmt.Printf("ERROR: Schedule(): tournament %d cancelled: %s\n",
+					tournament.GetId(), tournament.GetCancelReason())
+			}
+		}
+		if err != nil {
+			fmt.Printf("ERROR: Schedule(): can't transit tournament to %s: %+v\n", state, err)
+			continue
+		}
+		changed = true
+	}
+	if settleTickets(ctx, dbi, now) {
+		changed = true
+	}
+	if changed {
+		dump(ctx, dbi)
+	}
+}
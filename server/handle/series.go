@@ -0,0 +1,130 @@
+package handle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func CreateSeries(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		in, err := handleSeriesIn(w, r)
+		if err != nil {
+			fmt.Printf("ERROR: CreateSeries(): can't handle input: %+v\n", err)
+			return
+		}
+		series, err := model.NewSeries(in.SeriesId, in.Formula, in.Prizes)
+		if err != nil {
+			fmt.Printf("ERROR: CreateSeries(): can't create series %s: %+v\n", in.SeriesId, err)
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		if err := dbi.AddSeries(r.Context(), series); err != nil {
+			fmt.Printf("ERROR: CreateSeries(): can't add series %s: %+v\n", in.SeriesId, err)
+			http.Error(w, "", http.StatusConflict)
+			return
+		}
+		dump(r.Context(), dbi)
+	}
+}
+
+// Standings returns the page of the series standings recomputed from the tournaments results
+func Standings(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		in, err := handleStandingsIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: Standings(): can't handle input: %+v\n", err)
+			return
+		}
+
+		tournaments, err := dbi.GetTournaments(r.Context())
+		if err != nil {
+			fmt.Printf("ERROR: Standings(): can't get tournaments: %+v\n", err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		standings := in.Series.Standings(tournaments)
+		total := len(standings)
+		if in.Offset > total {
+			in.Offset = total
+		}
+		if end := in.Offset + in.Limit; end < total {
+			standings = standings[:end]
+		}
+		data := map[string]interface{}{
+			"seriesId":  in.Series.GetId(),
+			"formula":   in.Series.GetFormula(),
+			"total":     total,
+			"offset":    in.Offset,
+			"limit":     in.Limit,
+			"standings": standings[in.Offset:],
+		}
+		if paidAt, ok := in.Series.GetPaidAt(); ok {
+			data["paidAt"] = paidAt
+		}
+		resp, err := json.Marshal(data)
+		if err != nil {
+			fmt.Printf("ERROR: Standings(): can't marshal data %v: %+v\n", data, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(resp); err != nil {
+			fmt.Printf("ERROR: Standings(): can't write response %s: %+v\n", resp, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// PaySeries freezes the series standings and pays the season prizes from the house account
+func PaySeries(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		seriesId := r.URL.Query().Get("seriesId")
+		tournaments, err := dbi.GetTournaments(ctx)
+		if err != nil {
+			fmt.Printf("ERROR: PaySeries(): can't get tournaments: %+v\n", err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		tx := dbi.Begin()
+		defer tx.Rollback()
+		tx.UpdateSeries(seriesId, func(s *model.Series) error {
+			if err := s.Pay(time.Now()); err != nil {
+				return err
+			}
+			standings := s.Standings(tournaments)
+			payouts := s.Payouts(standings)
+			for _, standing := range standings {
+				prize, ok := payouts[standing.PlayerId]
+				if !ok {
+					break
+				}
+				stageTransfer(tx, model.EntrySeason, 0, model.HouseAccount,
+					model.PlayerAccount(standing.PlayerId), prize)
+			}
+			return nil
+		})
+		// NOTE: the prizes are paid from the rake collected by the house
+		tx.Cover(model.HouseAccount)
+		err = tx.Commit(ctx)
+		if errors.Is(err, db.ErrNotFound) {
+			fmt.Printf("ERROR: PaySeries(): series %s not found: %+v\n", seriesId, err)
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fmt.Printf("ERROR: PaySeries(): can't pay series %s: %+v\n", seriesId, err)
+			http.Error(w, "", txCode(err))
+			return
+		}
+		dump(ctx, dbi)
+	}
+}
@@ -0,0 +1,149 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func TestSeries(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(20))
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	steps := []struct {
+		method   string
+		uri      string
+		body     string
+		wantCode int
+	}{
+		{http.MethodPost, "/createSeries?seriesId=S&formula=qwe", "", http.StatusBadRequest},
+		{http.MethodPost, "/createSeries?seriesId=S&formula=linear&prizes=10,qwe", "", http.StatusBadRequest},
+		{http.MethodPost, "/createSeries?seriesId=S&formula=linear&prizes=10,5", "", http.StatusOK},
+		{http.MethodPost, "/createSeries?seriesId=S&formula=linear", "", http.StatusConflict},
+		{http.MethodGet, "/standings?seriesId=X", "", http.StatusNotFound},
+		{http.MethodPost, "/announceTournament?tournamentId=1&deposit=5&seriesId=X", "", http.StatusNotFound},
+		{http.MethodPost, "/announceTournament?tournamentId=1&deposit=8&seriesId=S&registration=true", "", http.StatusOK},
+		{http.MethodPost, "/announceTournament?tournamentId=2&deposit=8&seriesId=S&registration=true", "", http.StatusOK},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=10", "", http.StatusOK},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=20", "", http.StatusOK},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=30", "", http.StatusOK},
+		{http.MethodPost, "/joinTournament?tournamentId=2&playerId=10", "", http.StatusOK},
+		{http.MethodPost, "/joinTournament?tournamentId=2&playerId=20", "", http.StatusOK},
+		{http.MethodPost, "/startTournament?tournamentId=1", "", http.StatusOK},
+		{http.MethodPost, "/startTournament?tournamentId=2", "", http.StatusOK},
+		// the winners order is the finishing places
+		{http.MethodPost, "/resultTournament",
+			`{"tournamentId": 1, "winners": [{"playerId": "30", "prize": 10}, {"playerId": "20", "prize": 5}]}`,
+			http.StatusOK},
+		{http.MethodPost, "/resultTournament", `{"tournamentId": 2, "winners": [{"playerId": "10", "prize": 10}]}`,
+			http.StatusOK},
+		{http.MethodGet, "/standings?seriesId=S&limit=0", "", http.StatusBadRequest},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(step.method, step.uri, strings.NewReader(step.body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/standings?seriesId=S&offset=1&limit=1", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	var data struct {
+		Total     int              `json:"total"`
+		Standings []model.Standing `json:"standings"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+		t.Fatalf("can't unmarshal body: %+v", err)
+	}
+	want := model.Standing{Rank: 2, PlayerId: "10", Points: 2, Tournaments: 1}
+	if data.Total != 3 || len(data.Standings) != 1 || data.Standings[0] != want {
+		t.Errorf("invalid standings: %+v", data)
+	}
+
+	for _, wantCode := range []int{http.StatusOK, http.StatusConflict} {
+		r, _ := http.NewRequest(http.MethodPost, "/paySeries?seriesId=S", nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != wantCode {
+			t.Fatalf("invalid code %d for series payout", w.Code)
+		}
+	}
+	// the tied players share the second prize
+	for id, want := range map[string]string{"10": "16.5", "20": "11.5", "30": "32"} {
+		if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+			t.Errorf("invalid balance for player %s: want %s, got %s", id, want, balance)
+		}
+	}
+	// the prizes are paid from the pools left to the house
+	if house := getAccountBalance(ctx, dbi, model.HouseAccount); house != 0 {
+		t.Errorf("invalid house balance: want 0, got %s", house)
+	}
+}
+
+func TestSeriesHouse(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(20))
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	steps := []struct {
+		method   string
+		uri      string
+		body     string
+		wantCode int
+	}{
+		{http.MethodPost, "/createSeries?seriesId=S&formula=linear&prizes=10", "", http.StatusOK},
+		{http.MethodPost, "/announceTournament?tournamentId=1&deposit=5&seriesId=S&registration=true", "", http.StatusOK},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=10", "", http.StatusOK},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=20", "", http.StatusOK},
+		{http.MethodPost, "/startTournament?tournamentId=1", "", http.StatusOK},
+		{http.MethodPost, "/resultTournament", `{"tournamentId": 1, "winners": [{"playerId": "10", "prize": 10}]}`,
+			http.StatusOK},
+		// the house can't cover the prizes
+		{http.MethodPost, "/paySeries?seriesId=S", "", http.StatusUnprocessableEntity},
+		// the pool left after the prizes goes to the house
+		{http.MethodPost, "/announceTournament?tournamentId=2&deposit=5&registration=true", "", http.StatusOK},
+		{http.MethodPost, "/joinTournament?tournamentId=2&playerId=10", "", http.StatusOK},
+		{http.MethodPost, "/joinTournament?tournamentId=2&playerId=20", "", http.StatusOK},
+		{http.MethodPost, "/startTournament?tournamentId=2", "", http.StatusOK},
+		{http.MethodPost, "/resultTournament", `{"tournamentId": 2, "winners": []}`, http.StatusOK},
+		{http.MethodPost, "/paySeries?seriesId=S", "", http.StatusOK},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(step.method, step.uri, strings.NewReader(step.body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+	}
+	for id, want := range map[string]string{"10": "30", "20": "10"} {
+		if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+			t.Errorf("invalid balance for player %s: want %s, got %s", id, want, balance)
+		}
+	}
+	if house := getAccountBalance(ctx, dbi, model.HouseAccount); house != 0 {
+		t.Errorf("invalid house balance: want 0, got %s", house)
+	}
+}
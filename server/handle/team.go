@@ -0,0 +1,138 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+// RegisterTeam joins the team to the team tournament charging the members and backers parts
+func RegisterTeam(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		in, err := handleTeamIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: RegisterTeam(): can't handle input: %+v\n", err)
+			return
+		}
+		tx := dbi.Begin()
+		defer tx.Rollback()
+		fund := makeFund(tx, in.Tournament, model.EntryJoin, in.Contributors, teamIncomes(in.Parts))
+		tx.UpdateTournament(in.Tournament.GetId(), func(t *model.Tournament) error {
+			return t.AddTeam(in.Team, fund)
+		})
+		if err := tx.Commit(ctx); err != nil {
+			fmt.Printf("ERROR: RegisterTeam(): can't add team %s to tournament %d: %+v\n",
+				in.Team.Id, in.Tournament.GetId(), err)
+			http.Error(w, "", txCode(err))
+			return
+		}
+		dump(ctx, dbi)
+	}
+}
+
+// AmendTeam replaces the team members and parts before the start,
+// only the differences with the current parts are charged and refunded
+func AmendTeam(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		in, err := handleTeamIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: AmendTeam(): can't handle input: %+v\n", err)
+			return
+		}
+		if _, ok := in.Tournament.GetTeam(in.Team.Id); !ok {
+			fmt.Printf("ERROR: AmendTeam(): team %s not found in tournament %d\n",
+				in.Team.Id, in.Tournament.GetId())
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		tid := in.Tournament.GetId()
+		old, _ := in.Tournament.GetSplit(in.Team.Id)
+		fund := partsFund(in.Contributors, teamIncomes(in.Parts))
+
+		var ids []string
+		diff := model.Fund{}
+		for id, income := range fund {
+			diff[id] += income
+		}
+		for id, income := range old {
+			diff[id] -= income
+		}
+		for id := range diff {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		var chargeIds, refundIds []string
+		for _, id := range ids {
+			if diff[id] < 0 {
+				chargeIds = append(chargeIds, id)
+			} else if diff[id] > 0 {
+				refundIds = append(refundIds, id)
+			}
+		}
+
+		tx := dbi.Begin()
+		defer tx.Rollback()
+		makeFund(tx, in.Tournament, model.EntryJoin, chargeIds, fundParts(chargeIds, diff))
+		tx.UpdateTournament(tid, func(t *model.Tournament) error {
+			return t.AmendTeam(in.Team, fund, old)
+		})
+		makeFund(tx, in.Tournament, model.EntryRefund, refundIds, fundParts(refundIds, diff))
+		if err := tx.Commit(ctx); err != nil {
+			fmt.Printf("ERROR: AmendTeam(): can't amend team %s in tournament %d: %+v\n",
+				in.Team.Id, tid, err)
+			http.Error(w, "", txCode(err))
+			return
+		}
+		dump(ctx, dbi)
+	}
+}
+
+// Teams returns the tournament teams with the deposit parts paid by the members and backers
+func Teams(dbi db.Interface) http.HandlerFunc {
+	type item struct {
+		Id      string     `json:"id"`
+		Members []string   `json:"members"`
+		Parts   model.Fund `json:"parts"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		tournament, err := handleTournamentIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: Teams(): can't handle input: %+v\n", err)
+			return
+		}
+		items := []item{}
+		for _, team := range tournament.GetTeams() {
+			fund, _ := tournament.GetSplit(team.Id)
+			items = append(items, item{Id: team.Id, Members: team.Members, Parts: fund.Invert()})
+		}
+		resp, err := json.Marshal(items)
+		if err != nil {
+			fmt.Printf("ERROR: Teams(): can't marshal data %v: %+v\n", items, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(resp); err != nil {
+			fmt.Printf("ERROR: Teams(): can't write response %s: %+v\n", resp, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// teamIncomes returns the charges of the deposit parts
+func teamIncomes(parts []model.Money) []model.Money {
+	incomes := make([]model.Money, len(parts))
+	for i, part := range parts {
+		incomes[i] = -part
+	}
+	return incomes
+}
@@ -0,0 +1,95 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func TestTeam(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30", "40"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(20))
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	steps := []struct {
+		uri          string
+		wantCode     int
+		wantBalances map[string]string
+	}{
+		{"/announceTournament?tournamentId=1&deposit=10&teamSize=qwe", http.StatusBadRequest, nil},
+		{"/announceTournament?tournamentId=1&deposit=10&teamSize=2&registration=true", http.StatusOK, nil},
+		{"/joinTournament?tournamentId=1&playerId=10", http.StatusBadRequest, nil},
+		{"/registerTeam?tournamentId=1&teamId=10&memberId=10", http.StatusBadRequest, nil},
+		{"/registerTeam?tournamentId=1&teamId=A&memberId=10&memberId=20&memberId=30", http.StatusBadRequest, nil},
+		{"/registerTeam?tournamentId=1&teamId=A&memberId=10&memberId=50", http.StatusNotFound, nil},
+		{"/registerTeam?tournamentId=1&teamId=A&memberId=10&memberId=20&memberStake=4&memberStake=4",
+			http.StatusBadRequest, nil},
+		{"/registerTeam?tournamentId=1&teamId=A&memberId=10&memberId=20&backerId=40&stake=2&memberStake=4&memberStake=4",
+			http.StatusOK, map[string]string{"10": "16", "20": "16", "40": "18"}},
+		{"/registerTeam?tournamentId=1&teamId=A&memberId=30", http.StatusConflict, nil},
+		{"/registerTeam?tournamentId=1&teamId=B&memberId=20", http.StatusConflict, nil},
+		// the failed registrations charge nothing
+		{"/registerTeam?tournamentId=1&teamId=B&memberId=30", http.StatusOK, map[string]string{"30": "10"}},
+		{"/amendTeam?tournamentId=1&teamId=C&memberId=20", http.StatusNotFound, nil},
+		// only the differences are charged and refunded
+		{"/amendTeam?tournamentId=1&teamId=A&memberId=10&backerId=40&stake=5&memberStake=5",
+			http.StatusOK, map[string]string{"10": "15", "40": "15"}},
+		{"/startTournament?tournamentId=1", http.StatusOK, nil},
+		{"/amendTeam?tournamentId=1&teamId=A&memberId=10&memberId=20", http.StatusConflict, nil},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(http.MethodPost, step.uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+		for id, want := range step.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for uri %s and player %s: want %s, got %s", step.uri, id, want, balance)
+			}
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/teams?tournamentId=1", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	var teams []struct {
+		Id      string     `json:"id"`
+		Members []string   `json:"members"`
+		Parts   model.Fund `json:"parts"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&teams); err != nil {
+		t.Fatalf("can't unmarshal body: %+v", err)
+	}
+	if len(teams) != 2 || teams[0].Id != "A" || len(teams[0].Members) != 1 ||
+		teams[0].Parts["40"] != model.Points(5) || teams[1].Id != "B" {
+		t.Errorf("invalid teams: %+v", teams)
+	}
+
+	// the team prize is shared by the members and backers stakes
+	body := `{"tournamentId": 1, "winners": [{"playerId": "A", "prize": 20}]}`
+	r, _ = http.NewRequest(http.MethodPost, "/resultTournament", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("invalid code %d for result %s", w.Code, body)
+	}
+	for id, want := range map[string]string{"10": "25", "20": "20", "30": "10", "40": "25"} {
+		if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+			t.Errorf("invalid balance for player %s: want %s, got %s", id, want, balance)
+		}
+	}
+}
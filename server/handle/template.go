@@ -0,0 +1,121 @@
+package handle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func CreateTemplate(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		in, err := handleTemplateIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: CreateTemplate(): can't handle input: %+v\n", err)
+			return
+		}
+		template, err := model.NewTemplate(in.TemplateId, in.Settings)
+		if err != nil {
+			fmt.Printf("ERROR: CreateTemplate(): can't create template %s: %+v\n", in.TemplateId, err)
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		if err := dbi.AddTemplate(r.Context(), template); err != nil {
+			fmt.Printf("ERROR: CreateTemplate(): can't add template %s: %+v\n", in.TemplateId, err)
+			http.Error(w, "", http.StatusConflict)
+			return
+		}
+		dump(r.Context(), dbi)
+	}
+}
+
+// UpdateTemplate replaces the template settings, the created tournaments aren't changed
+func UpdateTemplate(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		in, err := handleTemplateIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: UpdateTemplate(): can't handle input: %+v\n", err)
+			return
+		}
+		_, err = dbi.UpdateTemplate(r.Context(), in.TemplateId, func(t *model.Template) error {
+			return t.SetSettings(in.Settings)
+		})
+		if errors.Is(err, db.ErrNotFound) {
+			fmt.Printf("ERROR: UpdateTemplate(): template %s not found\n", in.TemplateId)
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fmt.Printf("ERROR: UpdateTemplate(): can't update template %s: %+v\n", in.TemplateId, err)
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		dump(r.Context(), dbi)
+	}
+}
+
+func DeleteTemplate(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		templateId := r.URL.Query().Get("templateId")
+		if _, err := dbi.GetTemplate(r.Context(), templateId); err != nil {
+			fmt.Printf("ERROR: DeleteTemplate(): can't get template %s: %+v\n", templateId, err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		if err := dbi.DelTemplate(r.Context(), templateId); err != nil {
+			fmt.Printf("ERROR: DeleteTemplate(): can't delete template %s: %+v\n", templateId, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		dump(r.Context(), dbi)
+	}
+}
+
+// Templates returns the template by id or all the templates if id not passed
+func Templates(dbi db.Interface) http.HandlerFunc {
+	type item struct {
+		Id string `json:"id"`
+		model.TemplateSettings
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var data interface{}
+		if templateId := r.URL.Query().Get("templateId"); templateId != "" {
+			template, err := dbi.GetTemplate(r.Context(), templateId)
+			if err != nil {
+				fmt.Printf("ERROR: Templates(): can't get template %s: %+v\n", templateId, err)
+				http.Error(w, "", dbCode(err))
+				return
+			}
+			data = item{Id: template.GetId(), TemplateSettings: template.GetSettings()}
+		} else {
+			templates, err := dbi.GetTemplates(r.Context())
+			if err != nil {
+				fmt.Printf("ERROR: Templates(): can't get templates: %+v\n", err)
+				http.Error(w, "", dbCode(err))
+				return
+			}
+			items := []item{}
+			for _, template := range templates {
+				items = append(items, item{Id: template.GetId(), TemplateSettings: template.GetSettings()})
+			}
+			data = items
+		}
+		resp, err := json.Marshal(data)
+		if err != nil {
+			fmt.Printf("ERROR: Templates(): can't marshal data %v: %+v\n", data, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(resp); err != nil {
+			fmt.Printf("ERROR: Templates(): can't write response %s: %+v\n", resp, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
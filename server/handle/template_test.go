@@ -0,0 +1,99 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func TestTemplate(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	mux := initTestMux(dbi)
+
+	recurrence := url.QueryEscape("*/10 * * * *")
+	steps := []struct {
+		method   string
+		uri      string
+		wantCode int
+	}{
+		{http.MethodPost, "/createTemplate?templateId=t10&deposit=10&recurrence=qwe", http.StatusBadRequest},
+		{http.MethodPost, "/createTemplate?templateId=t10&recurrence=" + recurrence, http.StatusBadRequest},
+		{http.MethodPost, "/createTemplate?templateId=t10&deposit=10&ahead=qwe&recurrence=" + recurrence,
+			http.StatusBadRequest},
+		{http.MethodPost, "/createTemplate?templateId=t10&deposit=10&maxPlayers=9&ahead=1h&recurrence=" + recurrence,
+			http.StatusOK},
+		{http.MethodPost, "/createTemplate?templateId=t10&deposit=10&recurrence=" + recurrence, http.StatusConflict},
+		{http.MethodPost, "/createTemplate?templateId=daily&deposit=5&recurrence=@daily", http.StatusOK},
+		{http.MethodPost, "/updateTemplate?templateId=t20&deposit=20&recurrence=@daily", http.StatusNotFound},
+		{http.MethodPost, "/updateTemplate?templateId=t10&deposit=20&ahead=1h&recurrence=" + recurrence, http.StatusOK},
+		{http.MethodPost, "/deleteTemplate?templateId=daily", http.StatusOK},
+		{http.MethodPost, "/deleteTemplate?templateId=daily", http.StatusNotFound},
+		{http.MethodGet, "/templates?templateId=daily", http.StatusNotFound},
+		{http.MethodPost, "/announceTournament?tournamentId=5&deposit=10", http.StatusOK},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(step.method, step.uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/templates", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	var templates []struct {
+		Id      string      `json:"id"`
+		Deposit model.Money `json:"deposit"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&templates); err != nil {
+		t.Fatalf("can't unmarshal body: %+v", err)
+	}
+	if len(templates) != 1 || templates[0].Id != "t10" || templates[0].Deposit != model.Points(20) {
+		t.Errorf("invalid templates: %+v", templates)
+	}
+
+	// the tournaments are created an hour ahead with the ids after the announced one
+	Schedule(ctx, dbi, time.Now())
+	tournaments := getTournaments(ctx, dbi)
+	if len(tournaments) != 7 {
+		t.Fatalf("invalid tournaments number: want 7, got %d", len(tournaments))
+	}
+	for i, tournament := range tournaments[1:] {
+		if tournament.GetId() != 6+i || tournament.GetTemplateId() != "t10" {
+			t.Errorf("invalid template tournament %d: %+v", tournament.GetId(), tournament)
+		}
+		if tournament.GetDeposit() != model.Points(20) || tournament.GetState() != model.StateRegistration {
+			t.Errorf("invalid template tournament %d deposit %s and state %s",
+				tournament.GetId(), tournament.GetDeposit(), tournament.GetState())
+		}
+	}
+	Schedule(ctx, dbi, time.Now())
+	if len(getTournaments(ctx, dbi)) != 7 {
+		t.Errorf("template tournaments created twice")
+	}
+
+	// the templates are dumped with DB
+	b, err := json.Marshal(dbi)
+	if err != nil {
+		t.Fatalf("can't marshal db: %+v", err)
+	}
+	restored := db.NewDB()
+	if err := json.Unmarshal(b, restored); err != nil {
+		t.Fatalf("can't unmarshal db: %+v", err)
+	}
+	_, err = restored.GetTemplate(ctx, "t10")
+	if id, _ := restored.NextTournamentId(ctx); err != nil || id != 12 {
+		t.Errorf("templates aren't restored")
+	}
+}
@@ -1,19 +1,77 @@
 package handle
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
 )
 
 func initTestMux(dbi db.Interface) *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/reset", Log(Reset(dbi)))
 	mux.HandleFunc("/balance", Log(Balance(dbi)))
-	mux.HandleFunc("/take", Log(Take(dbi)))
-	mux.HandleFunc("/fund", Log(Fund(dbi)))
-	mux.HandleFunc("/announceTournament", Log(Announce(dbi)))
-	mux.HandleFunc("/joinTournament", Log(Join(dbi)))
-	mux.HandleFunc("/resultTournament", Log(Result(dbi)))
+	mux.HandleFunc("/take", Log(Idempotent(dbi, Take(dbi))))
+	mux.HandleFunc("/fund", Log(Idempotent(dbi, Fund(dbi))))
+	mux.HandleFunc("/audit", Log(Audit(dbi)))
+	mux.HandleFunc("/history", Log(History(dbi)))
+	mux.HandleFunc("/houseBalance", Log(HouseBalance(dbi)))
+	mux.HandleFunc("/funds", Log(Funds(dbi)))
+	mux.HandleFunc("/retryFund", Log(Idempotent(dbi, RetryFund(dbi))))
+	mux.HandleFunc("/reassignFund", Log(Idempotent(dbi, ReassignFund(dbi))))
+	mux.HandleFunc("/writeOffFund", Log(Idempotent(dbi, WriteOffFund(dbi))))
+	mux.HandleFunc("/createTemplate", Log(Idempotent(dbi, CreateTemplate(dbi))))
+	mux.HandleFunc("/updateTemplate", Log(Idempotent(dbi, UpdateTemplate(dbi))))
+	mux.HandleFunc("/deleteTemplate", Log(Idempotent(dbi, DeleteTemplate(dbi))))
+	mux.HandleFunc("/templates", Log(Templates(dbi)))
+	mux.HandleFunc("/createSeries", Log(Idempotent(dbi, CreateSeries(dbi))))
+	mux.HandleFunc("/standings", Log(Standings(dbi)))
+	mux.HandleFunc("/paySeries", Log(Idempotent(dbi, PaySeries(dbi))))
+	mux.HandleFunc("/announceTournament", Log(Idempotent(dbi, Announce(dbi))))
+	mux.HandleFunc("/openRegistration", Log(Idempotent(dbi, OpenRegistration(dbi))))
+	mux.HandleFunc("/startTournament", Log(Idempotent(dbi, Start(dbi))))
+	mux.HandleFunc("/joinTournament", Log(Idempotent(dbi, Join(dbi))))
+	mux.HandleFunc("/leaveTournament", Log(Idempotent(dbi, Leave(dbi))))
+	mux.HandleFunc("/waitlist", Log(Waitlist(dbi)))
+	mux.HandleFunc("/rebuyTournament", Log(Idempotent(dbi, BuyIn(dbi, model.BuyInRebuy))))
+	mux.HandleFunc("/reentryTournament", Log(Idempotent(dbi, BuyIn(dbi, model.BuyInReentry))))
+	mux.HandleFunc("/addonTournament", Log(Idempotent(dbi, BuyIn(dbi, model.BuyInAddon))))
+	mux.HandleFunc("/resultTournament", Log(Idempotent(dbi, Result(dbi, true))))
+	mux.HandleFunc("/cancelTournament", Log(Idempotent(dbi, Cancel(dbi))))
+	mux.HandleFunc("/eliminate", Log(Idempotent(dbi, Eliminate(dbi))))
+	mux.HandleFunc("/registerTeam", Log(Idempotent(dbi, RegisterTeam(dbi))))
+	mux.HandleFunc("/amendTeam", Log(Idempotent(dbi, AmendTeam(dbi))))
+	mux.HandleFunc("/teams", Log(Teams(dbi)))
+	mux.HandleFunc("/tickets", Log(Tickets(dbi)))
 	return mux
 }
+
+// newTestTournament returns the tournament with opened registration
+func newTestTournament(id int, deposit model.Money) *model.Tournament {
+	tournament := model.NewTournament(id, deposit)
+	tournament.OpenRegistration()
+	return tournament
+}
+
+// getBalance returns the player balance, zero if the player not found
+func getBalance(ctx context.Context, dbi db.Interface, playerId string) model.Money {
+	player, _ := dbi.GetPlayer(ctx, playerId)
+	return player.GetBalance()
+}
+
+func getAccountBalance(ctx context.Context, dbi db.Interface, account model.Account) model.Money {
+	balance, _ := dbi.GetAccountBalance(ctx, account)
+	return balance
+}
+
+// getTournament returns the tournament copy, nil if the tournament not found
+func getTournament(ctx context.Context, dbi db.Interface, id int) *model.Tournament {
+	tournament, _ := dbi.GetTournament(ctx, id)
+	return tournament
+}
+
+func getTournaments(ctx context.Context, dbi db.Interface) []*model.Tournament {
+	tournaments, _ := dbi.GetTournaments(ctx)
+	return tournaments
+}
@@ -0,0 +1,139 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+// Tickets returns the player tickets, all the tickets if the player not passed
+func Tickets(dbi db.Interface) http.HandlerFunc {
+	type item struct {
+		Id           int               `json:"id"`
+		PlayerId     string            `json:"playerId"`
+		SourceId     int               `json:"sourceId"`
+		TournamentId int               `json:"tournamentId"`
+		Value        model.Money       `json:"value"`
+		Expires      *time.Time        `json:"expires,omitempty"`
+		State        model.TicketState `json:"state"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		playerId := r.URL.Query().Get("playerId")
+		if playerId != "" {
+			if _, err := dbi.GetPlayer(r.Context(), playerId); err != nil {
+				fmt.Printf("ERROR: Tickets(): can't get player %s: %+v\n", playerId, err)
+				http.Error(w, "", dbCode(err))
+				return
+			}
+		}
+		tickets, err := dbi.GetTickets(r.Context(), playerId)
+		if err != nil {
+			fmt.Printf("ERROR: Tickets(): can't get tickets: %+v\n", err)
+			http.Error(w, "", dbCode(err))
+			return
+		}
+		items := []item{}
+		for _, ticket := range tickets {
+			it := item{
+				Id:           ticket.GetId(),
+				PlayerId:     ticket.GetPlayerId(),
+				SourceId:     ticket.GetSourceId(),
+				TournamentId: ticket.GetTournamentId(),
+				Value:        ticket.GetValue(),
+				State:        ticket.GetState(),
+			}
+			if expires := ticket.GetExpires(); !expires.IsZero() {
+				it.Expires = &expires
+			}
+			items = append(items, it)
+		}
+		resp, err := json.Marshal(items)
+		if err != nil {
+			fmt.Printf("ERROR: Tickets(): can't marshal data %v: %+v\n", items, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(resp); err != nil {
+			fmt.Printf("ERROR: Tickets(): can't write response %s: %+v\n", resp, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// awardTickets stages the tickets value moved from the tournament pool to the tickets account
+func awardTickets(tx db.Tx, tid int, tickets []*model.Ticket) {
+	for _, ticket := range tickets {
+		stageTransfer(tx, model.EntryTicket, tid, model.TournamentAccount(tid), model.TicketsAccount, ticket.GetValue())
+		tx.AddTicket(ticket)
+	}
+}
+
+// redeemTicket joins the player paying with the ticket instead of the deposit
+func redeemTicket(ctx context.Context, dbi db.Interface, in *inJoin) (int, error) {
+	tid := in.Tournament.GetId()
+	value := in.Ticket.GetValue()
+	tx := dbi.Begin()
+	defer tx.Rollback()
+	tx.UpdateTicket(in.Ticket.GetId(), func(t *model.Ticket) error {
+		return t.Use(in.PlayerId, tid, time.Now())
+	})
+	tx.Post(model.NewTransfer(model.EntryRedeem, tid, model.TicketsAccount, model.TournamentAccount(tid), value))
+	// NOTE: the refunded ticket join returns points, not the ticket
+	tx.UpdateTournament(tid, func(t *model.Tournament) error {
+		return t.AddPlayerWithStakes(in.PlayerId, model.Fund{in.PlayerId: -value}, nil)
+	})
+	if err := tx.Commit(ctx); err != nil {
+		return txCode(err), err
+	}
+	return http.StatusOK, nil
+}
+
+// settleTickets converts the active tickets of the cancelled tournaments to points
+// and moves the expired tickets value to the house, reports whether any ticket settled
+func settleTickets(ctx context.Context, dbi db.Interface, now time.Time) bool {
+	tickets, err := dbi.GetTickets(ctx, "")
+	if err != nil {
+		fmt.Printf("ERROR: settleTickets(): can't get tickets: %+v\n", err)
+		return false
+	}
+	var settled bool
+	for _, ticket := range tickets {
+		if ticket.GetState() != model.TicketActive {
+			continue
+		}
+		typ, state, to := model.EntryExpire, model.TicketExpired, model.HouseAccount
+		target, err := dbi.GetTournament(ctx, ticket.GetTournamentId())
+		switch {
+		case errors.Is(err, db.ErrNotFound) || err == nil && target.IsCancelled():
+			typ, state, to = model.EntryConvert, model.TicketConverted, model.PlayerAccount(ticket.GetPlayerId())
+		case err != nil:
+			fmt.Printf("ERROR: settleTickets(): can't get ticket %d tournament: %+v\n", ticket.GetId(), err)
+			continue
+		case ticket.IsExpired(now) || target.GetState() == model.StateFinished:
+		default:
+			continue
+		}
+		tx := dbi.Begin()
+		tx.UpdateTicket(ticket.GetId(), func(t *model.Ticket) error {
+			return t.Close(state)
+		})
+		stageTransfer(tx, typ, ticket.GetTournamentId(), model.TicketsAccount, to, ticket.GetValue())
+		if err := tx.Commit(ctx); err != nil {
+			// e.g. redeemed meanwhile
+			fmt.Printf("ERROR: settleTickets(): can't settle ticket %d: %+v\n", ticket.GetId(), err)
+			continue
+		}
+		settled = true
+	}
+	return settled
+}
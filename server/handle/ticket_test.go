@@ -0,0 +1,121 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func TestTournamentTickets(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(20))
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	expired := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	steps := []struct {
+		method       string
+		uri          string
+		body         string
+		wantCode     int
+		wantBalances map[string]string
+	}{
+		{http.MethodPost, "/announceTournament?tournamentId=1&deposit=10&registration=true", "", http.StatusOK, nil},
+		{http.MethodPost, "/announceTournament?tournamentId=2&deposit=10&registration=true", "", http.StatusOK, nil},
+		{http.MethodPost, "/announceTournament?tournamentId=3&deposit=10", "", http.StatusOK, nil},
+		{http.MethodPost, "/announceTournament?tournamentId=4&deposit=5&registration=true", "", http.StatusOK, nil},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=10", "", http.StatusOK, nil},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=20", "", http.StatusOK, nil},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=30", "", http.StatusOK,
+			map[string]string{"10": "10", "20": "10", "30": "10"}},
+		{http.MethodPost, "/startTournament?tournamentId=1", "", http.StatusOK, nil},
+		{http.MethodPost, "/resultTournament", `{"tournamentId": 1, "winners": [{"playerId": "10", "prize": 5, "ticket": 2}]}`,
+			http.StatusBadRequest, nil},
+		{http.MethodPost, "/resultTournament", `{"tournamentId": 1, "winners": [{"playerId": "10", "ticket": 5}]}`,
+			http.StatusNotFound, nil},
+		{http.MethodPost, "/resultTournament", `{"tournamentId": 1, "winners": [{"playerId": "10", "ticket": 1}]}`,
+			http.StatusUnprocessableEntity, nil},
+		{http.MethodPost, "/resultTournament", fmt.Sprintf(`{"tournamentId": 1, "winners": [
+			{"playerId": "10", "ticket": 2}, {"playerId": "20", "ticket": 3},
+			{"playerId": "30", "ticket": 4, "expires": %q}]}`, expired), http.StatusOK,
+			map[string]string{"10": "10", "20": "10", "30": "10"}},
+		{http.MethodPost, "/joinTournament?tournamentId=2&playerId=20&ticketId=1", "", http.StatusBadRequest, nil},
+		{http.MethodPost, "/joinTournament?tournamentId=2&playerId=10&ticketId=1&backerId=20", "",
+			http.StatusBadRequest, nil},
+		{http.MethodPost, "/joinTournament?tournamentId=2&playerId=10&ticketId=9", "", http.StatusNotFound, nil},
+		{http.MethodPost, "/joinTournament?tournamentId=2&playerId=10&ticketId=1", "", http.StatusOK,
+			map[string]string{"10": "10"}},
+		{http.MethodPost, "/joinTournament?tournamentId=2&playerId=10&ticketId=1", "", http.StatusConflict, nil},
+		{http.MethodPost, "/joinTournament?tournamentId=4&playerId=30&ticketId=3", "", http.StatusConflict,
+			map[string]string{"30": "10"}},
+		// the unused ticket converts to points
+		{http.MethodPost, "/cancelTournament?tournamentId=3", "", http.StatusOK,
+			map[string]string{"20": "20"}},
+		// the redeemed ticket is refunded in points
+		{http.MethodPost, "/cancelTournament?tournamentId=2", "", http.StatusOK,
+			map[string]string{"10": "20"}},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(step.method, step.uri, strings.NewReader(step.body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s and body %s", w.Code, step.uri, step.body)
+		}
+		for id, want := range step.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for uri %s and player %s: want %s, got %s", step.uri, id, want, balance)
+			}
+		}
+	}
+
+	// the expired ticket value goes to the house
+	Schedule(ctx, dbi, time.Now())
+	if house := getAccountBalance(ctx, dbi, model.HouseAccount); house != model.Points(10) {
+		t.Errorf("invalid house balance: want 10, got %s", house)
+	}
+	if tickets := getAccountBalance(ctx, dbi, model.TicketsAccount); tickets != 0 {
+		t.Errorf("invalid tickets balance: want 0, got %s", tickets)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/tickets", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	var tickets []struct {
+		Id       int               `json:"id"`
+		PlayerId string            `json:"playerId"`
+		State    model.TicketState `json:"state"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&tickets); err != nil {
+		t.Fatalf("can't unmarshal body: %+v", err)
+	}
+	want := []model.TicketState{model.TicketUsed, model.TicketConverted, model.TicketExpired}
+	if len(tickets) != len(want) {
+		t.Fatalf("invalid tickets number: want %d, got %d", len(want), len(tickets))
+	}
+	for i, ticket := range tickets {
+		if ticket.Id != i+1 || ticket.State != want[i] {
+			t.Errorf("invalid ticket %d: want state %s, got %+v", i+1, want[i], ticket)
+		}
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/tickets?playerId=40", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("invalid code %d for unknown player tickets", w.Code)
+	}
+}
@@ -1,114 +1,578 @@
 package handle
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/cnaize/lifland/db"
 	"github.com/cnaize/lifland/model"
-	"github.com/cnaize/lifland/util"
 )
 
 func Announce(dbi db.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		in, err := handleAnnounceIn(w, r, dbi)
 		if err != nil {
 			fmt.Printf("ERROR: Announce(): can't handle input: %+v\n", err)
 			return
 		}
 		tournament := model.NewTournament(in.TournamentId, in.Deposit)
-		if err = dbi.AddTournament(tournament); err != nil {
+		tournament.SetOptions(in.Options)
+		if in.Schedule != nil {
+			tournament.SetSchedule(*in.Schedule)
+		}
+		if in.Registration {
+			tournament.OpenRegistration()
+		}
+		if err = dbi.AddTournament(ctx, tournament); err != nil {
 			fmt.Printf("ERROR: Announce(): can't add tournament %d: %+v\n",
 				tournament.GetId(), err)
 			http.Error(w, "", http.StatusConflict)
 			return
 		}
-		dbi.Dump()
+		dump(ctx, dbi)
+	}
+}
+
+func OpenRegistration(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tournament, err := handleTournamentIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: OpenRegistration(): can't handle input: %+v\n", err)
+			return
+		}
+		if _, err := dbi.UpdateTournament(ctx, tournament.GetId(), (*model.Tournament).OpenRegistration); err != nil {
+			fmt.Printf("ERROR: OpenRegistration(): can't open tournament %d registration: %+v\n",
+				tournament.GetId(), err)
+			http.Error(w, "", stateCode(err, http.StatusConflict))
+			return
+		}
+		dump(ctx, dbi)
+	}
+}
+
+func Start(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tournament, err := handleTournamentIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: Start(): can't handle input: %+v\n", err)
+			return
+		}
+		tournament, cancelled, err := startTournament(ctx, dbi, tournament.GetId())
+		if err != nil {
+			fmt.Printf("ERROR: Start(): can't start tournament: %+v\n", err)
+			http.Error(w, "", stateCode(err, http.StatusConflict))
+			return
+		}
+		if cancelled {
+			fmt.Printf("ERROR: Start(): tournament %d cancelled: %s\n",
+				tournament.GetId(), tournament.GetCancelReason())
+			http.Error(w, "", http.StatusConflict)
+		}
+		dump(ctx, dbi)
 	}
 }
 
 func Join(dbi db.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		in, err := handleJoinIn(w, r, dbi)
 		if err != nil {
 			fmt.Printf("ERROR: Join(): can't handle input: %+v\n", err)
 			return
 		}
-		fund, err := makeFund(in.Backers, -in.Tournament.GetDeposit(), dbi)
-		defer func() {
-			if fund == nil {
+		tid := in.Tournament.GetId()
+		if in.Ticket != nil {
+			if code, err := redeemTicket(ctx, dbi, in); err != nil {
+				fmt.Printf("ERROR: Join(): player %s can't redeem ticket %d in tournament %d: %+v\n",
+					in.PlayerId, in.Ticket.GetId(), tid, err)
+				http.Error(w, "", code)
 				return
 			}
-			dbi.AddFund(fund.Invert())
-		}()
-		if err != nil {
-			fmt.Printf("ERROR: Join(): player %s can't make fund for tournament %d: %+v\n",
-				in.PlayerId, in.Tournament.GetId(), err)
-			http.Error(w, "", http.StatusUnprocessableEntity)
-		} else if err := in.Tournament.AddPlayer(in.PlayerId, fund); err != nil {
+			dump(ctx, dbi)
+			return
+		}
+		paid := markupStakes(in.Stakes, in.Markup)
+		stakes := makeStakes(in.Backers, in.Stakes, paid)
+		// the full tournament defers the charge until a seat opens
+		var position int
+		var tournament *model.Tournament
+		tx := dbi.Begin()
+		defer tx.Rollback()
+		tx.UpdateTournament(tid, func(t *model.Tournament) error {
+			var err error
+			position, err = t.Wait(in.PlayerId, partsFund(in.Backers, paid), stakes)
+			if err != nil || position > 0 {
+				tournament = t.Clone()
+				return err
+			}
+			fund := makeFund(tx, t, model.EntryJoin, in.Backers, paid)
+			return t.AddPlayerWithStakes(in.PlayerId, fund, stakes)
+		})
+		if err := tx.Commit(ctx); err != nil {
 			fmt.Printf("ERROR: Join(): can't add player %s to tournament %d: %+v\n",
-				in.PlayerId, in.Tournament.GetId(), err)
-			http.Error(w, "", http.StatusConflict)
-		} else {
-			dbi.Dump()
-			fund = nil
+				in.PlayerId, tid, err)
+			http.Error(w, "", txCode(err))
+			return
+		}
+		dump(ctx, dbi)
+		if position > 0 {
+			writeWaiting(w, tournament, in.PlayerId, http.StatusAccepted)
 		}
 	}
 }
 
-func Result(dbi db.Interface) http.HandlerFunc {
+// BuyIn makes the rebuy, re-entry or add-on of the joined player
+func BuyIn(dbi db.Interface, kind model.BuyInKind) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		in, err := handleResultIn(w, r, dbi)
+		ctx := r.Context()
+		in, err := handleBuyInIn(w, r, dbi, kind)
 		if err != nil {
-			fmt.Printf("ERROR: Result(): can't parse input: %+v\n", err)
+			fmt.Printf("ERROR: BuyIn(): can't handle %s input: %+v\n", kind, err)
+			return
+		}
+		tid := in.Tournament.GetId()
+		tx := dbi.Begin()
+		defer tx.Rollback()
+		fund := makeFund(tx, in.Tournament, kind.EntryType(), in.Backers, in.Incomes)
+		tx.UpdateTournament(tid, func(t *model.Tournament) error {
+			return t.AddBuyIn(in.PlayerId, kind, fund, makeStakes(in.Backers, in.Stakes, in.Incomes))
+		})
+		if err := tx.Commit(ctx); err != nil {
+			fmt.Printf("ERROR: BuyIn(): can't add player %s %s to tournament %d: %+v\n",
+				in.PlayerId, kind, tid, err)
+			http.Error(w, "", txCode(err))
 			return
 		}
-		funds, err := in.Tournament.Close()
+		dump(ctx, dbi)
+	}
+}
+
+func Result(dbi db.Interface, legacy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		in, err := handleResultIn(w, r, dbi, legacy)
 		if err != nil {
-			fmt.Printf("ERROR: Result(): can't close tournament %d: %+v\n",
-				in.Tournament.GetId(), err)
-			http.Error(w, "", http.StatusConflict)
+			fmt.Printf("ERROR: Result(): can't parse input: %+v\n", err)
 			return
 		}
-		for winnerId, prize := range in.Winners {
-			var playerIds []string
-			for playerId, _ := range funds[winnerId] {
-				playerIds = append(playerIds, playerId)
+		// NOTE: the winners are checked on close, so they can't leave the tournament meanwhile
+		winnerIds := append([]string{}, in.Places...)
+		for winnerId := range in.Winners {
+			winnerIds = append(winnerIds, winnerId)
+		}
+		for _, ticket := range in.Tickets {
+			winnerIds = append(winnerIds, ticket.GetPlayerId())
+		}
+		tid := in.Tournament.GetId()
+		pool := model.TournamentAccount(tid)
+		tx := dbi.Begin()
+		defer tx.Rollback()
+		tx.UpdateTournament(tid, func(t *model.Tournament) error {
+			if _, err := t.Close(winnerIds...); err != nil {
+				return err
+			}
+			prizePool, rake, overlay := t.GetPrizePool()
+			stageTransfer(tx, model.EntryRake, tid, pool, model.HouseAccount, rake)
+			stageTransfer(tx, model.EntryOverlay, tid, model.HouseAccount, pool, overlay)
+			winners := in.Winners
+			if payout := t.GetOptions().Payout; payout != nil {
+				winners = model.Fund{}
+				for i, prize := range payout.Prizes(prizePool, t.GetEntrants()) {
+					if i < len(in.Places) {
+						winners[in.Places[i]] = prize
+					}
+				}
 			}
-			if fund, err := makeFund(playerIds, prize, dbi); err != nil {
-				dbi.AddFund(fund.Invert())
+			for winnerId, prize := range winners {
+				payShares(tx, t, model.EntryPrize, winnerId, prize)
 			}
+			// the bounties not collected by eliminators return to their owners
+			for playerId, bounty := range t.GetBounties() {
+				payShares(tx, t, model.EntryBounty, playerId, bounty)
+			}
+			return t.FinishWithPlaces(in.Ranking)
+		})
+		// NOTE: the tickets aren't shared with the backers
+		awardTickets(tx, tid, in.Tickets)
+		tx.Settle(model.EntrySettle, tid, pool, model.HouseAccount)
+		if err := tx.Commit(ctx); err != nil {
+			fmt.Printf("ERROR: Result(): can't settle tournament %d: %+v\n", tid, err)
+			http.Error(w, "", txCode(err))
+			return
 		}
-		dbi.Dump()
+		dump(ctx, dbi)
 	}
 }
 
-func makeFund(playerIds []string, points float64, dbi db.Interface) (model.Fund, error) {
-	fund := model.Fund{}
-	perPlayer := util.Round(points / util.Round(float64(len(playerIds))))
-	for i, id := range playerIds {
-		income := perPlayer
-		// take rest of points from the player
-		// NOTE: the player placed in last position
-		if i == len(playerIds)-1 {
-			income = points - float64(len(playerIds)-1)*perPlayer
+func Cancel(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		in, err := handleCancelIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: Cancel(): can't handle input: %+v\n", err)
+			return
 		}
+		tid := in.Tournament.GetId()
+		var funds map[string]model.Fund
+		tx := dbi.Begin()
+		defer tx.Rollback()
+		tx.UpdateTournament(tid, func(t *model.Tournament) error {
+			var err error
+			funds, err = t.Cancel(in.Reason)
+			refund(tx, t, funds)
+			return err
+		})
+		// the bounties already paid are covered by the house
+		tx.Settle(model.EntryOverlay, tid, model.TournamentAccount(tid), model.HouseAccount)
+		if err := tx.Commit(ctx); err != nil {
+			fmt.Printf("ERROR: Cancel(): can't cancel tournament %d: %+v\n", tid, err)
+			http.Error(w, "", txCode(err))
+			return
+		}
+		if funds == nil {
+			// already cancelled
+			return
+		}
+		settleTickets(ctx, dbi, time.Now())
+		dump(ctx, dbi)
+	}
+}
 
-		player := dbi.GetPlayer(id)
-		if player == nil {
-			fmt.Printf("ERROR: makeFund(): player %s not found", id)
-			break
+// Leave removes the player from the tournament before start and refunds the contributors
+func Leave(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		in, err := handleLeaveIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: Leave(): can't handle input: %+v\n", err)
+			return
+		}
+		tid := in.Tournament.GetId()
+		tx := dbi.Begin()
+		defer tx.Rollback()
+		tx.UpdateTournament(tid, func(t *model.Tournament) error {
+			funds, err := t.Remove(in.PlayerId)
+			refund(tx, t, funds)
+			return err
+		})
+		if err := tx.Commit(ctx); err != nil {
+			fmt.Printf("ERROR: Leave(): player %s can't leave tournament %d: %+v\n",
+				in.PlayerId, tid, err)
+			http.Error(w, "", txCode(err))
+			return
 		}
-		if err := player.IncrBalance(income); err != nil {
-			fmt.Printf("makeFund(): can't increase player %s balance by %f points: %+v\n",
-				id, points, err)
+		seatWaiting(ctx, dbi, tid)
+		dump(ctx, dbi)
+	}
+}
+
+// Eliminate records the knockout and pays the bounty to the eliminator according to the action shares
+func Eliminate(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		in, err := handleEliminateIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: Eliminate(): can't handle input: %+v\n", err)
+			return
+		}
+		tid := in.Tournament.GetId()
+		var elimination model.Elimination
+		var eliminatorBounty model.Money
+		tx := dbi.Begin()
+		defer tx.Rollback()
+		tx.UpdateTournament(tid, func(t *model.Tournament) error {
+			var err error
+			elimination, err = t.Eliminate(in.PlayerId, in.EliminatorId)
+			if err != nil {
+				return err
+			}
+			payShares(tx, t, model.EntryBounty, in.EliminatorId, elimination.Bounty)
+			eliminatorBounty = t.GetBounty(in.EliminatorId)
+			return nil
+		})
+		if err := tx.Commit(ctx); err != nil {
+			fmt.Printf("ERROR: Eliminate(): player %s can't eliminate player %s in tournament %d: %+v\n",
+				in.EliminatorId, in.PlayerId, tid, err)
+			http.Error(w, "", txCode(err))
+			return
+		}
+		dump(ctx, dbi)
+
+		data := map[string]interface{}{
+			"tournamentId": tid,
+			"playerId":     in.PlayerId,
+			"eliminatorId": in.EliminatorId,
+			"bounty":       elimination.Bounty,
+			// the eliminator bounty after the progressive part added
+			"eliminatorBounty": eliminatorBounty,
+		}
+		resp, err := json.Marshal(data)
+		if err != nil {
+			fmt.Printf("ERROR: Eliminate(): can't marshal data %v: %+v\n", data, err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(resp); err != nil {
+			fmt.Printf("ERROR: Eliminate(): can't write response %s: %+v\n", resp, err)
+		}
+	}
+}
+
+// Waitlist returns the player position in the tournament waitlist
+func Waitlist(dbi db.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tournament, err := handleTournamentIn(w, r, dbi)
+		if err != nil {
+			fmt.Printf("ERROR: Waitlist(): can't handle input: %+v\n", err)
+			return
+		}
+		playerId := r.URL.Query().Get("playerId")
+		if position, _ := tournament.GetWaiting(playerId); position == 0 {
+			fmt.Printf("ERROR: Waitlist(): player %s doesn't wait for tournament %d\n", playerId, tournament.GetId())
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeWaiting(w, tournament, playerId, http.StatusOK)
+	}
+}
+
+func writeWaiting(w http.ResponseWriter, tournament *model.Tournament, playerId string, code int) {
+	position, size := tournament.GetWaiting(playerId)
+	data := map[string]interface{}{
+		"tournamentId": tournament.GetId(),
+		"playerId":     playerId,
+		"position":     position,
+		"size":         size,
+	}
+	resp, err := json.Marshal(data)
+	if err != nil {
+		fmt.Printf("ERROR: writeWaiting(): can't marshal data %v: %+v\n", data, err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(resp); err != nil {
+		fmt.Printf("ERROR: writeWaiting(): can't write response %s: %+v\n", resp, err)
+	}
+}
+
+// startTournament starts the tournament or cancels it with refunds if there are less than min players,
+// the updated tournament is returned
+func startTournament(ctx context.Context, dbi db.Interface, tid int) (*model.Tournament, bool, error) {
+	var cancelled bool
+	var tournament *model.Tournament
+	tx := dbi.Begin()
+	defer tx.Rollback()
+	tx.UpdateTournament(tid, func(t *model.Tournament) error {
+		var funds map[string]model.Fund
+		var err error
+		cancelled, funds, err = t.StartOrCancel()
+		refund(tx, t, funds)
+		tournament = t.Clone()
+		return err
+	})
+	if err := tx.Commit(ctx); err != nil || !cancelled {
+		return tournament, false, err
+	}
+	settleTickets(ctx, dbi, time.Now())
+	return tournament, true, nil
+}
+
+// seatWaiting charges the waiting players while there are free seats,
+// the players who can't pay are dropped from the waitlist
+func seatWaiting(ctx context.Context, dbi db.Interface, tid int) {
+	for {
+		var waiting model.Waiting
+		var ok bool
+		tournament, err := dbi.UpdateTournament(ctx, tid, func(t *model.Tournament) error {
+			waiting, ok = t.PopWaiting()
+			return nil
+		})
+		if err != nil || !ok {
+			return
+		}
+		ids, incomes := fundStakes(waiting.PlayerId, waiting.Fund)
+		tx := dbi.Begin()
+		fund := makeFund(tx, tournament, model.EntryJoin, ids, incomes)
+		tx.UpdateTournament(tid, func(t *model.Tournament) error {
+			return t.Seat(waiting.PlayerId, fund, waiting.Stakes)
+		})
+		if err := tx.Commit(ctx); err != nil {
+			fmt.Printf("ERROR: seatWaiting(): can't seat player %s in tournament %d: %+v\n",
+				waiting.PlayerId, tid, err)
+			dbi.UpdateTournament(ctx, tid, func(t *model.Tournament) error {
+				t.ReleaseSeat()
+				return nil
+			})
+		}
+	}
+}
+
+// payShares stages the points paid from the tournament pool according to the player action shares
+func payShares(tx db.Tx, tournament *model.Tournament, typ model.EntryType, playerId string, points model.Money) {
+	if points == 0 {
+		return
+	}
+	playerIds, stakes := fundStakes(playerId, tournament.GetStakes(playerId))
+	incomes := points.Allocate(weights(stakes))
+	makeFund(tx, tournament, typ, playerIds, incomes)
+}
+
+// refund stages the funds returned to the players who paid them
+func refund(tx db.Tx, tournament *model.Tournament, funds map[string]model.Fund) {
+	if entry := makeRefund(tournament, funds); entry != nil {
+		tx.Post(entry)
+	}
+}
+
+// stageTransfer stages the points move between the accounts, nothing is staged for zero points
+func stageTransfer(tx db.Tx, typ model.EntryType, tid int, from, to model.Account, points model.Money) {
+	if points == 0 {
+		return
+	}
+	tx.Post(model.NewTransfer(typ, tid, from, to, points))
+}
+
+// makeRefund returns the action shares from the tournament pool to the backers who own them
+func makeRefund(tournament *model.Tournament, funds map[string]model.Fund) *model.Entry {
+	var ids []string
+	for id := range funds {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var total model.Money
+	entry := model.NewEntry(model.EntryRefund, tournament.GetId())
+	for _, id := range ids {
+		var backerIds []string
+		for backerId := range funds[id] {
+			backerIds = append(backerIds, backerId)
+		}
+		sort.Strings(backerIds)
+		for _, backerId := range backerIds {
+			if income := -funds[id][backerId]; income != 0 {
+				entry.Postings = append(entry.Postings, model.Posting{
+					Account: model.PlayerAccount(backerId),
+					Amount:  income,
+				})
+				total += income
+			}
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	entry.Postings = append(entry.Postings, model.Posting{
+		Account: model.TournamentAccount(tournament.GetId()),
+		Amount:  -total,
+	})
+	return entry
+}
+
+// markupStakes returns the incomes paid for the stakes,
+// the backers pay the markup (rounded down) and the premium goes to the player placed in last position
+func markupStakes(stakes []model.Money, markup model.Percent) []model.Money {
+	incomes := make([]model.Money, len(stakes))
+	var deposit, paid model.Money
+	for i, stake := range stakes {
+		deposit += stake
+		if i == len(stakes)-1 {
+			incomes[i] = paid - deposit
 			break
 		}
-		fund[id] = income
+		incomes[i] = -markup.Of(stake)
+		paid += markup.Of(stake)
+	}
+	return incomes
+}
+
+// makeStakes returns the action shares of the backers if they differ from the paid incomes
+func makeStakes(ids []string, stakes, incomes []model.Money) model.Fund {
+	fund := model.Fund{}
+	var differ bool
+	for i, id := range ids {
+		fund[id] = stakes[i]
+		differ = differ || stakes[i] != -incomes[i]
+	}
+	if !differ {
+		return nil
+	}
+	return fund
+}
+
+// fundStakes returns the backers of the player and their action shares,
+// the player placed in last position
+func fundStakes(playerId string, fund model.Fund) ([]string, []model.Money) {
+	var ids []string
+	for id := range fund {
+		if id != playerId {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if _, ok := fund[playerId]; ok {
+		ids = append(ids, playerId)
 	}
 
-	if len(fund) != len(playerIds) {
-		return nil, fmt.Errorf("makeFund(): failed")
+	stakes := make([]model.Money, len(ids))
+	for i, id := range ids {
+		stakes[i] = fund[id]
+	}
+	return ids, stakes
+}
+
+// partsFund returns the fund of the players parts, the reverse of fundParts
+func partsFund(ids []string, parts []model.Money) model.Fund {
+	fund := model.Fund{}
+	for i, id := range ids {
+		fund[id] = parts[i]
+	}
+	return fund
+}
+
+// fundParts returns the fund parts of the players in the same order
+func fundParts(ids []string, fund model.Fund) []model.Money {
+	parts := make([]model.Money, len(ids))
+	for i, id := range ids {
+		parts[i] = fund[id]
+	}
+	return parts
+}
+
+func weights(stakes []model.Money) []int64 {
+	weights := make([]int64, len(stakes))
+	for i, stake := range stakes {
+		weights[i] = int64(stake)
+	}
+	return weights
+}
+
+// makeFund stages the incomes between the players and the tournament pool in the transaction
+// and returns the fund applied on commit
+// NOTE: the player placed in last position
+func makeFund(tx db.Tx, tournament *model.Tournament, typ model.EntryType, playerIds []string, incomes []model.Money) model.Fund {
+	fund := model.Fund{}
+	for i, id := range playerIds {
+		income := incomes[i]
+		fund[id] = income
+		if income == 0 {
+			continue
+		}
+		etyp := typ
+		if typ.IsDeposit() && i != len(playerIds)-1 {
+			etyp = model.EntryBacker
+		}
+		tx.Post(model.NewTransfer(etyp, tournament.GetId(),
+			model.TournamentAccount(tournament.GetId()), model.PlayerAccount(id), income))
 	}
-	return fund, nil
+	return fund
 }
@@ -1,18 +1,22 @@
 package handle
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cnaize/lifland/db"
 	"github.com/cnaize/lifland/model"
-	"github.com/cnaize/lifland/util"
 )
 
 func TestTournamentAnnounce(t *testing.T) {
+	ctx := context.Background()
 	makeUri := func(id, deposit string) string {
 		return fmt.Sprintf("/announceTournament?tournamentId=%s&deposit=%s", id, deposit)
 	}
@@ -21,7 +25,7 @@ func TestTournamentAnnounce(t *testing.T) {
 		tournId     string
 		deposit     string
 		wantCode    int
-		wantDeposit float64
+		wantDeposit model.Money
 	}{
 		{"", "", http.StatusBadRequest, 0},
 		{"1", "", http.StatusBadRequest, 0},
@@ -29,14 +33,14 @@ func TestTournamentAnnounce(t *testing.T) {
 		{"qwe", "10", http.StatusBadRequest, 0},
 		{"1", "qwe", http.StatusBadRequest, 0},
 		{"1", "10", http.StatusConflict, 0},
-		{"2", "20", http.StatusOK, 20},
+		{"2", "20", http.StatusOK, model.Points(20)},
 	}
 
 	for _, test := range tests {
-		tourn1 := model.NewTournament(1, 10)
+		tourn1 := newTestTournament(1, model.Points(10))
 		dbi := db.NewDB()
 		dbi.SetDebug(true)
-		dbi.AddTournament(tourn1)
+		dbi.AddTournament(ctx, tourn1)
 
 		uri := makeUri(test.tournId, test.deposit)
 		r, _ := http.NewRequest(http.MethodPost, uri, nil)
@@ -46,18 +50,19 @@ func TestTournamentAnnounce(t *testing.T) {
 			t.Errorf("invalid code %d for uri %s", w.Code, uri)
 		}
 		id, _ := strconv.Atoi(test.tournId)
-		tournament := dbi.GetTournament(id)
+		tournament := getTournament(ctx, dbi, id)
 		if test.wantCode != http.StatusOK || tournament == nil {
 			continue
 		}
-		if util.Round(tournament.GetDeposit()) != util.Round(test.wantDeposit) {
-			t.Errorf("invalid deposit for uri %s: want %f, got %f",
+		if tournament.GetDeposit() != test.wantDeposit {
+			t.Errorf("invalid deposit for uri %s: want %s, got %s",
 				uri, test.wantDeposit, tournament.GetDeposit())
 		}
 	}
 }
 
 func TestTournamentJoin(t *testing.T) {
+	ctx := context.Background()
 	makeUri := func(id, playerId string, backers ...string) string {
 		uri := fmt.Sprintf("/joinTournament?tournamentId=%s&playerId=%s",
 			id, playerId)
@@ -86,16 +91,16 @@ func TestTournamentJoin(t *testing.T) {
 	for _, test := range tests {
 		player10 := model.NewPlayer("10")
 		player20 := model.NewPlayer("20")
-		player10.IncrBalance(10)
-		player20.IncrBalance(20)
-		tourn1 := model.NewTournament(1, 10)
-		tourn2 := model.NewTournament(2, 30)
+		player10.IncrBalance(model.Points(10))
+		player20.IncrBalance(model.Points(20))
+		tourn1 := newTestTournament(1, model.Points(10))
+		tourn2 := newTestTournament(2, model.Points(30))
 		dbi := db.NewDB()
 		dbi.SetDebug(true)
-		dbi.AddPlayer(player10)
-		dbi.AddPlayer(player20)
-		dbi.AddTournament(tourn1)
-		dbi.AddTournament(tourn2)
+		dbi.AddPlayer(ctx, player10)
+		dbi.AddPlayer(ctx, player20)
+		dbi.AddTournament(ctx, tourn1)
+		dbi.AddTournament(ctx, tourn2)
 
 		uri := makeUri(test.tournId, test.playerId, test.backers...)
 		r, _ := http.NewRequest(http.MethodPost, uri, nil)
@@ -104,8 +109,13 @@ func TestTournamentJoin(t *testing.T) {
 		if w.Code != test.wantCode {
 			t.Errorf("invalid code %d for uri %s", w.Code, uri)
 		}
+		// the failed join charges nothing
+		if test.wantCode != http.StatusOK &&
+			(getBalance(ctx, dbi, "10") != model.Points(10) || getBalance(ctx, dbi, "20") != model.Points(20)) {
+			t.Errorf("players charged for failed uri %s", uri)
+		}
 		id, _ := strconv.Atoi(test.tournId)
-		tournament := dbi.GetTournament(id)
+		tournament := getTournament(ctx, dbi, id)
 		if test.wantCode != http.StatusOK || tournament == nil {
 			continue
 		}
@@ -113,20 +123,904 @@ func TestTournamentJoin(t *testing.T) {
 			(len(test.backers) > 0 && test.backers[0] != player20.GetId()) {
 			continue
 		}
+		balance10, balance20 := getBalance(ctx, dbi, "10"), getBalance(ctx, dbi, "20")
 		if len(test.backers) == 0 {
-			if player10.GetBalance() != 0.0 {
-				t.Errorf("invalid balance for uri %s: want %f, got %f",
-					uri, 0.0, player10.GetBalance())
+			if balance10 != model.Points(0) {
+				t.Errorf("invalid balance for uri %s: want %s, got %s",
+					uri, model.Points(0), balance10)
 			}
 		} else if len(test.backers) == 1 {
-			if player10.GetBalance() != 5.0 {
-				t.Errorf("invalid balance for uri %s: want %f, got %f",
-					uri, 5.0, player10.GetBalance())
+			if balance10 != model.Points(5) {
+				t.Errorf("invalid balance for uri %s: want %s, got %s",
+					uri, model.Points(5), balance10)
+			}
+			if balance20 != model.Points(15) {
+				t.Errorf("invalid balance for uri %s: want %s, got %s",
+					uri, model.Points(15), balance20)
+			}
+		}
+	}
+}
+
+func TestTournamentJoinSplit(t *testing.T) {
+	ctx := context.Background()
+	player10 := model.NewPlayer("10")
+	player20 := model.NewPlayer("20")
+	player30 := model.NewPlayer("30")
+	for _, player := range []*model.Player{player10, player20, player30} {
+		player.IncrBalance(model.Points(10))
+	}
+	tourn1 := newTestTournament(1, model.Points(10))
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	dbi.AddPlayer(ctx, player10)
+	dbi.AddPlayer(ctx, player20)
+	dbi.AddPlayer(ctx, player30)
+	dbi.AddTournament(ctx, tourn1)
+
+	uri := "/joinTournament?tournamentId=1&playerId=10&backerId=20&backerId=30"
+	r, _ := http.NewRequest(http.MethodPost, uri, nil)
+	w := httptest.NewRecorder()
+	initTestMux(dbi).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("invalid code %d for uri %s", w.Code, uri)
+	}
+
+	// the rounding remainder is taken from the player
+	wantBalances := map[string]model.Money{
+		"10": model.MustParseMoney("6.66"),
+		"20": model.MustParseMoney("6.67"),
+		"30": model.MustParseMoney("6.67"),
+	}
+	var total model.Money
+	for id, want := range wantBalances {
+		balance := getBalance(ctx, dbi, id)
+		if balance != want {
+			t.Errorf("invalid balance for player %s: want %s, got %s", id, want, balance)
+		}
+		total += balance
+	}
+	if total != model.Points(20) {
+		t.Errorf("invalid total balance: want %s, got %s", model.Points(20), total)
+	}
+}
+
+func TestTournamentResult(t *testing.T) {
+	ctx := context.Background()
+	initDB := func() db.Interface {
+		player10 := model.NewPlayer("10")
+		player20 := model.NewPlayer("20")
+		player30 := model.NewPlayer("30")
+		tourn1 := newTestTournament(1, model.Points(10))
+		tourn2 := newTestTournament(2, model.Points(10))
+		tourn1.StartTime = tourn2.StartTime.Add(-time.Hour)
+		dbi := db.NewDB()
+		dbi.SetDebug(true)
+		dbi.AddPlayer(ctx, player10)
+		dbi.AddPlayer(ctx, player20)
+		dbi.AddPlayer(ctx, player30)
+		tourn1.AddPlayer("10", model.Fund{"10": model.Points(-10)})
+		tourn1.AddPlayer("20", model.Fund{"20": model.Points(-10)})
+		tourn2.AddPlayer("20", model.Fund{"20": model.Points(-10)})
+		tourn2.AddPlayer("30", model.Fund{"30": model.Points(-10)})
+		dbi.AddTournament(ctx, tourn1)
+		dbi.AddTournament(ctx, tourn2)
+		return dbi
+	}
+	makeBody := func(id, playerId string) string {
+		winners := fmt.Sprintf(`"winners": [{"playerId": "%s", "prize": 5}]`, playerId)
+		if id == "" {
+			return fmt.Sprintf(`{%s}`, winners)
+		}
+		return fmt.Sprintf(`{"tournamentId": %s, %s}`, id, winners)
+	}
+
+	tests := []struct {
+		legacy   bool
+		bodies   []string
+		wantCode []int
+		wantOpen map[int]bool
+	}{
+		// out of order settlement
+		{false, []string{makeBody("2", "30"), makeBody("1", "10")},
+			[]int{http.StatusOK, http.StatusOK}, map[int]bool{1: false, 2: false}},
+		{false, []string{makeBody("2", "30"), makeBody("2", "20")},
+			[]int{http.StatusOK, http.StatusGone}, map[int]bool{1: true, 2: false}},
+		{false, []string{makeBody("2", "10")}, []int{http.StatusBadRequest}, map[int]bool{1: true, 2: true}},
+		{false, []string{makeBody("3", "10")}, []int{http.StatusNotFound}, map[int]bool{1: true, 2: true}},
+		{false, []string{makeBody("", "10")}, []int{http.StatusBadRequest}, map[int]bool{1: true, 2: true}},
+		// the oldest tournament is closed for legacy callers
+		{true, []string{makeBody("", "30")}, []int{http.StatusBadRequest}, map[int]bool{1: true, 2: true}},
+		{true, []string{makeBody("", "10"), makeBody("", "30")},
+			[]int{http.StatusOK, http.StatusOK}, map[int]bool{1: false, 2: false}},
+		{true, []string{makeBody("2", "30")}, []int{http.StatusOK}, map[int]bool{1: true, 2: false}},
+	}
+
+	for _, test := range tests {
+		dbi := initDB()
+		mux := initTestMux(dbi)
+		mux.HandleFunc("/resultTournamentStrict", Log(Result(dbi, false)))
+		uri := "/resultTournament"
+		if !test.legacy {
+			uri = "/resultTournamentStrict"
+		}
+		for i, body := range test.bodies {
+			r, _ := http.NewRequest(http.MethodPost, uri, strings.NewReader(body))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != test.wantCode[i] {
+				t.Errorf("invalid code %d for uri %s and body %s", w.Code, uri, body)
+			}
+		}
+		for id, open := range test.wantOpen {
+			if getTournament(ctx, dbi, id).IsOpen() != open {
+				t.Errorf("invalid tournament %d state for bodies %v: want open %t",
+					id, test.bodies, open)
+			}
+		}
+	}
+}
+
+func TestTournamentCancel(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		uris          []string
+		wantCode      []int
+		wantBalances  map[string]string
+		wantCancelled bool
+	}{
+		{[]string{"/cancelTournament"}, []int{http.StatusBadRequest}, nil, false},
+		{[]string{"/cancelTournament?tournamentId=2"}, []int{http.StatusNotFound}, nil, false},
+		{[]string{
+			"/joinTournament?tournamentId=1&playerId=10&backerId=20",
+			"/joinTournament?tournamentId=1&playerId=30",
+			"/cancelTournament?tournamentId=1&reason=test",
+			"/cancelTournament?tournamentId=1&reason=again",
+			"/resultTournament",
+		}, []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusGone},
+			map[string]string{"10": "10", "20": "20", "30": "10"}, true},
+		{[]string{
+			"/joinTournament?tournamentId=1&playerId=10&backerId=20",
+			"/resultTournament",
+			"/cancelTournament?tournamentId=1&reason=test",
+		}, []int{http.StatusOK, http.StatusOK, http.StatusGone},
+			map[string]string{"10": "5", "20": "15", "30": "10"}, false},
+	}
+
+	for _, test := range tests {
+		dbi := db.NewDB()
+		dbi.SetDebug(true)
+		for id, points := range map[string]int64{"10": 10, "20": 20, "30": 10} {
+			player := model.NewPlayer(id)
+			player.IncrBalance(model.Points(points))
+			dbi.AddPlayer(ctx, player)
+		}
+		tourn1 := newTestTournament(1, model.Points(10))
+		dbi.AddTournament(ctx, tourn1)
+
+		for i, uri := range test.uris {
+			r, _ := http.NewRequest(http.MethodPost, uri, strings.NewReader(`{"tournamentId": 1}`))
+			w := httptest.NewRecorder()
+			initTestMux(dbi).ServeHTTP(w, r)
+			if w.Code != test.wantCode[i] {
+				t.Errorf("invalid code %d for uri %s", w.Code, uri)
 			}
-			if player20.GetBalance() != 15.0 {
-				t.Errorf("invalid balance for uri %s: want %f, got %f",
-					uri, 15.0, player20.GetBalance())
+		}
+		for id, want := range test.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for player %s: want %s, got %s", id, want, balance)
 			}
 		}
+		tournament := getTournament(ctx, dbi, 1)
+		if tournament.IsCancelled() != test.wantCancelled {
+			t.Errorf("invalid cancelled state for uris %v: want %t", test.uris, test.wantCancelled)
+		}
+		if !test.wantCancelled {
+			continue
+		}
+		if tournament.GetCancelReason() != "test" {
+			t.Errorf("invalid cancel reason: want %s, got %s", "test", tournament.GetCancelReason())
+		}
+		if balance := getAccountBalance(ctx, dbi, model.TournamentAccount(1)); balance != 0 {
+			t.Errorf("invalid pool balance: want %d, got %s", 0, balance)
+		}
+	}
+}
+
+func TestTournamentState(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(10))
+		dbi.AddPlayer(ctx, player)
+	}
+
+	tests := []struct {
+		uri       string
+		wantCode  int
+		wantState model.TournamentState
+	}{
+		{"/announceTournament?tournamentId=1&deposit=10&registration=qwe", http.StatusBadRequest, ""},
+		{"/announceTournament?tournamentId=1&deposit=10&registration=false", http.StatusOK, model.StateAnnounced},
+		{"/joinTournament?tournamentId=1&playerId=10", http.StatusConflict, model.StateAnnounced},
+		{"/startTournament?tournamentId=1", http.StatusConflict, model.StateAnnounced},
+		{"/startTournament?tournamentId=2", http.StatusNotFound, model.StateAnnounced},
+		{"/openRegistration?tournamentId=1", http.StatusOK, model.StateRegistration},
+		{"/openRegistration?tournamentId=1", http.StatusConflict, model.StateRegistration},
+		{"/joinTournament?tournamentId=1&playerId=10", http.StatusOK, model.StateRegistration},
+		{"/startTournament?tournamentId=1", http.StatusOK, model.StateRunning},
+		{"/joinTournament?tournamentId=1&playerId=20", http.StatusConflict, model.StateRunning},
+		{"/resultTournament", http.StatusOK, model.StateFinished},
+		{"/joinTournament?tournamentId=1&playerId=30", http.StatusGone, model.StateFinished},
+		{"/cancelTournament?tournamentId=1", http.StatusGone, model.StateFinished},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodPost, test.uri, strings.NewReader(`{"tournamentId": 1}`))
+		w := httptest.NewRecorder()
+		initTestMux(dbi).ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("invalid code %d for uri %s", w.Code, test.uri)
+		}
+		if tournament := getTournament(ctx, dbi, 1); tournament != nil && tournament.GetState() != test.wantState {
+			t.Errorf("invalid state for uri %s: want %s, got %s", test.uri, test.wantState, tournament.GetState())
+		}
+	}
+	for id, want := range map[string]int64{"10": 0, "20": 10, "30": 10} {
+		if balance := getBalance(ctx, dbi, id); balance != model.Points(want) {
+			t.Errorf("invalid balance for player %s: want %s, got %s", id, model.Points(want), balance)
+		}
+	}
+}
+
+func TestTournamentJoinStakes(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		query        string
+		wantCode     int
+		wantBalances map[string]string
+	}{
+		{"backerId=20&backerId=30&stake=70%&stake=20%", http.StatusBadRequest, nil},
+		{"backerId=20&backerId=30&stake=70%&stake=20%&playerStake=20%", http.StatusBadRequest, nil},
+		{"backerId=20&backerId=30&stake=70%&stake=2&playerStake=1", http.StatusBadRequest, nil},
+		{"backerId=20&backerId=30&stake=7&stake=3&playerStake=0", http.StatusBadRequest, nil},
+		{"backerId=20&backerId=30&stake=7&stake=2.001&playerStake=0.999", http.StatusBadRequest, nil},
+		{"backerId=20&stake=7&stake=2&playerStake=1", http.StatusBadRequest, nil},
+		{"backerId=20&backerId=30&stake=70%&stake=20%&playerStake=10%", http.StatusOK,
+			map[string]string{"10": "9", "20": "13", "30": "8"}},
+		{"backerId=20&backerId=30&stake=7&stake=2&playerStake=1", http.StatusOK,
+			map[string]string{"10": "9", "20": "13", "30": "8"}},
+		{"backerId=20&backerId=30&stake=33.33%&stake=33.33%&playerStake=33.34%", http.StatusOK,
+			map[string]string{"10": "6.66", "20": "16.67", "30": "6.67"}},
+		{"playerStake=100%", http.StatusOK, map[string]string{"10": "0"}},
+	}
+
+	for _, test := range tests {
+		dbi := db.NewDB()
+		dbi.SetDebug(true)
+		for id, points := range map[string]int64{"10": 10, "20": 20, "30": 10} {
+			player := model.NewPlayer(id)
+			player.IncrBalance(model.Points(points))
+			dbi.AddPlayer(ctx, player)
+		}
+		tournament := newTestTournament(1, model.Points(10))
+		tournament.SetOptions(model.TournamentOptions{Guarantee: model.Points(20)})
+		dbi.AddTournament(ctx, tournament)
+
+		uri := "/joinTournament?tournamentId=1&playerId=10&" + strings.Replace(test.query, "%", "%25", -1)
+		r, _ := http.NewRequest(http.MethodPost, uri, nil)
+		w := httptest.NewRecorder()
+		initTestMux(dbi).ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("invalid code %d for uri %s", w.Code, uri)
+		}
+		for id, want := range test.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for uri %s and player %s: want %s, got %s",
+					uri, id, want, balance)
+			}
+		}
+	}
+}
+
+func TestTournamentResultStakes(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(10))
+		dbi.AddPlayer(ctx, player)
+	}
+	// the prize exceeds the collected deposits, so the house guarantees it
+	tournament := newTestTournament(1, model.Points(10))
+	tournament.SetOptions(model.TournamentOptions{Guarantee: model.MustParseMoney("20.01")})
+	dbi.AddTournament(ctx, tournament)
+
+	uris := []string{
+		"/joinTournament?tournamentId=1&playerId=10&backerId=20&backerId=30&stake=70%25&stake=20%25&playerStake=10%25",
+		"/resultTournament",
+	}
+	for _, uri := range uris {
+		body := `{"tournamentId": 1, "winners": [{"playerId": "10", "prize": 20.01}]}`
+		r, _ := http.NewRequest(http.MethodPost, uri, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		initTestMux(dbi).ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("invalid code %d for uri %s", w.Code, uri)
+		}
+	}
+
+	// the rounding remainder goes to the player
+	for id, want := range map[string]string{"10": "11.01", "20": "17", "30": "12"} {
+		if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+			t.Errorf("invalid balance for player %s: want %s, got %s", id, want, balance)
+		}
+	}
+}
+
+func TestTournamentMarkup(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		query        string
+		prize        string
+		wantCode     int
+		wantBalances map[string]string
+	}{
+		{"backerId=20&markup=qwe", "", http.StatusBadRequest, nil},
+		{"backerId=20&markup=0.9", "", http.StatusBadRequest, nil},
+		{"backerId=20&markup=1.2", "20", http.StatusOK,
+			map[string]string{"10": "16", "20": "24", "30": "20"}},
+		{"backerId=20&stake=50%&playerStake=50%&markup=1", "20", http.StatusOK,
+			map[string]string{"10": "15", "20": "25", "30": "20"}},
+		// backers pay 3.8295 rounded down, the prize remainder goes to the player
+		{"backerId=20&backerId=30&stake=33.33%&stake=33.33%&playerStake=33.34%&markup=1.15", "10.01", http.StatusOK,
+			map[string]string{"10": "10.99", "20": "19.51", "30": "19.51"}},
+		// the premium is credited to the player
+		{"backerId=20&stake=9&playerStake=1&markup=1.2", "", http.StatusOK,
+			map[string]string{"10": "10.80", "20": "9.20", "30": "20"}},
+		{"backerId=20&stake=9&playerStake=1&markup=1.2", "10", http.StatusOK,
+			map[string]string{"10": "11.80", "20": "18.20", "30": "20"}},
+	}
+
+	for _, test := range tests {
+		dbi := db.NewDB()
+		dbi.SetDebug(true)
+		for id, points := range map[string]int64{"10": 10, "20": 20, "30": 20} {
+			player := model.NewPlayer(id)
+			player.IncrBalance(model.Points(points))
+			dbi.AddPlayer(ctx, player)
+		}
+		tournament := newTestTournament(1, model.Points(10))
+		tournament.SetOptions(model.TournamentOptions{Guarantee: model.Points(20)})
+		dbi.AddTournament(ctx, tournament)
+
+		uri := "/joinTournament?tournamentId=1&playerId=10&" + strings.Replace(test.query, "%", "%25", -1)
+		r, _ := http.NewRequest(http.MethodPost, uri, nil)
+		w := httptest.NewRecorder()
+		initTestMux(dbi).ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("invalid code %d for uri %s", w.Code, uri)
+		}
+		if test.prize != "" {
+			body := fmt.Sprintf(`{"tournamentId": 1, "winners": [{"playerId": "10", "prize": %s}]}`, test.prize)
+			r, _ := http.NewRequest(http.MethodPost, "/resultTournament", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			initTestMux(dbi).ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Errorf("invalid code %d for result %s", w.Code, body)
+			}
+		}
+		for id, want := range test.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for uri %s and player %s: want %s, got %s",
+					uri, id, want, balance)
+			}
+		}
+	}
+}
+
+func TestTournamentMarkupRefund(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		action    string
+		wantCode  int
+		wantState model.TournamentState
+	}{
+		{"/cancelTournament?tournamentId=1", http.StatusOK, model.StateCancelled},
+		{"/leaveTournament?tournamentId=1&playerId=p", http.StatusOK, model.StateRegistration},
+		// less than min players
+		{"/startTournament?tournamentId=1", http.StatusConflict, model.StateCancelled},
+	}
+
+	for _, test := range tests {
+		dbi := db.NewDB()
+		dbi.SetDebug(true)
+		mux := initTestMux(dbi)
+		// the player takes the premium before the refund
+		for _, uri := range []string{
+			"/fund?playerId=p&points=10",
+			"/fund?playerId=b&points=200",
+			"/announceTournament?tournamentId=1&deposit=100&minPlayers=2",
+			"/joinTournament?tournamentId=1&playerId=p&backerId=b&stake=90&playerStake=10&markup=1.5",
+			"/take?playerId=p&points=45",
+		} {
+			r, _ := http.NewRequest(http.MethodPost, uri, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("invalid code %d for uri %s", w.Code, uri)
+			}
+		}
+		r, _ := http.NewRequest(http.MethodPost, test.action, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("invalid code %d for uri %s", w.Code, test.action)
+		}
+		// the backers get back their stakes, the premium stays with the player
+		for id, want := range map[string]string{"p": "10", "b": "155"} {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for %s and player %s: want %s, got %s", test.action, id, want, balance)
+			}
+		}
+		if state := getTournament(ctx, dbi, 1).GetState(); state != test.wantState {
+			t.Errorf("invalid state for %s: want %s, got %s", test.action, test.wantState, state)
+		}
+	}
+}
+
+func TestTournamentPayout(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		announce     string
+		result       string
+		wantCode     int
+		wantBalances map[string]string
+		wantHouse    string
+	}{
+		{"payout=qwe", "", http.StatusBadRequest, nil, ""},
+		{"payout=percent:50,30", "", http.StatusBadRequest, nil, ""},
+		{"rake=101", "", http.StatusBadRequest, nil, ""},
+		{"guarantee=-1", "", http.StatusBadRequest, nil, ""},
+		{"payout=wta", `"winners": [{"playerId": "10", "prize": 40}]`, http.StatusBadRequest, nil, ""},
+		{"", `"places": ["10"]`, http.StatusBadRequest, nil, ""},
+		{"payout=flat:2", `"places": ["10"]`, http.StatusBadRequest, nil, ""},
+		{"payout=flat:2", `"places": ["10", "10"]`, http.StatusBadRequest, nil, ""},
+		{"payout=flat:2", `"places": ["10", "50"]`, http.StatusBadRequest, nil, ""},
+		{"payout=wta", `"places": ["20", "10"]`, http.StatusOK,
+			map[string]string{"10": "0", "20": "40", "30": "0", "40": "0"}, "0"},
+		{"payout=flat:3&rake=10", `"places": ["20", "10", "30", "40"]`, http.StatusOK,
+			map[string]string{"10": "12", "20": "12", "30": "12", "40": "0"}, "4"},
+		{"payout=percent:50,30,20&rake=10.5", `"places": ["40", "30", "20"]`, http.StatusOK,
+			map[string]string{"10": "0", "20": "7.16", "30": "10.74", "40": "17.90"}, "4.20"},
+		{"payout=percent:50,30,20&rake=10&guarantee=50", `"places": ["40", "30", "20"]`, http.StatusOK,
+			map[string]string{"10": "0", "20": "10", "30": "15", "40": "25"}, "-10"},
+		{"rake=10", `"winners": [{"playerId": "10", "prize": 30}]`, http.StatusOK,
+			map[string]string{"10": "30", "20": "0", "30": "0", "40": "0"}, "10"},
+	}
+
+	for _, test := range tests {
+		dbi := db.NewDB()
+		dbi.SetDebug(true)
+		for _, id := range []string{"10", "20", "30", "40"} {
+			player := model.NewPlayer(id)
+			player.IncrBalance(model.Points(10))
+			dbi.AddPlayer(ctx, player)
+		}
+		mux := initTestMux(dbi)
+
+		uri := "/announceTournament?tournamentId=1&deposit=10&" + test.announce
+		r, _ := http.NewRequest(http.MethodPost, uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if test.result == "" {
+			if w.Code != test.wantCode {
+				t.Errorf("invalid code %d for uri %s", w.Code, uri)
+			}
+			continue
+		}
+		for _, id := range []string{"10", "20", "30", "40"} {
+			uri := fmt.Sprintf("/joinTournament?tournamentId=1&playerId=%s", id)
+			r, _ := http.NewRequest(http.MethodPost, uri, nil)
+			mux.ServeHTTP(httptest.NewRecorder(), r)
+		}
+
+		body := fmt.Sprintf(`{"tournamentId": 1, %s}`, test.result)
+		r, _ = http.NewRequest(http.MethodPost, "/resultTournament", strings.NewReader(body))
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("invalid code %d for announce %s and result %s", w.Code, test.announce, body)
+		}
+		for id, want := range test.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for announce %s and player %s: want %s, got %s",
+					test.announce, id, want, balance)
+			}
+		}
+		if test.wantHouse == "" {
+			continue
+		}
+		if house := getAccountBalance(ctx, dbi, model.HouseAccount); house != model.MustParseMoney(test.wantHouse) {
+			t.Errorf("invalid house balance for announce %s: want %s, got %s", test.announce, test.wantHouse, house)
+		}
+		if pool := getAccountBalance(ctx, dbi, model.TournamentAccount(1)); pool != 0 {
+			t.Errorf("invalid pool balance for announce %s: want %d, got %s", test.announce, 0, pool)
+		}
+	}
+}
+
+func TestTournamentBuyIn(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(30))
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	steps := []struct {
+		uri          string
+		wantCode     int
+		wantBalances map[string]string
+	}{
+		{"/announceTournament?tournamentId=1&deposit=10&rebuy=qwe", http.StatusBadRequest, nil},
+		{"/announceTournament?tournamentId=1&deposit=10&rebuy=1&reentry=1:5&addon=1:4", http.StatusOK, nil},
+		{"/joinTournament?tournamentId=1&playerId=10&backerId=20", http.StatusOK,
+			map[string]string{"10": "25", "20": "25"}},
+		{"/rebuyTournament?tournamentId=1&playerId=30", http.StatusNotFound, nil},
+		// the original split is reused
+		{"/rebuyTournament?tournamentId=1&playerId=10", http.StatusOK,
+			map[string]string{"10": "20", "20": "20"}},
+		{"/rebuyTournament?tournamentId=1&playerId=10", http.StatusConflict, nil},
+		{"/reentryTournament?tournamentId=1&playerId=10&backerId=20&reuse=true", http.StatusBadRequest, nil},
+		{"/reentryTournament?tournamentId=1&playerId=10&reuse=false", http.StatusOK,
+			map[string]string{"10": "15", "20": "20"}},
+		{"/addonTournament?tournamentId=1&playerId=10", http.StatusConflict, nil},
+		{"/startTournament?tournamentId=1", http.StatusOK, nil},
+		{"/addonTournament?tournamentId=1&playerId=10&backerId=20&stake=3&playerStake=1", http.StatusOK,
+			map[string]string{"10": "14", "20": "17"}},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(http.MethodPost, step.uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+		for id, want := range step.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for uri %s and player %s: want %s, got %s", step.uri, id, want, balance)
+			}
+		}
+	}
+
+	// the prize is shared by the total stakes: 16 of the player and 13 of the backer
+	body := `{"tournamentId": 1, "winners": [{"playerId": "10", "prize": 20}]}`
+	r, _ := http.NewRequest(http.MethodPost, "/resultTournament", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("invalid code %d for result %s", w.Code, body)
+	}
+	for id, want := range map[string]string{"10": "25.04", "20": "25.96", "30": "30"} {
+		if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+			t.Errorf("invalid balance for player %s: want %s, got %s", id, want, balance)
+		}
+	}
+	if house := getAccountBalance(ctx, dbi, model.HouseAccount); house != model.Points(9) {
+		t.Errorf("invalid house balance: want 9, got %s", house)
+	}
+}
+
+func TestTournamentLeave(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(20))
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	steps := []struct {
+		uri          string
+		wantCode     int
+		wantBalances map[string]string
+	}{
+		{"/announceTournament?tournamentId=1&deposit=10&rebuy=1", http.StatusOK, nil},
+		{"/joinTournament?tournamentId=1&playerId=10&backerId=20&stake=30%25&playerStake=70%25", http.StatusOK,
+			map[string]string{"10": "13", "20": "17"}},
+		{"/rebuyTournament?tournamentId=1&playerId=10&reuse=false", http.StatusOK,
+			map[string]string{"10": "3", "20": "17"}},
+		{"/joinTournament?tournamentId=1&playerId=30", http.StatusOK,
+			map[string]string{"30": "10"}},
+		{"/leaveTournament?tournamentId=2&playerId=10", http.StatusNotFound, nil},
+		{"/leaveTournament?tournamentId=1&playerId=20", http.StatusNotFound, nil},
+		{"/leaveTournament?tournamentId=1&playerId=10", http.StatusOK,
+			map[string]string{"10": "20", "20": "20", "30": "10"}},
+		{"/leaveTournament?tournamentId=1&playerId=10", http.StatusNotFound, nil},
+		{"/startTournament?tournamentId=1", http.StatusOK, nil},
+		{"/leaveTournament?tournamentId=1&playerId=30", http.StatusConflict,
+			map[string]string{"30": "10"}},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(http.MethodPost, step.uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+		for id, want := range step.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for uri %s and player %s: want %s, got %s", step.uri, id, want, balance)
+			}
+		}
+	}
+	if pool := getAccountBalance(ctx, dbi, model.TournamentAccount(1)); pool != model.Points(10) {
+		t.Errorf("invalid pool balance: want 10, got %s", pool)
+	}
+}
+
+func TestTournamentWaitlist(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30", "40"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(10))
+		if id == "30" {
+			// the waiting player can't pay when the seat opens
+			player.IncrBalance(model.Points(-5))
+		}
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	steps := []struct {
+		method       string
+		uri          string
+		wantCode     int
+		wantPosition int
+		wantBalances map[string]string
+	}{
+		{http.MethodPost, "/announceTournament?tournamentId=1&deposit=10&minPlayers=3&maxPlayers=2",
+			http.StatusBadRequest, 0, nil},
+		{http.MethodPost, "/announceTournament?tournamentId=1&deposit=10&maxPlayers=1", http.StatusOK, 0, nil},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=10", http.StatusOK, 0,
+			map[string]string{"10": "0"}},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=30", http.StatusAccepted, 1,
+			map[string]string{"30": "5"}},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=20", http.StatusAccepted, 2,
+			map[string]string{"20": "10"}},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=40", http.StatusAccepted, 3, nil},
+		{http.MethodPost, "/joinTournament?tournamentId=1&playerId=40", http.StatusConflict, 0, nil},
+		{http.MethodGet, "/waitlist?tournamentId=1&playerId=20", http.StatusOK, 2, nil},
+		{http.MethodGet, "/waitlist?tournamentId=1&playerId=10", http.StatusNotFound, 0, nil},
+		{http.MethodPost, "/leaveTournament?tournamentId=1&playerId=40", http.StatusOK, 0,
+			map[string]string{"40": "10"}},
+		// player 30 can't pay, so player 20 takes the seat
+		{http.MethodPost, "/leaveTournament?tournamentId=1&playerId=10", http.StatusOK, 0,
+			map[string]string{"10": "10", "20": "0", "30": "5"}},
+		{http.MethodGet, "/waitlist?tournamentId=1&playerId=30", http.StatusNotFound, 0, nil},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(step.method, step.uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+		if step.wantPosition > 0 {
+			var data struct {
+				Position int `json:"position"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+				t.Errorf("can't unmarshal body for uri %s: %+v", step.uri, err)
+			}
+			if data.Position != step.wantPosition {
+				t.Errorf("invalid position for uri %s: want %d, got %d", step.uri, step.wantPosition, data.Position)
+			}
+		}
+		for id, want := range step.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for uri %s and player %s: want %s, got %s", step.uri, id, want, balance)
+			}
+		}
+	}
+	if !getTournament(ctx, dbi, 1).HasPlayer("20") {
+		t.Errorf("waiting player isn't seated")
+	}
+}
+
+func TestTournamentMinPlayers(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(10))
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	uris := []string{
+		"/announceTournament?tournamentId=1&deposit=10&minPlayers=2",
+		"/joinTournament?tournamentId=1&playerId=10&backerId=20",
+		"/startTournament?tournamentId=1",
+	}
+	for i, uri := range uris {
+		r, _ := http.NewRequest(http.MethodPost, uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		wantCode := http.StatusOK
+		if i == len(uris)-1 {
+			wantCode = http.StatusConflict
+		}
+		if w.Code != wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, uri)
+		}
+	}
+	if !getTournament(ctx, dbi, 1).IsCancelled() {
+		t.Errorf("tournament isn't cancelled")
+	}
+	for _, id := range []string{"10", "20"} {
+		if balance := getBalance(ctx, dbi, id); balance != model.Points(10) {
+			t.Errorf("invalid balance for player %s: want 10, got %s", id, balance)
+		}
+	}
+}
+
+func TestTournamentSchedule(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(10))
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	now := time.Now()
+	at := func(d time.Duration) string {
+		return now.Add(d).UTC().Format(time.RFC3339)
+	}
+	steps := []struct {
+		uri       string
+		schedule  time.Duration
+		wantCode  int
+		wantState model.TournamentState
+	}{
+		{"/announceTournament?tournamentId=1&deposit=10&registrationTime=" + at(time.Minute),
+			0, http.StatusBadRequest, ""},
+		{"/announceTournament?tournamentId=1&deposit=10&startTime=" + at(time.Minute) + "&registrationTime=" + at(time.Hour),
+			0, http.StatusBadRequest, ""},
+		{"/announceTournament?tournamentId=1&deposit=10&startTime=" + at(time.Hour) +
+			"&registrationTime=" + at(time.Minute) + "&lateRegistrationTime=" + at(2*time.Hour),
+			0, http.StatusOK, model.StateAnnounced},
+		{"/joinTournament?tournamentId=1&playerId=10", 0, http.StatusConflict, model.StateAnnounced},
+		{"/joinTournament?tournamentId=1&playerId=10", time.Minute, http.StatusOK, model.StateRegistration},
+		// the late registration is open
+		{"/joinTournament?tournamentId=1&playerId=20", time.Hour, http.StatusOK, model.StateRunning},
+	}
+	for _, step := range steps {
+		if step.schedule > 0 {
+			Schedule(ctx, dbi, now.Add(step.schedule))
+		}
+		r, _ := http.NewRequest(http.MethodPost, step.uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+		if step.wantState == "" {
+			continue
+		}
+		if state := getTournament(ctx, dbi, 1).GetState(); state != step.wantState {
+			t.Errorf("invalid state for uri %s: want %s, got %s", step.uri, step.wantState, state)
+		}
+	}
+
+	// the tournament started below min players is cancelled
+	uris := []string{
+		"/announceTournament?tournamentId=2&deposit=10&minPlayers=2&startTime=" + at(time.Minute),
+		"/joinTournament?tournamentId=2&playerId=30",
+	}
+	for _, uri := range uris {
+		r, _ := http.NewRequest(http.MethodPost, uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("invalid code %d for uri %s", w.Code, uri)
+		}
+	}
+	Schedule(ctx, dbi, now.Add(time.Minute))
+	if !getTournament(ctx, dbi, 2).IsCancelled() {
+		t.Errorf("tournament isn't cancelled")
+	}
+	if balance := getBalance(ctx, dbi, "30"); balance != model.Points(10) {
+		t.Errorf("invalid balance for player 30: want 10, got %s", balance)
+	}
+}
+
+func TestTournamentBounty(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	for _, id := range []string{"10", "20", "30"} {
+		player := model.NewPlayer(id)
+		player.IncrBalance(model.Points(20))
+		dbi.AddPlayer(ctx, player)
+	}
+	mux := initTestMux(dbi)
+
+	steps := []struct {
+		uri          string
+		wantCode     int
+		wantBalances map[string]string
+	}{
+		{"/announceTournament?tournamentId=1&deposit=10&progressiveBounty=true", http.StatusBadRequest, nil},
+		{"/announceTournament?tournamentId=1&deposit=10&bounty=50&progressiveBounty=true&registration=true",
+			http.StatusOK, nil},
+		{"/joinTournament?tournamentId=1&playerId=10", http.StatusOK, nil},
+		{"/joinTournament?tournamentId=1&playerId=20", http.StatusOK, nil},
+		{"/joinTournament?tournamentId=1&playerId=30&backerId=20", http.StatusOK,
+			map[string]string{"10": "10", "20": "5", "30": "15"}},
+		{"/eliminate?tournamentId=1&playerId=10&eliminatorId=30", http.StatusConflict, nil},
+		{"/startTournament?tournamentId=1", http.StatusOK, nil},
+		{"/eliminate?tournamentId=1&playerId=10&eliminatorId=10", http.StatusBadRequest, nil},
+		{"/eliminate?tournamentId=1&playerId=10&eliminatorId=40", http.StatusNotFound, nil},
+		// half of the bounty is shared by the eliminator backers
+		{"/eliminate?tournamentId=1&playerId=10&eliminatorId=30", http.StatusOK,
+			map[string]string{"10": "10", "20": "6.25", "30": "16.25"}},
+		{"/eliminate?tournamentId=1&playerId=10&eliminatorId=20", http.StatusConflict, nil},
+		{"/eliminate?tournamentId=1&playerId=30&eliminatorId=10", http.StatusConflict, nil},
+		{"/eliminate?tournamentId=1&playerId=20&eliminatorId=30", http.StatusOK,
+			map[string]string{"20": "7.5", "30": "17.5"}},
+	}
+	for _, step := range steps {
+		r, _ := http.NewRequest(http.MethodPost, step.uri, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for uri %s", w.Code, step.uri)
+		}
+		for id, want := range step.wantBalances {
+			if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+				t.Errorf("invalid balance for uri %s and player %s: want %s, got %s", step.uri, id, want, balance)
+			}
+		}
+	}
+
+	// the bounties are excluded from the prize pool
+	for _, step := range []struct {
+		body     string
+		wantCode int
+	}{
+		{`{"tournamentId": 1, "winners": [{"playerId": "30", "prize": 16}]}`, http.StatusUnprocessableEntity},
+		{`{"tournamentId": 1, "winners": [{"playerId": "30", "prize": 15}]}`, http.StatusOK},
+	} {
+		r, _ := http.NewRequest(http.MethodPost, "/resultTournament", strings.NewReader(step.body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != step.wantCode {
+			t.Fatalf("invalid code %d for result %s", w.Code, step.body)
+		}
+	}
+	// the winner collects the own bounty
+	for id, want := range map[string]string{"10": "10", "20": "20", "30": "30"} {
+		if balance := getBalance(ctx, dbi, id); balance != model.MustParseMoney(want) {
+			t.Errorf("invalid balance for player %s: want %s, got %s", id, want, balance)
+		}
+	}
+	if pool := getAccountBalance(ctx, dbi, model.TournamentAccount(1)); pool != 0 {
+		t.Errorf("invalid tournament pool: want 0, got %s", pool)
 	}
 }
@@ -1,8 +1,24 @@
 package handle
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"sync"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+const (
+	idempotencyHeader string = "Idempotency-Key"
+	idempotencyParam  string = "requestId"
+	replayedHeader    string = "Idempotent-Replayed"
 )
 
 func Log(fn http.HandlerFunc) http.HandlerFunc {
@@ -11,3 +27,177 @@ func Log(fn http.HandlerFunc) http.HandlerFunc {
 		fn(w, r)
 	}
 }
+
+// inFlight are the idempotency keys of the requests in progress, shared by all the handlers
+var inFlight = struct {
+	sync.Mutex
+	keys map[string]bool
+}{keys: make(map[string]bool)}
+
+// Idempotent applies the request once per idempotency key,
+// retries get the original response without applying the request again until the response expires,
+// the request changes and the response are dumped together
+func Idempotent(dbi db.Interface, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" {
+			key = r.URL.Query().Get(idempotencyParam)
+		}
+		if key == "" {
+			fn(w, r)
+			return
+		}
+
+		inFlight.Lock()
+		if inFlight.keys[key] {
+			inFlight.Unlock()
+			fmt.Printf("ERROR: Idempotent(): request %s is in progress\n", key)
+			http.Error(w, "", http.StatusConflict)
+			return
+		}
+		inFlight.keys[key] = true
+		inFlight.Unlock()
+		defer func() {
+			inFlight.Lock()
+			delete(inFlight.keys, key)
+			inFlight.Unlock()
+		}()
+
+		params, err := requestParams(r)
+		if err != nil {
+			fmt.Printf("ERROR: Idempotent(): can't read request %s: %+v\n", key, err)
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		// NOTE: the client can't cancel the request between the changes and the response saved
+		ctx := context.WithoutCancel(r.Context())
+		if resp, err := dbi.GetResponse(ctx, key); err == nil {
+			if !resp.Matches(r.URL.Path, params) {
+				fmt.Printf("ERROR: Idempotent(): request %s was made to %s with other params\n", key, resp.Path)
+				http.Error(w, "", http.StatusUnprocessableEntity)
+				return
+			}
+			fmt.Printf("replaying request %s\n", key)
+			if resp.ContentType != "" {
+				w.Header().Set("Content-Type", resp.ContentType)
+			}
+			w.Header().Set(replayedHeader, "true")
+			w.WriteHeader(resp.Code)
+			w.Write([]byte(resp.Body))
+			return
+		}
+
+		// the handler changes are dumped with the response
+		deferred := &deferredDump{}
+		rec := &recorder{ResponseWriter: w}
+		fn(rec, r.WithContext(context.WithValue(ctx, deferredDumpKey{}, deferred)))
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		// NOTE: server errors are not stored, so the request can be retried
+		if rec.code < http.StatusInternalServerError {
+			resp := model.NewResponse(r.URL.Path, params, rec.code, rec.Header().Get("Content-Type"), rec.body.String())
+			if err := dbi.AddResponse(ctx, key, resp); err != nil {
+				fmt.Printf("ERROR: Idempotent(): can't add response %s: %+v\n", key, err)
+			} else {
+				deferred.requested = true
+			}
+		}
+		if deferred.requested {
+			dump(ctx, dbi)
+		}
+	}
+}
+
+// requestParams returns the hash of the request query and body, the idempotency key isn't hashed,
+// the body is kept for the handler
+func requestParams(r *http.Request) (string, error) {
+	query := r.URL.Query()
+	query.Del(idempotencyParam)
+	hash := sha256.New()
+	hash.Write([]byte(query.Encode()))
+	hash.Write([]byte{'\n'})
+	if r.Body != nil {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+type deferredDumpKey struct{}
+
+// deferredDump records the dump requested by the handler wrapped by Idempotent
+type deferredDump struct {
+	requested bool
+}
+
+// stateCode maps the tournament state errors to the http status,
+// the code is returned for the other errors
+func stateCode(err error, code int) int {
+	var state model.TournamentState
+	switch e := err.(type) {
+	case *model.TransitionError:
+		state = e.From
+	case *model.StateError:
+		state = e.State
+	default:
+		return code
+	}
+	if state.IsEnded() {
+		return http.StatusGone
+	}
+	return http.StatusConflict
+}
+
+// dbCode maps the db errors to the http status
+func dbCode(err error) int {
+	if errors.Is(err, db.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// dump persists the db changes, the failure is logged only since the changes are kept in memory
+func dump(ctx context.Context, dbi db.Interface) {
+	if deferred, ok := ctx.Value(deferredDumpKey{}).(*deferredDump); ok {
+		deferred.requested = true
+		return
+	}
+	if err := dbi.Dump(ctx); err != nil {
+		fmt.Printf("ERROR: dump(): can't dump db: %+v\n", err)
+	}
+}
+
+// txCode maps the transaction errors to the http status
+func txCode(err error) int {
+	if errors.Is(err, db.ErrBalance) || errors.Is(err, db.ErrNotFound) {
+		return http.StatusUnprocessableEntity
+	}
+	return stateCode(err, http.StatusConflict)
+}
+
+type recorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,142 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
+)
+
+func TestIdempotent(t *testing.T) {
+	ctx := context.Background()
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+
+	tests := []struct {
+		uri          string
+		key          string
+		wantCode     int
+		wantReplayed bool
+		wantBalance  model.Money
+	}{
+		{"/fund?playerId=10&points=10", "", http.StatusOK, false, model.Points(10)},
+		{"/fund?playerId=10&points=10", "", http.StatusOK, false, model.Points(20)},
+		{"/fund?playerId=10&points=10", "fund1", http.StatusOK, false, model.Points(30)},
+		{"/fund?playerId=10&points=10", "fund1", http.StatusOK, true, model.Points(30)},
+		{"/fund?playerId=10&points=10&requestId=fund2", "", http.StatusOK, false, model.Points(40)},
+		{"/fund?playerId=10&points=10&requestId=fund2", "", http.StatusOK, true, model.Points(40)},
+		{"/fund?playerId=10&points=20", "fund1", http.StatusUnprocessableEntity, false, model.Points(40)},
+		{"/fund?playerId=10&points=20&requestId=fund2", "", http.StatusUnprocessableEntity, false, model.Points(40)},
+		{"/take?playerId=10&points=10", "fund1", http.StatusUnprocessableEntity, false, model.Points(40)},
+		{"/take?playerId=10&points=100", "take1", http.StatusUnprocessableEntity, false, model.Points(40)},
+		{"/fund?playerId=10&points=100", "", http.StatusOK, false, model.Points(140)},
+		{"/take?playerId=10&points=100", "take1", http.StatusUnprocessableEntity, true, model.Points(140)},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodPost, test.uri, nil)
+		if test.key != "" {
+			r.Header.Set(idempotencyHeader, test.key)
+		}
+		w := httptest.NewRecorder()
+		initTestMux(dbi).ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("invalid code %d for uri %s", w.Code, test.uri)
+		}
+		if replayed := w.Header().Get(replayedHeader) != ""; replayed != test.wantReplayed {
+			t.Errorf("invalid replay for uri %s: want %t, got %t", test.uri, test.wantReplayed, replayed)
+		}
+		if balance := getBalance(ctx, dbi, "10"); balance != test.wantBalance {
+			t.Errorf("invalid balance for uri %s: want %s, got %s", test.uri, test.wantBalance, balance)
+		}
+	}
+
+	// the request cancelled by the client is applied with its response
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	for _, wantReplayed := range []bool{false, true} {
+		r, _ := http.NewRequestWithContext(cancelled, http.MethodPost, "/fund?playerId=10&points=10", nil)
+		r.Header.Set(idempotencyHeader, "fund3")
+		w := httptest.NewRecorder()
+		initTestMux(dbi).ServeHTTP(w, r)
+		if replayed := w.Header().Get(replayedHeader) != ""; w.Code != http.StatusOK || replayed != wantReplayed {
+			t.Errorf("invalid cancelled request code %d, want replayed %t", w.Code, wantReplayed)
+		}
+	}
+	if balance := getBalance(ctx, dbi, "10"); balance != model.Points(150) {
+		t.Errorf("invalid balance after cancelled request: want %s, got %s", model.Points(150), balance)
+	}
+
+	// the keys are restored with the db
+	dump, err := json.Marshal(dbi)
+	if err != nil {
+		t.Fatalf("can't marshal db: %+v", err)
+	}
+	restored := db.NewDB()
+	restored.SetDebug(true)
+	if err := json.Unmarshal(dump, restored); err != nil {
+		t.Fatalf("can't unmarshal db: %+v", err)
+	}
+	r, _ := http.NewRequest(http.MethodPost, "/fund?playerId=10&points=10", nil)
+	r.Header.Set(idempotencyHeader, "fund1")
+	w := httptest.NewRecorder()
+	initTestMux(restored).ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get(replayedHeader) == "" {
+		t.Errorf("request not replayed after restore: code %d", w.Code)
+	}
+	if balance := getBalance(ctx, restored, "10"); balance != model.Points(150) {
+		t.Errorf("invalid balance after restore: want %s, got %s", model.Points(150), balance)
+	}
+}
+
+func TestIdempotentInFlight(t *testing.T) {
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	// NOTE: the key in progress at one endpoint is in progress at all of them
+	inFlight.Lock()
+	inFlight.keys["fund1"] = true
+	inFlight.Unlock()
+	defer func() {
+		inFlight.Lock()
+		delete(inFlight.keys, "fund1")
+		inFlight.Unlock()
+	}()
+
+	for _, uri := range []string{"/fund?playerId=10&points=10", "/take?playerId=10&points=10"} {
+		r, _ := http.NewRequest(http.MethodPost, uri, nil)
+		r.Header.Set(idempotencyHeader, "fund1")
+		w := httptest.NewRecorder()
+		initTestMux(dbi).ServeHTTP(w, r)
+		if w.Code != http.StatusConflict {
+			t.Errorf("invalid code %d for uri %s in progress", w.Code, uri)
+		}
+	}
+}
+
+func TestIdempotentBody(t *testing.T) {
+	dbi := db.NewDB()
+	dbi.SetDebug(true)
+	mux := initTestMux(dbi)
+	tests := []struct {
+		body     string
+		wantCode int
+	}{
+		{`{"tournamentId": 1, "winners": [{"playerId": "10", "prize": 10}]}`, http.StatusNotFound},
+		{`{"tournamentId": 1, "winners": [{"playerId": "10", "prize": 10}]}`, http.StatusNotFound},
+		{`{"tournamentId": 1, "winners": [{"playerId": "10", "prize": 20}]}`, http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodPost, "/resultTournament", strings.NewReader(test.body))
+		r.Header.Set(idempotencyHeader, "result1")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("invalid code %d for body %s: want %d", w.Code, test.body, test.wantCode)
+		}
+	}
+}
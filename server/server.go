@@ -1,23 +1,44 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/cnaize/lifland/db"
+	"github.com/cnaize/lifland/model"
 	h "github.com/cnaize/lifland/server/handle"
 )
 
+type Config struct {
+	// storage backend and directory
+	DB        db.Config
+	SyncDelay time.Duration
+	// delay between the scheduled tournaments checks
+	ScheduleDelay time.Duration
+	// delay between the db snapshots compacting the write-ahead log
+	SnapshotDelay time.Duration
+	// results without tournament id close the oldest open tournament
+	LegacyResult bool
+}
+
 type Server struct {
-	dbi       db.Interface
-	syncDelay time.Duration
-	mux       *http.ServeMux
+	dbi           db.Interface
+	syncDelay     time.Duration
+	scheduleDelay time.Duration
+	snapshotDelay time.Duration
+	mux           *http.ServeMux
 }
 
-func NewServer(syncDelay time.Duration) *Server {
-	dbi := db.NewDB()
-	dbi.Restore()
+func NewServer(config Config) *Server {
+	dbi, err := db.Open(config.DB)
+	if err != nil {
+		panic(err)
+	}
+	if err := dbi.Restore(context.Background()); err != nil {
+		panic(err)
+	}
 
 	mux := http.NewServeMux()
 
@@ -26,18 +47,55 @@ func NewServer(syncDelay time.Duration) *Server {
 
 	// player
 	mux.HandleFunc("/balance", h.Log(h.Balance(dbi)))
-	mux.HandleFunc("/take", h.Log(h.Take(dbi)))
-	mux.HandleFunc("/fund", h.Log(h.Fund(dbi)))
+	mux.HandleFunc("/take", h.Log(h.Idempotent(dbi, h.Take(dbi))))
+	mux.HandleFunc("/fund", h.Log(h.Idempotent(dbi, h.Fund(dbi))))
+
+	// ledger
+	mux.HandleFunc("/audit", h.Log(h.Audit(dbi)))
+	mux.HandleFunc("/history", h.Log(h.History(dbi)))
+	mux.HandleFunc("/houseBalance", h.Log(h.HouseBalance(dbi)))
+
+	// fund
+	mux.HandleFunc("/funds", h.Log(h.Funds(dbi)))
+	mux.HandleFunc("/retryFund", h.Log(h.Idempotent(dbi, h.RetryFund(dbi))))
+	mux.HandleFunc("/reassignFund", h.Log(h.Idempotent(dbi, h.ReassignFund(dbi))))
+	mux.HandleFunc("/writeOffFund", h.Log(h.Idempotent(dbi, h.WriteOffFund(dbi))))
+
+	// template
+	mux.HandleFunc("/createTemplate", h.Log(h.Idempotent(dbi, h.CreateTemplate(dbi))))
+	mux.HandleFunc("/updateTemplate", h.Log(h.Idempotent(dbi, h.UpdateTemplate(dbi))))
+	mux.HandleFunc("/deleteTemplate", h.Log(h.Idempotent(dbi, h.DeleteTemplate(dbi))))
+	mux.HandleFunc("/templates", h.Log(h.Templates(dbi)))
+
+	// series
+	mux.HandleFunc("/createSeries", h.Log(h.Idempotent(dbi, h.CreateSeries(dbi))))
+	mux.HandleFunc("/standings", h.Log(h.Standings(dbi)))
+	mux.HandleFunc("/paySeries", h.Log(h.Idempotent(dbi, h.PaySeries(dbi))))
 
 	// tournament
-	mux.HandleFunc("/announceTournament", h.Log(h.Announce(dbi)))
-	mux.HandleFunc("/joinTournament", h.Log(h.Join(dbi)))
-	mux.HandleFunc("/resultTournament", h.Log(h.Result(dbi)))
+	mux.HandleFunc("/announceTournament", h.Log(h.Idempotent(dbi, h.Announce(dbi))))
+	mux.HandleFunc("/openRegistration", h.Log(h.Idempotent(dbi, h.OpenRegistration(dbi))))
+	mux.HandleFunc("/startTournament", h.Log(h.Idempotent(dbi, h.Start(dbi))))
+	mux.HandleFunc("/joinTournament", h.Log(h.Idempotent(dbi, h.Join(dbi))))
+	mux.HandleFunc("/leaveTournament", h.Log(h.Idempotent(dbi, h.Leave(dbi))))
+	mux.HandleFunc("/waitlist", h.Log(h.Waitlist(dbi)))
+	mux.HandleFunc("/rebuyTournament", h.Log(h.Idempotent(dbi, h.BuyIn(dbi, model.BuyInRebuy))))
+	mux.HandleFunc("/reentryTournament", h.Log(h.Idempotent(dbi, h.BuyIn(dbi, model.BuyInReentry))))
+	mux.HandleFunc("/addonTournament", h.Log(h.Idempotent(dbi, h.BuyIn(dbi, model.BuyInAddon))))
+	mux.HandleFunc("/resultTournament", h.Log(h.Idempotent(dbi, h.Result(dbi, config.LegacyResult))))
+	mux.HandleFunc("/cancelTournament", h.Log(h.Idempotent(dbi, h.Cancel(dbi))))
+	mux.HandleFunc("/eliminate", h.Log(h.Idempotent(dbi, h.Eliminate(dbi))))
+	mux.HandleFunc("/registerTeam", h.Log(h.Idempotent(dbi, h.RegisterTeam(dbi))))
+	mux.HandleFunc("/amendTeam", h.Log(h.Idempotent(dbi, h.AmendTeam(dbi))))
+	mux.HandleFunc("/teams", h.Log(h.Teams(dbi)))
+	mux.HandleFunc("/tickets", h.Log(h.Tickets(dbi)))
 
 	return &Server{
-		dbi:       dbi,
-		syncDelay: syncDelay,
-		mux:       mux,
+		dbi:           dbi,
+		syncDelay:     config.SyncDelay,
+		scheduleDelay: config.ScheduleDelay,
+		snapshotDelay: config.SnapshotDelay,
+		mux:           mux,
 	}
 }
 
@@ -48,12 +106,33 @@ func (s *Server) Run(port string) error {
 	}()
 
 	go s.syncFunds()
+	go s.schedule()
+	go s.snapshot()
 	return http.ListenAndServe(":"+port, s.mux)
 }
 
+// syncFunds drains the pending funds of the legacy dumps, see db.DB.AddFund
 func (s *Server) syncFunds() {
 	for {
-		s.dbi.SyncFunds()
+		if err := s.dbi.SyncFunds(context.Background()); err != nil {
+			fmt.Printf("ERROR: can't sync funds: %+v\n", err)
+		}
 		time.Sleep(s.syncDelay)
 	}
 }
+
+func (s *Server) schedule() {
+	for {
+		h.Schedule(context.Background(), s.dbi, time.Now())
+		time.Sleep(s.scheduleDelay)
+	}
+}
+
+func (s *Server) snapshot() {
+	for {
+		time.Sleep(s.snapshotDelay)
+		if err := s.dbi.Snapshot(context.Background()); err != nil {
+			fmt.Printf("ERROR: can't snapshot db: %+v\n", err)
+		}
+	}
+}